@@ -0,0 +1,382 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const DefaultBatchProgressCollection = "batch_progress"
+
+// ErrSkipBatch can be returned by a batch func to count the batch as skipped instead of failed
+var ErrSkipBatch = errors.New("skip batch")
+
+// BatchFunc processes a single batch of documents
+type BatchFunc[T any] func(ctx context.Context, batch []T) error
+
+// BatchOptions configures ForEachBatch
+type BatchOptions struct {
+	// JobName identifies the checkpoint; without it the walk isn't resumable
+	JobName string
+	// ProgressCollection stores checkpoints, "batch_progress" by default
+	ProgressCollection string
+	// RateLimit is the maximum number of documents per second, 0 means unlimited
+	RateLimit float64
+	// Concurrency is the number of batches processed in parallel, 1 by default
+	Concurrency int
+	// StopOnError stops the walk on the first failed batch. Otherwise the _id ranges of failed
+	// batches are recorded in the checkpoint and retried when the job runs again.
+	StopOnError bool
+	// Restart discards the checkpoint of the job, even a completed one, and walks from the start
+	Restart bool
+}
+
+// BatchRange is the _id range of a failed batch, retried when the job runs again
+type BatchRange struct {
+	From  bson.RawValue `bson:"from" json:"from"`
+	To    bson.RawValue `bson:"to" json:"to"`
+	Count int64         `bson:"count" json:"count"`
+}
+
+// BatchStats counts documents handled by ForEachBatch, including previous runs of the same job
+type BatchStats struct {
+	Processed int64 `bson:"processed" json:"processed"`
+	Failed    int64 `bson:"failed" json:"failed"`
+	Skipped   int64 `bson:"skipped" json:"skipped"`
+}
+
+// batchCheckpoint is stored in the progress collection after every batch.
+// Its stats count only the batches it has moved past, so resumed jobs don't count batches twice.
+type batchCheckpoint struct {
+	JobName      string        `bson:"_id"`
+	Collection   string        `bson:"collection"`
+	LastID       bson.RawValue `bson:"lastId,omitempty"`
+	FailedRanges []BatchRange  `bson:"failedRanges,omitempty"`
+	Done         bool          `bson:"done"`
+	UpdatedAt    time.Time     `bson:"updatedAt"`
+	BatchStats   `bson:",inline"`
+}
+
+// pendingBatch is a fetched batch waiting for its worker
+type pendingBatch[T any] struct {
+	seq     int
+	docs    []T
+	firstID bson.RawValue
+	lastID  bson.RawValue
+	err     error
+}
+
+// ForEachBatch walks documents matching the filter in _id order, calling fn for every batch.
+// Batches are fetched with keyset ranges on _id, so the walk is stable while documents change.
+// With a JobName, a checkpoint is saved after every batch and a restarted job first retries
+// the failed batches, then resumes after the last completed batch; a job that has already
+// completed only retries its failed batches, unless Restart is set.
+func (r *Repository[T]) ForEachBatch(ctx context.Context, filter any, batchSize int64, fn BatchFunc[T], opts ...BatchOptions) (BatchStats, error) {
+	if batchSize < 1 {
+		return BatchStats{}, fmt.Errorf("invalid batchSize: must be >= 1")
+	}
+	var cfg BatchOptions
+	if len(opts) > 0 {
+		cfg = opts[0]
+	}
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	if cfg.ProgressCollection == "" {
+		cfg.ProgressCollection = DefaultBatchProgressCollection
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	progress := r.collection.Database().Collection(cfg.ProgressCollection)
+	checkpoint := batchCheckpoint{JobName: cfg.JobName, Collection: r.collection.Name()}
+	if cfg.JobName != "" && cfg.Restart {
+		if _, err := progress.DeleteOne(ctx, bson.M{"_id": cfg.JobName}); err != nil {
+			return BatchStats{}, fmt.Errorf("failed to reset checkpoint: %w", err)
+		}
+	} else if cfg.JobName != "" {
+		err := progress.FindOne(ctx, bson.M{"_id": cfg.JobName}).Decode(&checkpoint)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return BatchStats{}, fmt.Errorf("failed to load checkpoint: %w", err)
+		}
+		if err = checkpoint.check(r.collection.Name()); err != nil {
+			return BatchStats{}, err
+		}
+		if err = r.retryFailedRanges(ctx, progress, &checkpoint, filter, fn, cfg.StopOnError); err != nil {
+			return checkpoint.BatchStats, err
+		}
+		if checkpoint.Done {
+			return checkpoint.BatchStats, nil
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		stopped  BatchStats
+		tracker  = batchTracker{checkpoint: &checkpoint, completed: make(map[int]batchResult)}
+	)
+
+	// commit advances the checkpoint over contiguous completed batches, so a resumed
+	// job never skips a batch that was still in flight when the previous run stopped.
+	commit := func(b pendingBatch[T]) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if b.err != nil && !errors.Is(b.err, ErrSkipBatch) {
+			if firstErr == nil {
+				firstErr = b.err
+			}
+			if cfg.StopOnError {
+				// Keep the checkpoint before the failed batch, so it's retried on resume.
+				stopped.Failed += int64(len(b.docs))
+				return nil
+			}
+		}
+
+		advanced := tracker.complete(b.seq, batchResult{count: int64(len(b.docs)), firstID: b.firstID, lastID: b.lastID, err: b.err})
+		if !advanced || cfg.JobName == "" {
+			return nil
+		}
+		return r.saveCheckpoint(ctx, progress, checkpoint)
+	}
+
+	batches := make(chan pendingBatch[T])
+	workerErr := make(chan error, cfg.Concurrency)
+	var wg sync.WaitGroup
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				b.err = fn(workerCtx, b.docs)
+				if err := commit(b); err != nil {
+					workerErr <- err
+					cancel()
+					return
+				}
+				if b.err != nil && !errors.Is(b.err, ErrSkipBatch) && cfg.StopOnError {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	fetchErr := r.fetchBatches(workerCtx, filter, batchSize, checkpoint.LastID, cfg.RateLimit, batches)
+	close(batches)
+	wg.Wait()
+	close(workerErr)
+
+	if err := <-workerErr; err != nil {
+		return checkpoint.BatchStats, err
+	}
+	if firstErr != nil && cfg.StopOnError {
+		stats := checkpoint.BatchStats
+		stats.Failed += stopped.Failed
+		return stats, fmt.Errorf("batch failed: %w", firstErr)
+	}
+	if fetchErr != nil {
+		return checkpoint.BatchStats, fetchErr
+	}
+
+	if cfg.JobName != "" {
+		checkpoint.Done = true
+		if err := r.saveCheckpoint(ctx, progress, checkpoint); err != nil {
+			return checkpoint.BatchStats, err
+		}
+	}
+	return checkpoint.BatchStats, nil
+}
+
+// fetchBatches reads batches in _id order after lastID and sends them to the workers
+func (r *Repository[T]) fetchBatches(ctx context.Context, filter any, batchSize int64, lastID bson.RawValue, rateLimit float64, out chan<- pendingBatch[T]) error {
+	findOpts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(batchSize)
+	nextAllowed := time.Now()
+
+	for seq := 0; ; seq++ {
+		cursor, err := r.collection.Find(ctx, afterIDQuery(filter, lastID), findOpts)
+		if err != nil {
+			return fmt.Errorf("failed to execute find: %w", err)
+		}
+		batch := pendingBatch[T]{seq: seq}
+		for cursor.Next(ctx) {
+			var doc T
+			if err = cursor.Decode(&doc); err != nil {
+				cursor.Close(ctx)
+				return fmt.Errorf("failed to decode document: %w", err)
+			}
+			batch.docs = append(batch.docs, doc)
+			batch.lastID = copyRawValue(cursor.Current.Lookup("_id"))
+			if len(batch.docs) == 1 {
+				batch.firstID = batch.lastID
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read documents: %w", err)
+		}
+		if len(batch.docs) == 0 {
+			return nil
+		}
+		lastID = batch.lastID
+
+		if rateLimit > 0 {
+			if wait := time.Until(nextAllowed); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			nextAllowed = time.Now().Add(time.Duration(float64(len(batch.docs)) / rateLimit * float64(time.Second)))
+		}
+
+		select {
+		case out <- batch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if int64(len(batch.docs)) < batchSize {
+			return nil
+		}
+	}
+}
+
+// retryFailedRanges processes the failed batches of previous runs again, one at a time.
+// Ranges that fail again stay in the checkpoint.
+func (r *Repository[T]) retryFailedRanges(ctx context.Context, progress *mongo.Collection, checkpoint *batchCheckpoint, filter any, fn BatchFunc[T], stopOnError bool) error {
+	ranges := checkpoint.FailedRanges
+	var remaining []BatchRange
+	for i, rng := range ranges {
+		cursor, err := r.collection.Find(ctx, rangeQuery(filter, rng), options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+		if err != nil {
+			return fmt.Errorf("failed to execute find: %w", err)
+		}
+		var docs []T
+		if err = cursor.All(ctx, &docs); err != nil {
+			return fmt.Errorf("failed to read documents: %w", err)
+		}
+
+		n := int64(len(docs))
+		if n > 0 {
+			err = fn(ctx, docs)
+		}
+		if failed, ok := checkpoint.retried(rng, n, err); ok {
+			remaining = append(remaining, failed)
+		}
+		checkpoint.FailedRanges = append(slices.Clone(remaining), ranges[i+1:]...)
+
+		if saveErr := r.saveCheckpoint(ctx, progress, *checkpoint); saveErr != nil {
+			return saveErr
+		}
+		if err != nil && !errors.Is(err, ErrSkipBatch) && stopOnError {
+			return fmt.Errorf("batch failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// check returns an error if the checkpoint was saved by a walk of another collection
+func (c *batchCheckpoint) check(collection string) error {
+	if c.Collection != collection {
+		return fmt.Errorf("checkpoint of job %s belongs to collection %s, not %s: use another JobName or Restart", c.JobName, c.Collection, collection)
+	}
+	return nil
+}
+
+// record adds a batch that the walk has moved past to the checkpoint
+func (c *batchCheckpoint) record(b batchResult) {
+	switch {
+	case b.err == nil:
+		c.Processed += b.count
+	case errors.Is(b.err, ErrSkipBatch):
+		c.Skipped += b.count
+	default:
+		c.Failed += b.count
+		c.FailedRanges = append(c.FailedRanges, BatchRange{From: b.firstID, To: b.lastID, Count: b.count})
+	}
+	c.LastID = b.lastID
+}
+
+// retried updates the stats after a failed range was processed again with n documents.
+// It returns the range to keep when it failed again.
+func (c *batchCheckpoint) retried(rng BatchRange, n int64, err error) (BatchRange, bool) {
+	c.Failed -= rng.Count
+	switch {
+	case err == nil:
+		c.Processed += n
+	case errors.Is(err, ErrSkipBatch):
+		c.Skipped += n
+	default:
+		c.Failed += n
+		rng.Count = n
+		return rng, true
+	}
+	return BatchRange{}, false
+}
+
+// batchResult is the outcome of a processed batch
+type batchResult struct {
+	count   int64
+	firstID bson.RawValue
+	lastID  bson.RawValue
+	err     error
+}
+
+// batchTracker records batches in the checkpoint in fetch order, whatever order they complete in
+type batchTracker struct {
+	checkpoint *batchCheckpoint
+	completed  map[int]batchResult
+	nextSeq    int
+}
+
+// complete adds the batch and records the contiguous batches completed so far.
+// It reports whether the checkpoint has advanced.
+func (t *batchTracker) complete(seq int, b batchResult) bool {
+	t.completed[seq] = b
+	advanced := false
+	for {
+		done, ok := t.completed[t.nextSeq]
+		if !ok {
+			return advanced
+		}
+		delete(t.completed, t.nextSeq)
+		t.checkpoint.record(done)
+		t.nextSeq++
+		advanced = true
+	}
+}
+
+// afterIDQuery restricts the filter to documents after lastID, the next keyset range of the walk
+func afterIDQuery(filter any, lastID bson.RawValue) any {
+	if lastID.Type == 0 {
+		return filter
+	}
+	return bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": lastID}}}}
+}
+
+// rangeQuery restricts the filter to the _id range of a failed batch
+func rangeQuery(filter any, rng BatchRange) any {
+	return bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gte": rng.From, "$lte": rng.To}}}}
+}
+
+func (r *Repository[T]) saveCheckpoint(ctx context.Context, progress *mongo.Collection, checkpoint batchCheckpoint) error {
+	checkpoint.UpdatedAt = time.Now()
+	_, err := progress.ReplaceOne(ctx, bson.M{"_id": checkpoint.JobName}, checkpoint, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
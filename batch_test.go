@@ -0,0 +1,167 @@
+package mongoclient
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func rawInt(t *testing.T, n int32) bson.RawValue {
+	t.Helper()
+	raw, err := bson.Marshal(bson.D{{Key: "v", Value: n}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bson.Raw(raw).Lookup("v")
+}
+
+func TestBatchTracker(t *testing.T) {
+	failed := errors.New("boom")
+	type completion struct {
+		seq           int
+		first, last   int32
+		err           error
+		wantAdvanced  bool
+		wantLastID    int32
+		wantProcessed int64
+	}
+
+	tests := []struct {
+		name        string
+		completions []completion
+		wantStats   BatchStats
+		wantRanges  [][2]int32
+	}{
+		{
+			name: "in order",
+			completions: []completion{
+				{seq: 0, first: 1, last: 10, wantAdvanced: true, wantLastID: 10, wantProcessed: 10},
+				{seq: 1, first: 11, last: 20, wantAdvanced: true, wantLastID: 20, wantProcessed: 20},
+			},
+			wantStats: BatchStats{Processed: 20},
+		},
+		{
+			name: "out of order waits for the earlier batch",
+			completions: []completion{
+				{seq: 1, first: 11, last: 20},
+				{seq: 2, first: 21, last: 30},
+				{seq: 0, first: 1, last: 10, wantAdvanced: true, wantLastID: 30, wantProcessed: 30},
+			},
+			wantStats: BatchStats{Processed: 30},
+		},
+		{
+			name: "failed and skipped batches",
+			completions: []completion{
+				{seq: 0, first: 1, last: 10, err: failed, wantAdvanced: true, wantLastID: 10},
+				{seq: 1, first: 11, last: 20, err: ErrSkipBatch, wantAdvanced: true, wantLastID: 20},
+				{seq: 2, first: 21, last: 30, wantAdvanced: true, wantLastID: 30, wantProcessed: 10},
+			},
+			wantStats:  BatchStats{Processed: 10, Failed: 10, Skipped: 10},
+			wantRanges: [][2]int32{{1, 10}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var checkpoint batchCheckpoint
+			tracker := batchTracker{checkpoint: &checkpoint, completed: make(map[int]batchResult)}
+			for _, c := range tt.completions {
+				advanced := tracker.complete(c.seq, batchResult{count: int64(c.last - c.first + 1), firstID: rawInt(t, c.first), lastID: rawInt(t, c.last), err: c.err})
+				if advanced != c.wantAdvanced {
+					t.Fatalf("complete(%d) = %v, want %v", c.seq, advanced, c.wantAdvanced)
+				}
+				if advanced && (checkpoint.LastID.Int32() != c.wantLastID || checkpoint.Processed != c.wantProcessed) {
+					t.Fatalf("after complete(%d) lastId = %v, processed = %d, want %d, %d", c.seq, checkpoint.LastID, checkpoint.Processed, c.wantLastID, c.wantProcessed)
+				}
+			}
+			if checkpoint.BatchStats != tt.wantStats {
+				t.Errorf("stats = %+v, want %+v", checkpoint.BatchStats, tt.wantStats)
+			}
+			if len(checkpoint.FailedRanges) != len(tt.wantRanges) {
+				t.Fatalf("failed ranges = %v, want %v", checkpoint.FailedRanges, tt.wantRanges)
+			}
+			for i, rng := range checkpoint.FailedRanges {
+				if rng.From.Int32() != tt.wantRanges[i][0] || rng.To.Int32() != tt.wantRanges[i][1] {
+					t.Errorf("failed range %d = %v..%v, want %v", i, rng.From, rng.To, tt.wantRanges[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBatchCheckpointRetried(t *testing.T) {
+	tests := []struct {
+		name      string
+		n         int64
+		err       error
+		want      BatchStats
+		wantKept  bool
+		wantCount int64
+	}{
+		{name: "processed", n: 8, want: BatchStats{Processed: 8}},
+		{name: "skipped", n: 8, err: ErrSkipBatch, want: BatchStats{Skipped: 8}},
+		{name: "failed again", n: 8, err: errors.New("boom"), want: BatchStats{Failed: 8}, wantKept: true, wantCount: 8},
+		{name: "range emptied meanwhile", n: 0, want: BatchStats{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoint := batchCheckpoint{BatchStats: BatchStats{Failed: 10}}
+			rng, kept := checkpoint.retried(BatchRange{From: rawInt(t, 1), To: rawInt(t, 10), Count: 10}, tt.n, tt.err)
+			if kept != tt.wantKept || rng.Count != tt.wantCount {
+				t.Errorf("retried() = %+v, %v, want count %d, %v", rng, kept, tt.wantCount, tt.wantKept)
+			}
+			if checkpoint.BatchStats != tt.want {
+				t.Errorf("stats = %+v, want %+v", checkpoint.BatchStats, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchCheckpointCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		wantErr    bool
+	}{
+		{name: "same collection", collection: "users"},
+		{name: "other collection", collection: "orders", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoint := batchCheckpoint{JobName: "job", Collection: tt.collection}
+			if err := checkpoint.check("users"); (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBatchQueries(t *testing.T) {
+	filter := bson.M{"active": true}
+	render := func(v any) string {
+		data, err := canonicalDocument(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name  string
+		query any
+		want  string
+	}{
+		{name: "first batch", query: afterIDQuery(filter, bson.RawValue{}), want: `{"active":true}`},
+		{name: "next batch", query: afterIDQuery(filter, rawInt(t, 10)), want: `{"$and":[{"active":true},{"_id":{"$gt":10}}]}`},
+		{name: "failed range", query: rangeQuery(filter, BatchRange{From: rawInt(t, 1), To: rawInt(t, 10)}), want: `{"$and":[{"active":true},{"_id":{"$gte":1,"$lte":10}}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(tt.query); got != tt.want {
+				t.Errorf("query = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package mongoclient
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Cache stores encoded documents for CachedRepository. Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	// Set stores the value, a zero ttl means the entry lives until it's evicted
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// lruEntry is an entry of LRUCache
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// LRUCache is a bounded in-memory Cache that evicts the least recently used entries
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+// DefaultLRUCacheCapacity is the capacity of an LRUCache created with a capacity < 1
+const DefaultLRUCacheCapacity = 1000
+
+// NewLRUCache creates an in-memory cache holding up to capacity entries,
+// DefaultLRUCacheCapacity if capacity < 1
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity < 1 {
+		capacity = DefaultLRUCacheCapacity
+	}
+	return &LRUCache{capacity: capacity, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns the value of a live entry and marks it as recently used
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set stores the value, a zero ttl means the entry lives until it's evicted
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = &lruEntry{key: key, value: value, expiresAt: expiresAt}
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Len returns the number of entries, including expired ones not evicted yet
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// CacheOptions configures a CachedRepository
+type CacheOptions struct {
+	// TTL is how long documents stay cached, 1m by default
+	TTL time.Duration
+}
+
+// cacheCall is an in-flight load shared by concurrent lookups of the same key
+type cacheCall struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// CachedRepository is a read-through caching decorator of a repository.
+// FindOne and FindByID are cached by normalized filter; every write through it invalidates
+// the cached entries of the collection. Writes made elsewhere are seen after the TTL.
+// Reads in a transaction bypass the cache, and writes in a transaction started by WithTransaction
+// invalidate it again after the commit, so values read before the commit are not kept.
+//
+// Keys include a generation of the collection stored in the cache, so invalidation replaces it
+// in O(1) and entries of older generations are never read again; they are evicted or expire.
+// Repositories sharing a cache see each other's invalidations.
+type CachedRepository[T any] struct {
+	IRepository[T]
+	cache  Cache
+	opts   CacheOptions
+	prefix string
+
+	mu    sync.Mutex
+	calls map[string]*cacheCall
+}
+
+// NewCachedRepository wraps the repository with the cache
+func NewCachedRepository[T any](repo IRepository[T], cache Cache, opts CacheOptions) *CachedRepository[T] {
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	collection := repo.Collection()
+	return &CachedRepository[T]{
+		IRepository: repo,
+		cache:       cache,
+		opts:        opts,
+		prefix:      collection.Database().Name() + "." + collection.Name() + ":",
+		calls:       make(map[string]*cacheCall),
+	}
+}
+
+// FindOne retrieves a single document, from the cache if possible.
+// Calls with options or in a transaction are not cached.
+func (c *CachedRepository[T]) FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) (T, error) {
+	var result T
+	if filter == nil {
+		filter = bson.M{}
+	}
+	// A transaction may read its own uncommitted writes.
+	if len(opts) > 0 || TransactionSession(ctx) != nil {
+		return c.IRepository.FindOne(ctx, filter, opts...)
+	}
+	key, err := c.key(filter)
+	if err != nil {
+		return c.IRepository.FindOne(ctx, filter)
+	}
+
+	data, ok := c.cache.Get(key)
+	if !ok {
+		data, err = c.load(ctx, key, func(ctx context.Context) ([]byte, error) {
+			doc, err := c.IRepository.FindOne(ctx, filter)
+			if err != nil {
+				return nil, err
+			}
+			return bson.Marshal(doc)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	if err = bson.Unmarshal(data, &result); err != nil {
+		return result, fmt.Errorf("failed to decode cached document: %w", err)
+	}
+	return result, nil
+}
+
+// FindByID finds a document by its ID, from the cache if possible
+func (c *CachedRepository[T]) FindByID(ctx context.Context, id any, opts ...options.Lister[options.FindOneOptions]) (T, error) {
+	return c.FindOne(ctx, bson.M{"_id": id}, opts...)
+}
+
+// Invalidate removes all cached entries of the collection by starting a new generation
+func (c *CachedRepository[T]) Invalidate() {
+	c.cache.Set(c.prefix+"generation", []byte(bson.NewObjectID().Hex()), 0)
+}
+
+// invalidate invalidates the cache after a write, and again after the commit if the write
+// is part of a transaction, as readers may cache the old value until then
+func (c *CachedRepository[T]) invalidate(ctx context.Context) {
+	c.Invalidate()
+	afterCommit(ctx, c.Invalidate)
+}
+
+// generation returns the current generation of the collection, starting one if the cache has none
+func (c *CachedRepository[T]) generation() string {
+	if gen, ok := c.cache.Get(c.prefix + "generation"); ok {
+		return string(gen)
+	}
+	gen := bson.NewObjectID().Hex()
+	c.cache.Set(c.prefix+"generation", []byte(gen), 0)
+	return gen
+}
+
+// load runs fn once for concurrent lookups of the key and caches its result. Waiters return when
+// their own context is done, and load again themselves if the shared call failed because the
+// context of its caller was done.
+func (c *CachedRepository[T]) load(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	for {
+		c.mu.Lock()
+		call, ok := c.calls[key]
+		if !ok {
+			call = &cacheCall{done: make(chan struct{})}
+			c.calls[key] = call
+			c.mu.Unlock()
+
+			call.data, call.err = fn(ctx)
+			if call.err == nil {
+				c.cache.Set(key, call.data, c.opts.TTL)
+			}
+
+			c.mu.Lock()
+			delete(c.calls, key)
+			c.mu.Unlock()
+			close(call.done)
+			return call.data, call.err
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if isContextError(call.err) && ctx.Err() == nil {
+			continue
+		}
+		return call.data, call.err
+	}
+}
+
+// isContextError reports whether the error comes from a canceled or expired context
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// key returns the cache key of the filter in the current generation.
+// A load started before a write stores its result under the old generation, where it's never read.
+func (c *CachedRepository[T]) key(filter any) (string, error) {
+	data, err := bson.Marshal(filter)
+	if err != nil {
+		return "", err
+	}
+	normalized, err := normalizeFilter(data, true)
+	if err != nil {
+		return "", err
+	}
+	return c.prefix + c.generation() + ":" + normalized, nil
+}
+
+// normalizeFilter renders the filter so equivalent filters give the same string.
+// Keys are sorted in top-level filters and operator documents, where their order doesn't matter,
+// and kept as is in embedded documents matched exactly.
+func normalizeFilter(doc bson.Raw, sortKeys bool) (string, error) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return "", err
+	}
+
+	parts := make([]string, len(elements))
+	operators := true
+	for i, element := range elements {
+		key := element.Key()
+		if !strings.HasPrefix(key, "$") {
+			operators = false
+		}
+		value, err := normalizeFilterValue(key, element.Value())
+		if err != nil {
+			return "", err
+		}
+		parts[i] = strconv.Quote(key) + ":" + value
+	}
+	if sortKeys || operators {
+		sort.Strings(parts)
+	}
+	return "{" + strings.Join(parts, ",") + "}", nil
+}
+
+// normalizeFilterValue renders a filter value, the documents of logical operators are filters themselves
+func normalizeFilterValue(key string, value bson.RawValue) (string, error) {
+	switch value.Type {
+	case bson.TypeEmbeddedDocument:
+		return normalizeFilter(value.Document(), false)
+	case bson.TypeArray:
+		values, err := value.Array().Values()
+		if err != nil {
+			return "", err
+		}
+		logical := key == "$and" || key == "$or" || key == "$nor"
+		parts := make([]string, len(values))
+		for i, v := range values {
+			if logical && v.Type == bson.TypeEmbeddedDocument {
+				parts[i], err = normalizeFilter(v.Document(), true)
+			} else {
+				parts[i], err = normalizeFilterValue("", v)
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		return "[" + strings.Join(parts, ",") + "]", nil
+	default:
+		return value.String(), nil
+	}
+}
+
+// InsertOne inserts a new document and invalidates the cache
+func (c *CachedRepository[T]) InsertOne(ctx context.Context, document T, opts ...options.Lister[options.InsertOneOptions]) (T, error) {
+	defer c.invalidate(ctx)
+	return c.IRepository.InsertOne(ctx, document, opts...)
+}
+
+// InsertMany inserts multiple documents and invalidates the cache
+func (c *CachedRepository[T]) InsertMany(ctx context.Context, documents []T, opts ...options.Lister[options.InsertManyOptions]) ([]any, error) {
+	defer c.invalidate(ctx)
+	return c.IRepository.InsertMany(ctx, documents, opts...)
+}
+
+// FindOneAndUpdate finds a document, updates it and invalidates the cache
+func (c *CachedRepository[T]) FindOneAndUpdate(ctx context.Context, filter, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) (T, error) {
+	defer c.invalidate(ctx)
+	return c.IRepository.FindOneAndUpdate(ctx, filter, update, opts...)
+}
+
+// FindOneAndUpdateByID finds a document by its ID, updates it and invalidates the cache
+func (c *CachedRepository[T]) FindOneAndUpdateByID(ctx context.Context, id, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) (T, error) {
+	defer c.invalidate(ctx)
+	return c.IRepository.FindOneAndUpdateByID(ctx, id, update, opts...)
+}
+
+// FindOneAndDelete finds a document, deletes it and invalidates the cache
+func (c *CachedRepository[T]) FindOneAndDelete(ctx context.Context, filter any, opts ...options.Lister[options.FindOneAndDeleteOptions]) (T, error) {
+	defer c.invalidate(ctx)
+	return c.IRepository.FindOneAndDelete(ctx, filter, opts...)
+}
+
+// UpdateOne updates a single document and invalidates the cache
+func (c *CachedRepository[T]) UpdateOne(ctx context.Context, filter, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+	defer c.invalidate(ctx)
+	return c.IRepository.UpdateOne(ctx, filter, update, opts...)
+}
+
+// UpdateByID updates a document by its ID and invalidates the cache
+func (c *CachedRepository[T]) UpdateByID(ctx context.Context, id any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+	defer c.invalidate(ctx)
+	return c.IRepository.UpdateByID(ctx, id, update, opts...)
+}
+
+// UpdateMany updates multiple documents and invalidates the cache
+func (c *CachedRepository[T]) UpdateMany(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateManyOptions]) (*mongo.UpdateResult, error) {
+	defer c.invalidate(ctx)
+	return c.IRepository.UpdateMany(ctx, filter, update, opts...)
+}
+
+// DeleteOne deletes a single document and invalidates the cache
+func (c *CachedRepository[T]) DeleteOne(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) error {
+	defer c.invalidate(ctx)
+	return c.IRepository.DeleteOne(ctx, filter, opts...)
+}
+
+// DeleteByID deletes a document by its ID and invalidates the cache
+func (c *CachedRepository[T]) DeleteByID(ctx context.Context, id any, opts ...options.Lister[options.DeleteOneOptions]) error {
+	defer c.invalidate(ctx)
+	return c.IRepository.DeleteByID(ctx, id, opts...)
+}
+
+// DeleteMany deletes multiple documents and invalidates the cache
+func (c *CachedRepository[T]) DeleteMany(ctx context.Context, filter any, opts ...options.Lister[options.DeleteManyOptions]) (int64, error) {
+	defer c.invalidate(ctx)
+	return c.IRepository.DeleteMany(ctx, filter, opts...)
+}
+
+// BulkWrite executes bulk write operations and invalidates the cache
+func (c *CachedRepository[T]) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...options.Lister[options.BulkWriteOptions]) (*mongo.BulkWriteResult, error) {
+	defer c.invalidate(ctx)
+	return c.IRepository.BulkWrite(ctx, models, opts...)
+}
+
+// Transaction runs the function in a transaction and invalidates the cache
+func (c *CachedRepository[T]) Transaction(ctx context.Context, fn func(sessCtx context.Context) error, opts ...options.Lister[options.SessionOptions]) error {
+	defer c.invalidate(ctx)
+	return c.IRepository.Transaction(ctx, fn, opts...)
+}
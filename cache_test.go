@@ -0,0 +1,285 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestNormalizeFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  any
+		equal bool
+	}{
+		{
+			name:  "top-level keys in any order",
+			a:     bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 2}},
+			b:     bson.D{{Key: "b", Value: 2}, {Key: "a", Value: 1}},
+			equal: true,
+		},
+		{
+			name:  "operators in any order",
+			a:     bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 1}, {Key: "$lt", Value: 9}}}},
+			b:     bson.D{{Key: "age", Value: bson.D{{Key: "$lt", Value: 9}, {Key: "$gt", Value: 1}}}},
+			equal: true,
+		},
+		{
+			name:  "clauses of logical operators",
+			a:     bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 2}}}}},
+			b:     bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "b", Value: 2}, {Key: "a", Value: 1}}}}},
+			equal: true,
+		},
+		{
+			name:  "embedded documents keep their order",
+			a:     bson.D{{Key: "address", Value: bson.D{{Key: "city", Value: "x"}, {Key: "zip", Value: "1"}}}},
+			b:     bson.D{{Key: "address", Value: bson.D{{Key: "zip", Value: "1"}, {Key: "city", Value: "x"}}}},
+			equal: false,
+		},
+		{
+			name:  "array order matters",
+			a:     bson.D{{Key: "tags", Value: bson.A{"a", "b"}}},
+			b:     bson.D{{Key: "tags", Value: bson.A{"b", "a"}}},
+			equal: false,
+		},
+		{
+			name:  "value types differ",
+			a:     bson.D{{Key: "n", Value: int32(1)}},
+			b:     bson.D{{Key: "n", Value: "1"}},
+			equal: false,
+		},
+	}
+
+	normalize := func(t *testing.T, filter any) string {
+		t.Helper()
+		data, err := bson.Marshal(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := normalizeFilter(data, true)
+		if err != nil {
+			t.Fatalf("normalizeFilter() error = %v", err)
+		}
+		return s
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := normalize(t, tt.a), normalize(t, tt.b)
+			if (a == b) != tt.equal {
+				t.Errorf("normalizeFilter() = %s and %s, want equal = %v", a, b, tt.equal)
+			}
+		})
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(c *LRUCache)
+		want map[string]string
+	}{
+		{
+			name: "evicts the least recently used",
+			run: func(c *LRUCache) {
+				c.Set("a", []byte("1"), 0)
+				c.Set("b", []byte("2"), 0)
+				c.Get("a")
+				c.Set("c", []byte("3"), 0)
+			},
+			want: map[string]string{"a": "1", "b": "", "c": "3"},
+		},
+		{
+			name: "overwrites keep one entry",
+			run: func(c *LRUCache) {
+				c.Set("a", []byte("1"), 0)
+				c.Set("a", []byte("2"), 0)
+				c.Set("b", []byte("3"), 0)
+			},
+			want: map[string]string{"a": "2", "b": "3"},
+		},
+		{
+			name: "expired entries are missing",
+			run: func(c *LRUCache) {
+				c.Set("a", []byte("1"), time.Nanosecond)
+				c.Set("b", []byte("2"), time.Hour)
+				time.Sleep(time.Millisecond)
+			},
+			want: map[string]string{"a": "", "b": "2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewLRUCache(2)
+			tt.run(c)
+			for key, want := range tt.want {
+				got, ok := c.Get(key)
+				if ok != (want != "") || string(got) != want {
+					t.Errorf("Get(%q) = %q, %v, want %q", key, got, ok, want)
+				}
+			}
+			if c.Len() > 2 {
+				t.Errorf("Len() = %d, want at most 2", c.Len())
+			}
+		})
+	}
+}
+
+func TestNewLRUCacheCapacity(t *testing.T) {
+	tests := []struct {
+		capacity int
+		want     int
+	}{
+		{capacity: -1, want: DefaultLRUCacheCapacity},
+		{capacity: 0, want: DefaultLRUCacheCapacity},
+		{capacity: 1, want: 1},
+		{capacity: 50, want: 50},
+	}
+	for _, tt := range tests {
+		if got := NewLRUCache(tt.capacity).capacity; got != tt.want {
+			t.Errorf("NewLRUCache(%d) capacity = %d, want %d", tt.capacity, got, tt.want)
+		}
+	}
+}
+
+type cacheUser struct {
+	Name string `bson:"name"`
+}
+
+// countingRepository counts FindOne calls and blocks them until release is closed
+type countingRepository struct {
+	IRepository[*cacheUser]
+	collection *mongo.Collection
+	calls      atomic.Int32
+	release    chan struct{}
+}
+
+func (r *countingRepository) Collection() *mongo.Collection {
+	return r.collection
+}
+
+func (r *countingRepository) FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) (*cacheUser, error) {
+	r.calls.Add(1)
+	select {
+	case <-r.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &cacheUser{Name: "alice"}, nil
+}
+
+func (r *countingRepository) UpdateOne(ctx context.Context, filter, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+	return &mongo.UpdateResult{}, nil
+}
+
+func newCountingRepository(t *testing.T) *countingRepository {
+	t.Helper()
+	client, err := mongo.Connect(options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+	return &countingRepository{collection: client.Database("db").Collection("users"), release: make(chan struct{})}
+}
+
+func TestCachedRepositoryInvalidate(t *testing.T) {
+	repo := newCountingRepository(t)
+	close(repo.release)
+	cached := NewCachedRepository[*cacheUser](repo, NewLRUCache(10), CacheOptions{})
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := cached.FindByID(ctx, 1); err != nil {
+			t.Fatalf("FindByID() error = %v", err)
+		}
+	}
+	if got := repo.calls.Load(); got != 1 {
+		t.Fatalf("FindOne calls = %d, want 1", got)
+	}
+
+	if _, err := cached.UpdateOne(ctx, bson.M{"_id": 1}, bson.M{"$set": bson.M{"name": "bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.FindByID(ctx, 1); err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if got := repo.calls.Load(); got != 2 {
+		t.Errorf("FindOne calls after a write = %d, want 2", got)
+	}
+}
+
+func TestCachedRepositoryWaiterContext(t *testing.T) {
+	repo := newCountingRepository(t)
+	cached := NewCachedRepository[*cacheUser](repo, NewLRUCache(10), CacheOptions{})
+
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := cached.FindByID(context.Background(), 1)
+		leaderDone <- err
+	}()
+	for repo.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := cached.FindByID(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiter FindByID() error = %v, want its own deadline", err)
+	}
+
+	close(repo.release)
+	if err := <-leaderDone; err != nil {
+		t.Errorf("leader FindByID() error = %v", err)
+	}
+	if got := repo.calls.Load(); got != 1 {
+		t.Errorf("FindOne calls = %d, want 1", got)
+	}
+}
+
+func TestCachedRepositoryTransaction(t *testing.T) {
+	repo := newCountingRepository(t)
+	close(repo.release)
+	cached := NewCachedRepository[*cacheUser](repo, NewLRUCache(10), CacheOptions{})
+
+	session, err := repo.collection.Database().Client().StartSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.EndSession(context.Background())
+	if err = session.StartTransaction(); err != nil {
+		t.Fatal(err)
+	}
+	hooks := &commitHooks{}
+	txnCtx := context.WithValue(mongo.NewSessionContext(context.Background(), session), commitHooksKey{}, hooks)
+
+	for range 2 {
+		if _, err = cached.FindByID(txnCtx, 1); err != nil {
+			t.Fatalf("FindByID() in a transaction error = %v", err)
+		}
+	}
+	if got := repo.calls.Load(); got != 2 {
+		t.Fatalf("FindOne calls in a transaction = %d, want 2: they must bypass the cache", got)
+	}
+
+	if _, err = cached.UpdateOne(txnCtx, bson.M{"_id": 1}, bson.M{"$set": bson.M{"name": "bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	// A reader outside the transaction caches the value from before the commit.
+	if _, err = cached.FindByID(context.Background(), 1); err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	hooks.run()
+	if _, err = cached.FindByID(context.Background(), 1); err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if got := repo.calls.Load(); got != 4 {
+		t.Errorf("FindOne calls after the commit = %d, want 4: the commit must invalidate the cache", got)
+	}
+}
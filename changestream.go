@@ -0,0 +1,202 @@
+package mongoclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// OperationType is the type of a change stream event
+type OperationType string
+
+const (
+	OperationInsert       OperationType = "insert"
+	OperationUpdate       OperationType = "update"
+	OperationReplace      OperationType = "replace"
+	OperationDelete       OperationType = "delete"
+	OperationDrop         OperationType = "drop"
+	OperationRename       OperationType = "rename"
+	OperationDropDatabase OperationType = "dropDatabase"
+	OperationInvalidate   OperationType = "invalidate"
+)
+
+// Namespace is the database and collection of a change event
+type Namespace struct {
+	DB         string `bson:"db" json:"db"`
+	Collection string `bson:"coll" json:"coll"`
+}
+
+// TruncatedArray describes an array shrunk by an update
+type TruncatedArray struct {
+	Field   string `bson:"field" json:"field"`
+	NewSize int32  `bson:"newSize" json:"newSize"`
+}
+
+// UpdateDescription describes the fields changed by an update event
+type UpdateDescription struct {
+	UpdatedFields   bson.M           `bson:"updatedFields" json:"updatedFields"`
+	RemovedFields   []string         `bson:"removedFields" json:"removedFields"`
+	TruncatedArrays []TruncatedArray `bson:"truncatedArrays,omitempty" json:"truncatedArrays,omitempty"`
+}
+
+// ChangeEvent is a decoded change stream event.
+// FullDocument is set for inserts and replaces, and for updates when the stream is opened
+// with options.ChangeStream().SetFullDocument(options.UpdateLookup).
+// FullDocumentBeforeChange requires pre-images to be enabled on the collection.
+type ChangeEvent[T any] struct {
+	ResumeToken              bson.Raw           `bson:"_id" json:"_id"`
+	OperationType            OperationType      `bson:"operationType" json:"operationType"`
+	ClusterTime              bson.Timestamp     `bson:"clusterTime" json:"clusterTime"`
+	WallTime                 time.Time          `bson:"wallTime,omitempty" json:"wallTime,omitempty"`
+	Namespace                Namespace          `bson:"ns" json:"ns"`
+	DocumentKey              bson.M             `bson:"documentKey,omitempty" json:"documentKey,omitempty"`
+	FullDocument             T                  `bson:"fullDocument,omitempty" json:"fullDocument,omitempty"`
+	FullDocumentBeforeChange T                  `bson:"fullDocumentBeforeChange,omitempty" json:"fullDocumentBeforeChange,omitempty"`
+	UpdateDescription        *UpdateDescription `bson:"updateDescription,omitempty" json:"updateDescription,omitempty"`
+}
+
+// ChangeEventStream iterates over typed change events
+type ChangeEventStream[T any] struct {
+	stream *mongo.ChangeStream
+	event  ChangeEvent[T]
+	err    error
+}
+
+// Next waits for the next event and decodes it, it returns false when the stream fails or is closed
+func (s *ChangeEventStream[T]) Next(ctx context.Context) bool {
+	if s.err != nil || !s.stream.Next(ctx) {
+		return false
+	}
+	return s.decode()
+}
+
+// TryNext decodes the next event if one is available without waiting
+func (s *ChangeEventStream[T]) TryNext(ctx context.Context) bool {
+	if s.err != nil || !s.stream.TryNext(ctx) {
+		return false
+	}
+	return s.decode()
+}
+
+func (s *ChangeEventStream[T]) decode() bool {
+	var event ChangeEvent[T]
+	if err := s.stream.Decode(&event); err != nil {
+		s.err = fmt.Errorf("failed to decode change event: %w", err)
+		return false
+	}
+	s.event = event
+	return true
+}
+
+// Event returns the last decoded event
+func (s *ChangeEventStream[T]) Event() ChangeEvent[T] {
+	return s.event
+}
+
+// Raw returns the last event as sent by the server, with fields the typed event doesn't keep.
+// It's only valid until the next call of Next or TryNext.
+func (s *ChangeEventStream[T]) Raw() bson.Raw {
+	return s.stream.Current
+}
+
+// ResumeToken returns the token to resume the stream after the last event
+func (s *ChangeEventStream[T]) ResumeToken() bson.Raw {
+	return s.stream.ResumeToken()
+}
+
+// Err returns the first error met while iterating
+func (s *ChangeEventStream[T]) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.stream.Err()
+}
+
+// Close closes the underlying change stream
+func (s *ChangeEventStream[T]) Close(ctx context.Context) error {
+	return s.stream.Close(ctx)
+}
+
+// WatchTyped creates a change stream for the collection that yields typed events
+func (r *Repository[T]) WatchTyped(ctx context.Context, pipeline any, opts ...options.Lister[options.ChangeStreamOptions]) (*ChangeEventStream[T], error) {
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+	stream, err := r.Watch(ctx, pipeline, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ChangeEventStream[T]{stream: stream}, nil
+}
+
+// ChangeFilter builds a change stream pipeline that limits events by operation type and fields
+type ChangeFilter struct {
+	operations []OperationType
+	fields     []string
+}
+
+// NewChangeFilter creates an empty change filter that matches all events
+func NewChangeFilter() *ChangeFilter {
+	return &ChangeFilter{}
+}
+
+// Operations limits events to the given operation types
+func (f *ChangeFilter) Operations(ops ...OperationType) *ChangeFilter {
+	f.operations = append(f.operations, ops...)
+	return f
+}
+
+// Fields limits update events to those changing, removing or truncating one of the fields,
+// their subfields or their parents. Other operation types are not affected.
+func (f *ChangeFilter) Fields(fields ...string) *ChangeFilter {
+	f.fields = append(f.fields, fields...)
+	return f
+}
+
+// Pipeline returns the $match stage of the filter followed by the extra stages
+func (f *ChangeFilter) Pipeline(stages ...bson.D) mongo.Pipeline {
+	var and bson.A
+	if len(f.operations) > 0 {
+		and = append(and, bson.M{"operationType": bson.M{"$in": f.operations}})
+	}
+	if len(f.fields) > 0 {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"operationType": bson.M{"$ne": OperationUpdate}},
+			bson.M{"$expr": bson.M{"$or": bson.A{
+				f.anyPathTouched(bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$updateDescription.updatedFields", bson.M{}}}}, "$$this.k"),
+				f.anyPathTouched("$updateDescription.removedFields", "$$this"),
+				f.anyPathTouched("$updateDescription.truncatedArrays", "$$this.field"),
+			}}},
+		}})
+	}
+
+	pipeline := mongo.Pipeline{}
+	if len(and) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$and": and}}})
+	}
+	return append(pipeline, stages...)
+}
+
+// anyPathTouched is an expression checking whether a path of the input array is one of the
+// fields, a subfield of one ("address.zip" for "address") or a parent of one ("address" for "address.zip")
+func (f *ChangeFilter) anyPathTouched(input any, path string) bson.M {
+	var touched bson.A
+	for _, field := range f.fields {
+		touched = append(touched,
+			bson.M{"$eq": bson.A{path, field}},
+			bson.M{"$eq": bson.A{bson.M{"$indexOfBytes": bson.A{path, field + "."}}, 0}},
+			bson.M{"$eq": bson.A{bson.M{"$indexOfBytes": bson.A{field, bson.M{"$concat": bson.A{path, "."}}}}, 0}},
+		)
+	}
+	return bson.M{"$gt": bson.A{
+		bson.M{"$size": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{input, bson.A{}}},
+			"cond":  bson.M{"$or": touched},
+		}}},
+		0,
+	}}
+}
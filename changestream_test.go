@@ -0,0 +1,141 @@
+package mongoclient
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// evalPathExpression evaluates the aggregation operators used by anyPathTouched, with $$this as the path
+func evalPathExpression(t *testing.T, expr any, path string) any {
+	t.Helper()
+	switch e := expr.(type) {
+	case string:
+		if e == "$$this" {
+			return path
+		}
+		return e
+	case int:
+		return e
+	case bson.M:
+		for op, arg := range e {
+			args := arg.(bson.A)
+			switch op {
+			case "$eq":
+				return evalPathExpression(t, args[0], path) == evalPathExpression(t, args[1], path)
+			case "$indexOfBytes":
+				s, sub := evalPathExpression(t, args[0], path).(string), evalPathExpression(t, args[1], path).(string)
+				return strings.Index(s, sub)
+			case "$concat":
+				var b strings.Builder
+				for _, a := range args {
+					b.WriteString(evalPathExpression(t, a, path).(string))
+				}
+				return b.String()
+			case "$or":
+				for _, a := range args {
+					if evalPathExpression(t, a, path).(bool) {
+						return true
+					}
+				}
+				return false
+			}
+			t.Fatalf("unsupported operator %s", op)
+		}
+	}
+	t.Fatalf("unsupported expression %#v", expr)
+	return nil
+}
+
+func TestChangeFilterPathTouched(t *testing.T) {
+	filter := NewChangeFilter().Fields("address", "tags.0", "name")
+	expr := filter.anyPathTouched("$updateDescription.removedFields", "$$this")
+	cond := expr["$gt"].(bson.A)[0].(bson.M)["$size"].(bson.M)["$filter"].(bson.M)["cond"]
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "address", want: true},
+		{path: "address.zip", want: true},
+		{path: "address.geo.lat", want: true},
+		{path: "addressBook", want: false},
+		{path: "tags", want: true},
+		{path: "tags.0", want: true},
+		{path: "tags.1", want: false},
+		{path: "name", want: true},
+		{path: "nickname", want: false},
+		{path: "n", want: false},
+		{path: "age", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := evalPathExpression(t, cond, tt.path); got != tt.want {
+				t.Errorf("path %q touched = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeFilterPipeline(t *testing.T) {
+	project := bson.D{{Key: "$project", Value: bson.M{"fullDocument": 1}}}
+
+	tests := []struct {
+		name   string
+		filter *ChangeFilter
+		stages []bson.D
+		want   []string
+	}{
+		{name: "empty", filter: NewChangeFilter(), want: nil},
+		{name: "extra stages only", filter: NewChangeFilter(), stages: []bson.D{project}, want: []string{"$project"}},
+		{
+			name:   "operations",
+			filter: NewChangeFilter().Operations(OperationInsert, OperationDelete),
+			want:   []string{"$match", `"$in":["insert","delete"]`},
+		},
+		{
+			name:   "fields",
+			filter: NewChangeFilter().Fields("address"),
+			stages: []bson.D{project},
+			want: []string{
+				"$match", `"$ne":"update"`, "$updateDescription.updatedFields",
+				"$updateDescription.removedFields", "$updateDescription.truncatedArrays", "$project",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline := tt.filter.Pipeline(tt.stages...)
+			if len(tt.want) == 0 {
+				if len(pipeline) != 0 {
+					t.Errorf("Pipeline() = %v, want no stages", pipeline)
+				}
+				return
+			}
+			out := pipelineJSON(t, pipeline)
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("Pipeline() = %s, want it to contain %s", out, want)
+				}
+			}
+		})
+	}
+}
+
+func pipelineJSON(t *testing.T, pipeline mongo.Pipeline) string {
+	t.Helper()
+	var b strings.Builder
+	for _, stage := range pipeline {
+		data, err := bson.MarshalExtJSON(stage, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintln(&b, string(data))
+	}
+	return b.String()
+}
@@ -2,35 +2,290 @@ package mongoclient
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"go.mongodb.org/mongo-driver/v2/event"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/connstring"
 )
 
-// Connect returns a new instance of the Mongo database client.
-func Connect(ctx context.Context, uri string, databaseName string) (*mongo.Database, error) {
-	opts := options.Client().ApplyURI(uri)
+// ErrClientClosed is returned by Close when the client was closed already, and by Do once Close was called
+var ErrClientClosed = errors.New("client is closed")
+
+// ConnectionState is the state of a Client
+type ConnectionState int
+
+const (
+	// StateConnecting is the state until the first successful ping
+	StateConnecting ConnectionState = iota
+	// StateConnected means at least one data-bearing server is reachable
+	StateConnected
+	// StateDisconnected means no data-bearing server is reachable, the driver keeps reconnecting
+	StateDisconnected
+	// StateClosing is the state while Close drains in-flight operations
+	StateClosing
+	// StateClosed is the final state
+	StateClosed
+)
 
-	// Configure the MongoDB API version.
-	if strings.Contains(uri, connstring.SchemeMongoDBSRV) {
-		opts.SetServerAPIOptions(options.ServerAPI(options.ServerAPIVersion1))
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
 	}
+	return "unknown"
+}
+
+// ClientOptions configures a Client
+type ClientOptions struct {
+	// Options are the driver options, the URI and configuration are applied on top of them
+	Options *options.ClientOptions
+	// OnStateChange is called after every connection state transition
+	OnStateChange func(from, to ConnectionState)
+}
+
+// Client owns a driver client and its lifecycle. Databases and repositories created
+// from it share its connection pool.
+type Client struct {
+	client *mongo.Client
+	opts   ClientOptions
+
+	mu         sync.Mutex
+	state      ConnectionState
+	operations int64
+
+	inFlight atomic.Int64
+}
+
+// NewClient connects to the deployment and pings it. mongodb+srv:// URIs declare Stable API version 1.
+// Use NewClientFromConfig to configure the connection beyond the URI.
+func NewClient(ctx context.Context, uri string, opts ...ClientOptions) (*Client, error) {
+	return NewClientFromConfig(ctx, uriConfig(uri), opts...)
+}
+
+// uriConfig returns the configuration of a URI, declaring Stable API version 1 for
+// mongodb+srv:// URIs like Connect always did
+func uriConfig(uri string) *Config {
+	config := &Config{URI: uri}
+	if strings.HasPrefix(uri, connstring.SchemeMongoDBSRV+"://") {
+		config.StableAPI = string(options.ServerAPIVersion1)
+	}
+	return config
+}
 
-	// Create and initialize the MongoDB client.
-	client, err := mongo.Connect(opts)
+// connect creates the driver client with monitors tracking the state and in-flight commands.
+// The options must be a copy owned by the client, their monitors are replaced.
+func (c *Client) connect(ctx context.Context, clientOpts *options.ClientOptions) error {
+	clientOpts.SetMonitor(c.commandMonitor(clientOpts.Monitor))
+	clientOpts.SetServerMonitor(c.serverMonitor(clientOpts.ServerMonitor))
 
+	client, err := mongo.Connect(clientOpts)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	c.client = client
+
+	if err = client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.WithoutCancel(ctx))
+		c.setState(StateClosed)
+		return fmt.Errorf("failed to ping: %w", err)
+	}
+	c.setState(StateConnected)
+	return nil
+}
+
+// Driver returns the underlying driver client
+func (c *Client) Driver() *mongo.Client {
+	return c.client
+}
+
+// Database returns a handle of the database
+func (c *Client) Database(name string, opts ...options.Lister[options.DatabaseOptions]) *mongo.Database {
+	return c.client.Database(name, opts...)
+}
+
+// ClientRepository creates a repository of the collection in the database of the client
+func ClientRepository[T any](c *Client, database, collection string) *Repository[T] {
+	return NewRepository[T](c.client.Database(database).Collection(collection))
+}
+
+// Ping checks that the primary is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("failed to ping: %w", err)
+	}
+	return nil
+}
+
+// State returns the connection state
+func (c *Client) State() ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// InFlight returns the number of commands waiting for a server reply
+func (c *Client) InFlight() int64 {
+	return c.inFlight.Load()
+}
+
+// Do runs fn as one operation that Close waits for, it returns ErrClientClosed once Close was called.
+// Use it for work spanning several commands, like iterating a cursor or running a transaction.
+func (c *Client) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	c.mu.Lock()
+	if c.state == StateClosing || c.state == StateClosed {
+		c.mu.Unlock()
+		return ErrClientClosed
 	}
+	c.operations++
+	c.mu.Unlock()
 
-	// Check the MongoDB client connection.
-	err = client.Ping(ctx, nil)
+	defer func() {
+		c.mu.Lock()
+		c.operations--
+		c.mu.Unlock()
+	}()
+	return fn(ctx)
+}
 
+// busy reports whether operations run through Do or commands are in flight
+func (c *Client) busy() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.operations > 0 || c.inFlight.Load() > 0
+}
+
+// Close waits for the operations run through Do and the in-flight commands to finish,
+// until the context is done, and disconnects. Operations started otherwise are not rejected
+// until the client is disconnected, and cursors, change streams and transactions are only
+// waited for while a command of theirs is in flight: run them through Do or end them first.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	from := c.state
+	if from == StateClosing || from == StateClosed {
+		c.mu.Unlock()
+		return ErrClientClosed
+	}
+	c.state = StateClosing
+	c.mu.Unlock()
+	c.notify(from, StateClosing)
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for c.busy() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// Disconnect waits for checked-out connections until its context is done.
+	err := c.client.Disconnect(ctx)
+	c.setState(StateClosed)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to disconnect: %w", err)
+	}
+	return nil
+}
+
+// setState changes the state and notifies about transitions. Closing and closed states are final.
+func (c *Client) setState(state ConnectionState) {
+	c.mu.Lock()
+	from := c.state
+	if from == state || from == StateClosed || (from == StateClosing && state != StateClosed) {
+		c.mu.Unlock()
+		return
 	}
+	c.state = state
+	c.mu.Unlock()
+	c.notify(from, state)
+}
 
+func (c *Client) notify(from, to ConnectionState) {
+	if c.opts.OnStateChange != nil {
+		c.opts.OnStateChange(from, to)
+	}
+}
+
+// commandMonitor counts in-flight commands, calling the user monitor too
+func (c *Client) commandMonitor(next *event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			c.inFlight.Add(1)
+			if next != nil && next.Started != nil {
+				next.Started(ctx, e)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			c.inFlight.Add(-1)
+			if next != nil && next.Succeeded != nil {
+				next.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			c.inFlight.Add(-1)
+			if next != nil && next.Failed != nil {
+				next.Failed(ctx, e)
+			}
+		},
+	}
+}
+
+// serverMonitor derives the connection state from topology changes, calling the user monitor too
+func (c *Client) serverMonitor(next *event.ServerMonitor) *event.ServerMonitor {
+	monitor := &event.ServerMonitor{}
+	if next != nil {
+		*monitor = *next
+	}
+	monitor.TopologyDescriptionChanged = func(e *event.TopologyDescriptionChangedEvent) {
+		if c.State() != StateConnecting {
+			if hasDataBearingServer(e.NewDescription) {
+				c.setState(StateConnected)
+			} else {
+				c.setState(StateDisconnected)
+			}
+		}
+		if next != nil && next.TopologyDescriptionChanged != nil {
+			next.TopologyDescriptionChanged(e)
+		}
+	}
+	return monitor
+}
+
+// hasDataBearingServer reports whether the topology has a server that can serve operations
+func hasDataBearingServer(topology event.TopologyDescription) bool {
+	for _, server := range topology.Servers {
+		switch server.Kind {
+		case "Standalone", "RSPrimary", "RSSecondary", "Mongos", "LoadBalancer":
+			return true
+		}
+	}
+	return false
+}
+
+// Connect returns a new instance of the Mongo database client.
+// Use NewClient to share the connection between databases or to disconnect.
+func Connect(ctx context.Context, uri string, databaseName string) (*mongo.Database, error) {
+	client, err := NewClient(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
 	return client.Database(databaseName), nil
 }
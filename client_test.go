@@ -0,0 +1,125 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestHasDataBearingServer(t *testing.T) {
+	tests := []struct {
+		name  string
+		kinds []string
+		want  bool
+	}{
+		{name: "no servers", kinds: nil, want: false},
+		{name: "unknown", kinds: []string{"Unknown"}, want: false},
+		{name: "arbiter and ghost", kinds: []string{"RSArbiter", "RSGhost", "RSOther"}, want: false},
+		{name: "standalone", kinds: []string{"Standalone"}, want: true},
+		{name: "secondary only", kinds: []string{"Unknown", "RSSecondary"}, want: true},
+		{name: "mongos", kinds: []string{"Mongos"}, want: true},
+		{name: "load balancer", kinds: []string{"LoadBalancer"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var topology event.TopologyDescription
+			for _, kind := range tt.kinds {
+				topology.Servers = append(topology.Servers, event.ServerDescription{Kind: kind})
+			}
+			if got := hasDataBearingServer(topology); got != tt.want {
+				t.Errorf("hasDataBearingServer(%v) = %v, want %v", tt.kinds, got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestClient(t *testing.T, onStateChange func(from, to ConnectionState)) *Client {
+	t.Helper()
+	driver, err := mongo.Connect(options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Client{client: driver, state: StateConnected, opts: ClientOptions{OnStateChange: onStateChange}}
+}
+
+func TestClientClose(t *testing.T) {
+	var transitions []ConnectionState
+	c := newTestClient(t, func(from, to ConnectionState) { transitions = append(transitions, to) })
+
+	started, finished := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- c.Do(context.Background(), func(ctx context.Context) error {
+			close(started)
+			time.Sleep(20 * time.Millisecond)
+			close(finished)
+			return nil
+		})
+	}()
+	<-started
+
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("Close() returned before the operation finished")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Do() = %v", err)
+	}
+
+	if err := c.Close(context.Background()); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("second Close() = %v, want ErrClientClosed", err)
+	}
+	if err := c.Do(context.Background(), func(ctx context.Context) error { return nil }); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Do() after Close = %v, want ErrClientClosed", err)
+	}
+	if len(transitions) != 2 || transitions[0] != StateClosing || transitions[1] != StateClosed {
+		t.Errorf("transitions = %v, want closing then closed", transitions)
+	}
+}
+
+func TestClientCloseOnce(t *testing.T) {
+	c := newTestClient(t, nil)
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() { errs <- c.Close(context.Background()) }()
+	}
+
+	closed := 0
+	for range cap(errs) {
+		if err := <-errs; err == nil {
+			closed++
+		} else if !errors.Is(err, ErrClientClosed) {
+			t.Errorf("Close() = %v", err)
+		}
+	}
+	if closed != 1 {
+		t.Errorf("%d Close calls succeeded, want 1", closed)
+	}
+}
+
+func TestNewClientFromConfigKeepsOptions(t *testing.T) {
+	monitor := &event.CommandMonitor{}
+	serverMonitor := &event.ServerMonitor{}
+	opts := options.Client().SetMonitor(monitor).SetServerMonitor(serverMonitor)
+
+	config := NewConfig(WithURI("mongodb://localhost:1"), WithAppName("test"), WithServerSelectionTimeout(10*time.Millisecond))
+	if _, err := NewClientFromConfig(context.Background(), config, ClientOptions{Options: opts}); err == nil {
+		t.Fatal("NewClientFromConfig() = nil, want a ping error")
+	}
+	if opts.Monitor != monitor || opts.ServerMonitor != serverMonitor {
+		t.Error("the caller's monitors were replaced")
+	}
+	if opts.AppName != nil || opts.ServerSelectionTimeout != nil {
+		t.Error("the configuration was applied to the caller's options")
+	}
+}
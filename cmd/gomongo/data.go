@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	mongoclient "github.com/inc4/gomongo-client"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func runExport(ctx context.Context, db *mongo.Database, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	filter := fs.String("filter", "{}", "filter as Extended JSON")
+	output := fs.String("o", "", "output file (default stdout)")
+	format := fs.String("format", string(mongoclient.FormatCanonicalJSONL), "jsonl, canonical or csv")
+	fields := fs.String("fields", "", "comma-separated fields, required for csv")
+	name, err := parseCollectionArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if mongoclient.DataFormat(*format) == mongoclient.FormatCSV && *fields == "" {
+		return errors.New("export: -fields is required for csv")
+	}
+
+	f, err := parseFilter(*filter)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	repo := mongoclient.NewRepository[*document](db.Collection(name))
+	count, err := repo.Export(ctx, w, f, mongoclient.DataFormat(*format), mongoclient.TransferOptions{
+		Columns: splitList(*fields),
+		Progress: func(processed int64) {
+			fmt.Fprintf(os.Stderr, "\rexported %d documents", processed)
+		},
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d documents from %s\n", count, name)
+	return nil
+}
+
+func runImport(ctx context.Context, db *mongo.Database, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	input := fs.String("i", "", "input file (default stdin)")
+	format := fs.String("format", string(mongoclient.FormatCanonicalJSONL), "jsonl, canonical or csv")
+	mode := fs.String("mode", string(mongoclient.ImportInsert), "insert, upsert or replace")
+	keys := fs.String("key", "_id", "comma-separated key fields for upsert and replace")
+	stopOnError := fs.Bool("stop-on-error", false, "abort on the first invalid line")
+	name, err := parseCollectionArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return fmt.Errorf("failed to open input file: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	repo := mongoclient.NewRepository[*document](db.Collection(name))
+	result, err := repo.Import(ctx, r, mongoclient.DataFormat(*format), mongoclient.ImportMode(*mode), mongoclient.TransferOptions{
+		KeyFields:   splitList(*keys),
+		StopOnError: *stopOnError,
+		Progress: func(processed int64) {
+			fmt.Fprintf(os.Stderr, "\rprocessed %d lines", processed)
+		},
+	})
+	fmt.Fprintln(os.Stderr)
+	if result != nil {
+		for _, lineErr := range result.Errors {
+			fmt.Fprintln(os.Stderr, lineErr)
+		}
+		fmt.Fprintf(os.Stderr, "processed %d, inserted %d, upserted %d, modified %d, failed %d\n",
+			result.Processed, result.Inserted, result.Upserted, result.Modified, result.Failed)
+	}
+	return err
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunExportRequiresCSVFields(t *testing.T) {
+	err := runExport(context.Background(), nil, []string{"users", "-format", "csv"})
+	if err == nil || !strings.Contains(err.Error(), "-fields is required") {
+		t.Errorf("runExport() = %v, want the missing -fields error", err)
+	}
+}
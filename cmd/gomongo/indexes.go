@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	mongoclient "github.com/inc4/gomongo-client"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// indexSpec is a single entry of the desired indexes file, e.g.
+//
+//	[{"key": {"email": 1}, "unique": true}, {"key": {"createdAt": 1}, "expireAfterSeconds": 3600}]
+type indexSpec struct {
+	Key                     bson.D `bson:"key"`
+	Name                    string `bson:"name,omitempty"`
+	Unique                  bool   `bson:"unique,omitempty"`
+	Sparse                  bool   `bson:"sparse,omitempty"`
+	ExpireAfterSeconds      *int32 `bson:"expireAfterSeconds,omitempty"`
+	PartialFilterExpression bson.D `bson:"partialFilterExpression,omitempty"`
+}
+
+func runIndexes(ctx context.Context, db *mongo.Database, args []string) error {
+	fs := flag.NewFlagSet("indexes", flag.ContinueOnError)
+	desired := fs.String("desired", "", "JSON file with the desired indexes; prints the sync plan")
+	apply := fs.Bool("apply", false, "apply the sync plan")
+	hidden := fs.Bool("hidden", false, "hide stale indexes instead of dropping them")
+	name, err := parseCollectionArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	repo := mongoclient.NewRepository[*document](db.Collection(name))
+
+	if *desired == "" {
+		indexes, err := repo.GetIndexes(ctx)
+		if err != nil {
+			return err
+		}
+		for _, idx := range indexes {
+			if err = printJSON(idx, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	models, err := loadIndexModels(*desired)
+	if err != nil {
+		return err
+	}
+
+	mode := mongoclient.IndexSyncDryRun
+	switch {
+	case *apply && *hidden:
+		mode = mongoclient.IndexSyncApplyHidden
+	case *apply:
+		mode = mongoclient.IndexSyncApply
+	}
+
+	// Dry runs print the plan themselves.
+	plan, err := repo.SyncIndexes(ctx, models, mode, mongoclient.IndexSyncOptions{Output: os.Stdout})
+	if plan != nil && mode != mongoclient.IndexSyncDryRun {
+		fmt.Print(plan)
+	}
+	return err
+}
+
+func loadIndexModels(path string) ([]mongo.IndexModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes file: %w", err)
+	}
+
+	// Extended JSON must be a document at the top level, so wrap the array.
+	var wrapper struct {
+		Indexes []indexSpec `bson:"indexes"`
+	}
+	if err = bson.UnmarshalExtJSON(append(append([]byte(`{"indexes":`), data...), '}'), false, &wrapper); err != nil {
+		return nil, fmt.Errorf("failed to parse indexes file: %w", err)
+	}
+
+	models := make([]mongo.IndexModel, len(wrapper.Indexes))
+	for i, spec := range wrapper.Indexes {
+		opts := options.Index()
+		if spec.Name != "" {
+			opts.SetName(spec.Name)
+		}
+		if spec.Unique {
+			opts.SetUnique(true)
+		}
+		if spec.Sparse {
+			opts.SetSparse(true)
+		}
+		if spec.ExpireAfterSeconds != nil {
+			opts.SetExpireAfterSeconds(*spec.ExpireAfterSeconds)
+		}
+		if spec.PartialFilterExpression != nil {
+			opts.SetPartialFilterExpression(spec.PartialFilterExpression)
+		}
+		models[i] = mongo.IndexModel{Keys: spec.Key, Options: opts}
+	}
+	return models, nil
+}
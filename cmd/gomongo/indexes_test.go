@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestLoadIndexModels(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		check   func(t *testing.T, opts []options.IndexOptions)
+		wantErr bool
+	}{
+		{name: "empty list", content: `[]`, check: func(t *testing.T, opts []options.IndexOptions) {}},
+		{
+			name: "options",
+			content: `[
+				{"key": {"email": 1}, "unique": true, "name": "email_unique"},
+				{"key": {"createdAt": 1}, "expireAfterSeconds": 3600, "sparse": true},
+				{"key": {"status": 1}, "partialFilterExpression": {"status": "active"}}
+			]`,
+			check: func(t *testing.T, opts []options.IndexOptions) {
+				if len(opts) != 3 {
+					t.Fatalf("got %d models, want 3", len(opts))
+				}
+				if opts[0].Unique == nil || !*opts[0].Unique || opts[0].Name == nil || *opts[0].Name != "email_unique" {
+					t.Errorf("model 0 options = %+v", opts[0])
+				}
+				if opts[1].ExpireAfterSeconds == nil || *opts[1].ExpireAfterSeconds != 3600 || opts[1].Sparse == nil || opts[1].Unique != nil {
+					t.Errorf("model 1 options = %+v", opts[1])
+				}
+				if opts[2].PartialFilterExpression == nil {
+					t.Errorf("model 2 options = %+v", opts[2])
+				}
+			},
+		},
+		{name: "not an array", content: `{"key": {"email": 1}}`, wantErr: true},
+		{name: "invalid json", content: `[{"key": }]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "indexes.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			models, err := loadIndexModels(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadIndexModels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			opts := make([]options.IndexOptions, len(models))
+			for i, model := range models {
+				if keys, _ := model.Keys.(bson.D); len(keys) == 0 {
+					t.Errorf("model %d has no keys", i)
+				}
+				for _, set := range model.Options.List() {
+					if err := set(&opts[i]); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			tt.check(t, opts)
+		})
+	}
+}
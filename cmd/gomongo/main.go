@@ -0,0 +1,269 @@
+// Command gomongo is an administration tool for databases used with gomongo-client.
+//
+// Connection settings are read from flags or the MONGO_URI and MONGO_DATABASE
+// environment variables:
+//
+//	gomongo [-uri URI] [-db NAME] [-timeout DURATION] <command> [arguments]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	mongoclient "github.com/inc4/gomongo-client"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const usage = `Usage: gomongo [flags] <command> [arguments]
+
+Commands:
+  ping                                  check the connection
+  collections                           list collections with stats
+  indexes <collection> [-desired FILE] [-apply] [-hidden]
+                                        show indexes, or diff them against a JSON file
+  migrate -dir DIR status|up [VERSION]|down [STEPS]
+                                        run JSON command migrations from a directory
+  export <collection> [-filter JSON] [-o FILE] [-format FORMAT] [-fields LIST]
+                                        export documents as JSON lines or CSV
+  import <collection> [-i FILE] [-format FORMAT] [-mode MODE] [-key LIST]
+                                        import JSON lines or CSV
+  explain <collection> -filter JSON [-verbosity MODE]
+                                        explain a find filter
+  tail <collection> [-full]             print change stream events
+
+Flags:
+`
+
+// document is a schemaless model used to run repository operations on any collection.
+// It keeps the fields in their stored order.
+type document struct {
+	Fields bson.D
+}
+
+func (d *document) UnmarshalBSON(data []byte) error {
+	return bson.Unmarshal(data, &d.Fields)
+}
+
+func (d *document) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(d.Fields)
+}
+
+type command func(ctx context.Context, db *mongo.Database, args []string) error
+
+var commands = map[string]command{
+	"ping":        runPing,
+	"collections": runCollections,
+	"indexes":     runIndexes,
+	"migrate":     runMigrate,
+	"export":      runExport,
+	"import":      runImport,
+	"explain":     runExplain,
+	"tail":        runTail,
+}
+
+func main() {
+	uri := flag.String("uri", envOr("MONGO_URI", "mongodb://localhost:27017"), "connection string (env MONGO_URI)")
+	database := flag.String("db", os.Getenv("MONGO_DATABASE"), "database name (env MONGO_DATABASE)")
+	timeout := flag.Duration("timeout", 10*time.Second, "connection timeout")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(cmd, *uri, *database, *timeout); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			// the command flag set has printed its usage already
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "gomongo:", err)
+		os.Exit(1)
+	}
+}
+
+// run connects and executes the command. It returns instead of exiting,
+// so the deferred disconnect always runs.
+func run(cmd command, uri, database string, timeout time.Duration) error {
+	if database == "" {
+		return errors.New("database name is required: set -db or MONGO_DATABASE")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	connectCtx, cancel := context.WithTimeout(ctx, timeout)
+	db, err := mongoclient.Connect(connectCtx, uri, database)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	return cmd(ctx, db, flag.Args()[1:])
+}
+
+func runPing(ctx context.Context, db *mongo.Database, _ []string) error {
+	if err := db.Client().Ping(ctx, nil); err != nil {
+		return fmt.Errorf("failed to ping: %w", err)
+	}
+	fmt.Printf("ok: connected to database %s\n", db.Name())
+	return nil
+}
+
+// runCollections lists the collections with their stats, views have no stats and are skipped
+func runCollections(ctx context.Context, db *mongo.Database, _ []string) error {
+	names, err := db.ListCollectionNames(ctx, bson.M{"type": "collection"})
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	fmt.Printf("%-40s %12s %14s %14s %8s\n", "COLLECTION", "DOCUMENTS", "SIZE", "INDEX SIZE", "INDEXES")
+	for _, name := range names {
+		stats, err := collectionStats(ctx, db.Collection(name))
+		if err != nil {
+			// some system collections refuse $collStats, the others are still listed
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		fmt.Printf("%-40s %12d %14d %14d %8d\n", name, stats.Count, stats.Size, stats.TotalIndexSize, stats.IndexCount)
+	}
+	return nil
+}
+
+type storageStats struct {
+	Count          int64 `bson:"count"`
+	Size           int64 `bson:"size"`
+	TotalIndexSize int64 `bson:"totalIndexSize"`
+	IndexCount     int64 `bson:"nindexes"`
+}
+
+func collectionStats(ctx context.Context, col *mongo.Collection) (storageStats, error) {
+	repo := mongoclient.NewRepository[*document](col)
+
+	var results []struct {
+		StorageStats storageStats `bson:"storageStats"`
+	}
+	pipeline := bson.A{bson.M{"$collStats": bson.M{"storageStats": bson.M{}}}}
+	if err := repo.AggregateWithTypedResult(ctx, &results, pipeline); err != nil {
+		return storageStats{}, fmt.Errorf("failed to get stats for %s: %w", col.Name(), err)
+	}
+	if len(results) == 0 {
+		return storageStats{}, nil
+	}
+	return results[0].StorageStats, nil
+}
+
+func runExplain(ctx context.Context, db *mongo.Database, args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	filter := fs.String("filter", "{}", "filter as Extended JSON")
+	verbosity := fs.String("verbosity", "queryPlanner", "queryPlanner, executionStats or allPlansExecution")
+	name, err := parseCollectionArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	f, err := parseFilter(*filter)
+	if err != nil {
+		return err
+	}
+
+	cmd := bson.D{
+		{Key: "explain", Value: bson.D{{Key: "find", Value: name}, {Key: "filter", Value: f}}},
+		{Key: "verbosity", Value: *verbosity},
+	}
+	var result bson.M
+	if err = db.RunCommand(ctx, cmd).Decode(&result); err != nil {
+		return fmt.Errorf("failed to explain: %w", err)
+	}
+	return printJSON(result, true)
+}
+
+func runTail(ctx context.Context, db *mongo.Database, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	full := fs.Bool("full", false, "print full change events instead of the operation type and document key")
+	name, err := parseCollectionArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	repo := mongoclient.NewRepository[*document](db.Collection(name))
+	stream, err := repo.WatchTyped(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		if *full {
+			if err = printJSON(stream.Raw(), false); err != nil {
+				return err
+			}
+			continue
+		}
+		event := stream.Event()
+		key, _ := bson.MarshalExtJSON(event.DocumentKey, false, false)
+		fmt.Printf("%s %s\n", event.OperationType, key)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return stream.Err()
+}
+
+func parseCollectionArgs(fs *flag.FlagSet, args []string) (string, error) {
+	if len(args) == 0 || args[0] == "" || args[0][0] == '-' {
+		return "", fmt.Errorf("%s: collection name is required", fs.Name())
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return "", err
+	}
+	return args[0], nil
+}
+
+func parseFilter(s string) (bson.D, error) {
+	var filter bson.D
+	if err := bson.UnmarshalExtJSON([]byte(s), false, &filter); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return filter, nil
+}
+
+func printJSON(v any, indent bool) error {
+	var (
+		data []byte
+		err  error
+	)
+	if indent {
+		data, err = bson.MarshalExtJSONIndent(v, false, false, "", "  ")
+	} else {
+		data, err = bson.MarshalExtJSON(v, false, false)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
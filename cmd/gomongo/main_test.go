@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestParseCollectionArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		collection string
+		limit      int64
+		wantErr    bool
+	}{
+		{name: "collection only", args: []string{"users"}, collection: "users", limit: 10},
+		{name: "collection and flags", args: []string{"users", "-limit", "5"}, collection: "users", limit: 5},
+		{name: "no arguments", args: nil, wantErr: true},
+		{name: "empty collection", args: []string{""}, wantErr: true},
+		{name: "flag first", args: []string{"-limit", "5", "users"}, wantErr: true},
+		{name: "unknown flag", args: []string{"users", "-bogus"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("find", flag.ContinueOnError)
+			fs.SetOutput(discard{})
+			limit := fs.Int64("limit", 10, "")
+
+			collection, err := parseCollectionArgs(fs, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCollectionArgs(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if err == nil && (collection != tt.collection || *limit != tt.limit) {
+				t.Errorf("parseCollectionArgs(%q) = %q with limit %d, want %q with %d", tt.args, collection, *limit, tt.collection, tt.limit)
+			}
+		})
+	}
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		want    bson.D
+		wantErr bool
+	}{
+		{name: "empty document", filter: `{}`, want: bson.D{}},
+		{name: "keys keep their order", filter: `{"b": 1, "a": "x"}`, want: bson.D{{Key: "b", Value: int32(1)}, {Key: "a", Value: "x"}}},
+		{
+			name:   "extended json",
+			filter: `{"_id": {"$oid": "5f1e0b9a8f1b2c3d4e5f6a7b"}}`,
+			want:   bson.D{{Key: "_id", Value: mustObjectID(t, "5f1e0b9a8f1b2c3d4e5f6a7b")}},
+		},
+		{name: "not json", filter: `name=alice`, wantErr: true},
+		{name: "array", filter: `[1, 2]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFilter(tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFilter(%s) error = %v, wantErr %v", tt.filter, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want, _ := bson.Marshal(tt.want)
+			have, _ := bson.Marshal(got)
+			if !slices.Equal(want, have) {
+				t.Errorf("parseFilter(%s) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func mustObjectID(t *testing.T, hex string) bson.ObjectID {
+	t.Helper()
+	id, err := bson.ObjectIDFromHex(hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "", want: nil},
+		{in: "name", want: []string{"name"}},
+		{in: "name, email ,age", want: []string{"name", "email", "age"}},
+	}
+	for _, tt := range tests {
+		if got := splitList(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("splitList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	mongoclient "github.com/inc4/gomongo-client"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// runMigrate runs migrations stored as JSON files in a directory.
+// Each migration is a pair of files named <version>_<description>.up.json and
+// <version>_<description>.down.json holding an array of database commands, e.g.
+//
+//	[{"update": "users", "updates": [{"q": {}, "u": {"$set": {"status": "active"}}, "multi": true}]}]
+func runMigrate(ctx context.Context, db *mongo.Database, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := fs.String("dir", "migrations", "directory with migration files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("migrate: expected status, up or down")
+	}
+
+	migrations, err := loadMigrations(*dir)
+	if err != nil {
+		return err
+	}
+	migrator := mongoclient.NewMigrator(db, migrations...)
+
+	switch fs.Arg(0) {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%6d  %-40s %s\n", s.Version, s.Description, state)
+		}
+		return nil
+	case "up":
+		var to int64
+		if fs.NArg() > 1 {
+			if to, err = strconv.ParseInt(fs.Arg(1), 10, 64); err != nil {
+				return fmt.Errorf("invalid version: %w", err)
+			}
+		}
+		applied, err := migrator.Up(ctx, to)
+		for _, v := range applied {
+			fmt.Printf("applied %d\n", v)
+		}
+		return err
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			if steps, err = strconv.Atoi(fs.Arg(1)); err != nil {
+				return fmt.Errorf("invalid steps: %w", err)
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, v := range reverted {
+			fmt.Printf("reverted %d\n", v)
+		}
+		return err
+	default:
+		return fmt.Errorf("migrate: unknown subcommand %q", fs.Arg(0))
+	}
+}
+
+func loadMigrations(dir string) ([]mongoclient.Migration, error) {
+	upFiles, err := filepath.Glob(filepath.Join(dir, "*.up.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	migrations := make([]mongoclient.Migration, 0, len(upFiles))
+	byVersion := make(map[int64]string, len(upFiles))
+	for _, upFile := range upFiles {
+		base := strings.TrimSuffix(filepath.Base(upFile), ".up.json")
+		versionStr, description, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %s: %w", upFile, err)
+		}
+		if other, ok := byVersion[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, upFile)
+		}
+		byVersion[version] = upFile
+
+		up, err := loadCommands(upFile)
+		if err != nil {
+			return nil, err
+		}
+		mig := mongoclient.Migration{
+			Version:     version,
+			Description: strings.ReplaceAll(description, "_", " "),
+			Up:          runCommands(up),
+		}
+
+		downFile := filepath.Join(dir, base+".down.json")
+		if _, err = os.Stat(downFile); err == nil {
+			down, err := loadCommands(downFile)
+			if err != nil {
+				return nil, err
+			}
+			mig.Down = runCommands(down)
+		}
+		migrations = append(migrations, mig)
+	}
+	return migrations, nil
+}
+
+func loadCommands(path string) ([]bson.D, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration: %w", err)
+	}
+
+	var wrapper struct {
+		Commands []bson.D `bson:"commands"`
+	}
+	if err = bson.UnmarshalExtJSON(append(append([]byte(`{"commands":`), data...), '}'), false, &wrapper); err != nil {
+		return nil, fmt.Errorf("failed to parse migration %s: %w", path, err)
+	}
+	for i, cmd := range wrapper.Commands {
+		if len(cmd) == 0 {
+			return nil, fmt.Errorf("migration %s: command %d is empty", path, i+1)
+		}
+	}
+	return wrapper.Commands, nil
+}
+
+func runCommands(commands []bson.D) mongoclient.MigrationFunc {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, cmd := range commands {
+			if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+				return fmt.Errorf("failed to run command %s: %w", cmd[0].Key, err)
+			}
+		}
+		return nil
+	}
+}
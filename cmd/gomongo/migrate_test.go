@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        map[string]string
+		descriptions []string
+		withDown     []bool
+		wantErr      bool
+	}{
+		{name: "empty directory", files: nil},
+		{
+			name: "up and down files",
+			files: map[string]string{
+				"1_create_users.up.json":   `[{"create": "users"}]`,
+				"1_create_users.down.json": `[{"drop": "users"}]`,
+				"2_add_index.up.json":      `[{"createIndexes": "users", "indexes": [{"key": {"email": 1}, "name": "email_1"}]}]`,
+				"notes.txt":                "ignored",
+			},
+			descriptions: []string{"create users", "add index"},
+			withDown:     []bool{true, false},
+		},
+		{name: "bad version", files: map[string]string{"first.up.json": `[]`}, wantErr: true},
+		{name: "bad json", files: map[string]string{"1_x.up.json": `{"create": "users"}`}, wantErr: true},
+		{name: "bad down file", files: map[string]string{"1_x.up.json": `[]`, "1_x.down.json": `[`}, wantErr: true},
+		{name: "duplicate version", files: map[string]string{"1_a.up.json": `[]`, "01_b.up.json": `[]`}, wantErr: true},
+		{name: "empty command", files: map[string]string{"1_x.up.json": `[{"create": "users"}, {}]`}, wantErr: true},
+		{name: "empty down command", files: map[string]string{"1_x.up.json": `[]`, "1_x.down.json": `[{}]`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			migrations, err := loadMigrations(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadMigrations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(migrations) != len(tt.descriptions) {
+				t.Fatalf("loaded %d migrations, want %d", len(migrations), len(tt.descriptions))
+			}
+			for i, mig := range migrations {
+				if mig.Version != int64(i+1) || mig.Description != tt.descriptions[i] || mig.Up == nil || (mig.Down != nil) != tt.withDown[i] {
+					t.Errorf("migration %d = %+v", i, mig)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1_x.up.json")
+	if err := os.WriteFile(path, []byte(`[{"create": "users", "capped": false}, {"drop": "tmp"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	commands, err := loadCommands(path)
+	if err != nil {
+		t.Fatalf("loadCommands() = %v", err)
+	}
+	if len(commands) != 2 || commands[0][0].Key != "create" || commands[0][1].Key != "capped" || commands[1][0].Key != "drop" {
+		t.Errorf("loadCommands() = %v, want the commands with their keys in order", commands)
+	}
+}
@@ -18,7 +18,7 @@ func (r *Repository[T]) Collection() *mongo.Collection {
 func (r *Repository[T]) EstimatedCount(ctx context.Context, opts ...options.Lister[options.EstimatedDocumentCountOptions]) (int64, error) {
 	count, err := r.collection.EstimatedDocumentCount(ctx, opts...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to count documents: %w", err)
+		return 0, r.classifyError("EstimatedCount", nil, fmt.Errorf("failed to count documents: %w", err))
 	}
 	return count, nil
 }
@@ -27,7 +27,7 @@ func (r *Repository[T]) EstimatedCount(ctx context.Context, opts ...options.List
 func (r *Repository[T]) CountDocuments(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
 	count, err := r.collection.CountDocuments(ctx, filter, opts...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to count documents: %w", err)
+		return 0, r.classifyError("CountDocuments", filter, fmt.Errorf("failed to count documents: %w", err))
 	}
 	return count, nil
 }
@@ -36,13 +36,13 @@ func (r *Repository[T]) CountDocuments(ctx context.Context, filter any, opts ...
 func (r *Repository[T]) Aggregate(ctx context.Context, pipeline any, opts ...options.Lister[options.AggregateOptions]) ([]bson.M, error) {
 	cursor, err := r.collection.Aggregate(ctx, pipeline, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute aggregate: %w", err)
+		return nil, r.classifyError("Aggregate", pipeline, fmt.Errorf("failed to execute aggregate: %w", err))
 	}
 	defer cursor.Close(ctx)
 
 	var results []bson.M
 	if err = cursor.All(ctx, &results); err != nil {
-		return nil, fmt.Errorf("failed to decode aggregate results: %w", err)
+		return nil, r.classifyError("Aggregate", pipeline, fmt.Errorf("failed to decode aggregate results: %w", err))
 	}
 	return results, nil
 }
@@ -53,12 +53,12 @@ func (r *Repository[T]) AggregateWithTypedResult(ctx context.Context, result any
 	}
 	cursor, err := r.collection.Aggregate(ctx, pipeline, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to execute aggregate: %w", err)
+		return r.classifyError("Aggregate", pipeline, fmt.Errorf("failed to execute aggregate: %w", err))
 	}
 	defer cursor.Close(ctx)
 
 	if err = cursor.All(ctx, result); err != nil {
-		return fmt.Errorf("failed to decode aggregate results: %w", err)
+		return r.classifyError("Aggregate", pipeline, fmt.Errorf("failed to decode aggregate results: %w", err))
 	}
 	return nil
 }
@@ -67,13 +67,13 @@ func (r *Repository[T]) AggregateWithTypedResult(ctx context.Context, result any
 func (r *Repository[T]) AggregateTyped(ctx context.Context, pipeline any, opts ...options.Lister[options.AggregateOptions]) ([]T, error) {
 	cursor, err := r.collection.Aggregate(ctx, pipeline, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute aggregate: %w", err)
+		return nil, r.classifyError("Aggregate", pipeline, fmt.Errorf("failed to execute aggregate: %w", err))
 	}
 	defer cursor.Close(ctx)
 
 	var results []T
 	if err = cursor.All(ctx, &results); err != nil {
-		return nil, fmt.Errorf("failed to decode aggregate results: %w", err)
+		return nil, r.classifyError("Aggregate", pipeline, fmt.Errorf("failed to decode aggregate results: %w", err))
 	}
 	return results, nil
 }
@@ -83,7 +83,7 @@ func (r *Repository[T]) Distinct(ctx context.Context, fieldName string, filter a
 	var arr []any
 	err := r.collection.Distinct(ctx, fieldName, filter, opts...).Decode(&arr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find distinct values: %w", err)
+		return nil, r.classifyError("Distinct", filter, fmt.Errorf("failed to find distinct values: %w", err))
 	}
 	return arr, nil
 }
@@ -92,7 +92,7 @@ func (r *Repository[T]) Distinct(ctx context.Context, fieldName string, filter a
 func (r *Repository[T]) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...options.Lister[options.BulkWriteOptions]) (*mongo.BulkWriteResult, error) {
 	result, err := r.collection.BulkWrite(ctx, models, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to perform bulk write: %w", err)
+		return nil, r.classifyError("BulkWrite", nil, fmt.Errorf("failed to perform bulk write: %w", err))
 	}
 	return result, nil
 }
@@ -101,7 +101,7 @@ func (r *Repository[T]) BulkWrite(ctx context.Context, models []mongo.WriteModel
 func (r *Repository[T]) Watch(ctx context.Context, pipeline any, opts ...options.Lister[options.ChangeStreamOptions]) (*mongo.ChangeStream, error) {
 	stream, err := r.collection.Watch(ctx, pipeline, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create change stream: %w", err)
+		return nil, r.classifyError("Watch", nil, fmt.Errorf("failed to create change stream: %w", err))
 	}
 	return stream, nil
 }
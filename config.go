@@ -0,0 +1,616 @@
+package mongoclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables read by LoadEnv
+const DefaultEnvPrefix = "MONGO_"
+
+const redacted = "****"
+
+// Duration is a time.Duration written as "5s" or "1m30s" in files and environment variables
+type Duration time.Duration
+
+// UnmarshalText parses a duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText formats the duration
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// TLSConfig configures TLS with certificate files
+type TLSConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled" env:"ENABLED"`
+	// CAFile verifies the server certificates, the system roots by default
+	CAFile string `yaml:"caFile" json:"caFile" env:"CA_FILE"`
+	// CertFile and KeyFile are the client certificate, KeyFile may be omitted if CertFile holds both
+	CertFile           string `yaml:"certFile" json:"certFile" env:"CERT_FILE"`
+	KeyFile            string `yaml:"keyFile" json:"keyFile" env:"KEY_FILE"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" json:"insecureSkipVerify" env:"INSECURE_SKIP_VERIFY"`
+}
+
+// Config is the connection configuration. Settings left empty keep the values of the URI,
+// then the driver defaults. It can be loaded from files, environment variables and options,
+// which can be layered: e.g. LoadConfigFile, then LoadEnv, then Apply.
+type Config struct {
+	URI      string `yaml:"uri" json:"uri" env:"URI"`
+	Database string `yaml:"database" json:"database" env:"DATABASE"`
+	AppName  string `yaml:"appName" json:"appName" env:"APP_NAME"`
+
+	Username      string `yaml:"username" json:"username" env:"USERNAME"`
+	Password      string `yaml:"password" json:"password" env:"PASSWORD"`
+	AuthMechanism string `yaml:"authMechanism" json:"authMechanism" env:"AUTH_MECHANISM"`
+	AuthSource    string `yaml:"authSource" json:"authSource" env:"AUTH_SOURCE"`
+
+	MinPoolSize     uint64   `yaml:"minPoolSize" json:"minPoolSize" env:"MIN_POOL_SIZE"`
+	MaxPoolSize     uint64   `yaml:"maxPoolSize" json:"maxPoolSize" env:"MAX_POOL_SIZE"`
+	MaxConnecting   uint64   `yaml:"maxConnecting" json:"maxConnecting" env:"MAX_CONNECTING"`
+	MaxConnIdleTime Duration `yaml:"maxConnIdleTime" json:"maxConnIdleTime" env:"MAX_CONN_IDLE_TIME"`
+
+	ConnectTimeout         Duration `yaml:"connectTimeout" json:"connectTimeout" env:"CONNECT_TIMEOUT"`
+	ServerSelectionTimeout Duration `yaml:"serverSelectionTimeout" json:"serverSelectionTimeout" env:"SERVER_SELECTION_TIMEOUT"`
+	// Timeout is the default timeout of operations
+	Timeout           Duration `yaml:"timeout" json:"timeout" env:"TIMEOUT"`
+	HeartbeatInterval Duration `yaml:"heartbeatInterval" json:"heartbeatInterval" env:"HEARTBEAT_INTERVAL"`
+
+	TLS TLSConfig `yaml:"tls" json:"tls" env:"TLS_"`
+
+	// Compressors are tried in order: snappy, zlib, zstd
+	Compressors []string `yaml:"compressors" json:"compressors" env:"COMPRESSORS"`
+
+	// ReadConcern is local, majority, available, linearizable or snapshot
+	ReadConcern string `yaml:"readConcern" json:"readConcern" env:"READ_CONCERN"`
+	// ReadPreference is primary, primaryPreferred, secondary, secondaryPreferred or nearest
+	ReadPreference string `yaml:"readPreference" json:"readPreference" env:"READ_PREFERENCE"`
+	// WriteConcern is "majority", a number of nodes or a tag set name
+	WriteConcern string `yaml:"writeConcern" json:"writeConcern" env:"WRITE_CONCERN"`
+	Journal      *bool  `yaml:"journal" json:"journal" env:"JOURNAL"`
+
+	// StableAPI is the Stable API version to declare, "1" or empty
+	StableAPI                  string `yaml:"stableAPI" json:"stableAPI" env:"STABLE_API"`
+	StableAPIStrict            bool   `yaml:"stableAPIStrict" json:"stableAPIStrict" env:"STABLE_API_STRICT"`
+	StableAPIDeprecationErrors bool   `yaml:"stableAPIDeprecationErrors" json:"stableAPIDeprecationErrors" env:"STABLE_API_DEPRECATION_ERRORS"`
+	DirectConnection           *bool  `yaml:"directConnection" json:"directConnection" env:"DIRECT_CONNECTION"`
+	ReplicaSet                 string `yaml:"replicaSet" json:"replicaSet" env:"REPLICA_SET"`
+	RetryWrites                *bool  `yaml:"retryWrites" json:"retryWrites" env:"RETRY_WRITES"`
+	RetryReads                 *bool  `yaml:"retryReads" json:"retryReads" env:"RETRY_READS"`
+}
+
+// ConfigOption sets configuration fields
+type ConfigOption func(c *Config)
+
+// NewConfig creates a configuration from options
+func NewConfig(opts ...ConfigOption) *Config {
+	return (&Config{}).Apply(opts...)
+}
+
+// Apply sets the options on the configuration
+func (c *Config) Apply(opts ...ConfigOption) *Config {
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func WithURI(uri string) ConfigOption { return func(c *Config) { c.URI = uri } }
+
+func WithDatabase(name string) ConfigOption { return func(c *Config) { c.Database = name } }
+
+func WithAppName(name string) ConfigOption { return func(c *Config) { c.AppName = name } }
+
+// WithCredentials sets the user and the auth mechanism, an empty mechanism lets the server choose
+func WithCredentials(username, password, mechanism, source string) ConfigOption {
+	return func(c *Config) {
+		c.Username, c.Password, c.AuthMechanism, c.AuthSource = username, password, mechanism, source
+	}
+}
+
+func WithPoolSize(minSize, maxSize uint64) ConfigOption {
+	return func(c *Config) { c.MinPoolSize, c.MaxPoolSize = minSize, maxSize }
+}
+
+func WithTimeout(d time.Duration) ConfigOption { return func(c *Config) { c.Timeout = Duration(d) } }
+
+func WithConnectTimeout(d time.Duration) ConfigOption {
+	return func(c *Config) { c.ConnectTimeout = Duration(d) }
+}
+
+func WithServerSelectionTimeout(d time.Duration) ConfigOption {
+	return func(c *Config) { c.ServerSelectionTimeout = Duration(d) }
+}
+
+// WithTLSFiles enables TLS with the CA and client certificate files, empty names are skipped
+func WithTLSFiles(caFile, certFile, keyFile string) ConfigOption {
+	return func(c *Config) {
+		c.TLS = TLSConfig{Enabled: true, CAFile: caFile, CertFile: certFile, KeyFile: keyFile}
+	}
+}
+
+func WithCompressors(compressors ...string) ConfigOption {
+	return func(c *Config) { c.Compressors = compressors }
+}
+
+func WithReadConcern(level string) ConfigOption { return func(c *Config) { c.ReadConcern = level } }
+
+func WithReadPreference(mode string) ConfigOption { return func(c *Config) { c.ReadPreference = mode } }
+
+func WithWriteConcern(w string, journal bool) ConfigOption {
+	return func(c *Config) { c.WriteConcern, c.Journal = w, &journal }
+}
+
+// WithStableAPI declares Stable API version 1, strict rejects commands outside of it
+func WithStableAPI(strict bool) ConfigOption {
+	return func(c *Config) { c.StableAPI, c.StableAPIStrict = "1", strict }
+}
+
+func WithDirectConnection(direct bool) ConfigOption {
+	return func(c *Config) { c.DirectConnection = &direct }
+}
+
+// LoadConfigFile reads a YAML (.yaml, .yml) or JSON (.json) configuration file
+func LoadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	c := &Config{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".json":
+		err = json.Unmarshal(data, c)
+	default:
+		return nil, fmt.Errorf("unsupported config format %q: use .yaml, .yml or .json", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// ConfigFromEnv creates a configuration from environment variables with the prefix, MONGO_ if empty
+func ConfigFromEnv(prefix string) (*Config, error) {
+	c := &Config{}
+	if err := c.LoadEnv(prefix); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadEnv overrides the configuration with the set environment variables with the prefix,
+// MONGO_ if empty. Variables are named after the env tags, e.g. MONGO_MAX_POOL_SIZE or MONGO_TLS_CA_FILE;
+// lists are comma separated.
+func (c *Config) LoadEnv(prefix string) error {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	return loadEnv(reflect.ValueOf(c).Elem(), prefix)
+}
+
+// loadEnv sets the fields of the struct from the variables named after their env tags
+func loadEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, tag := v.Field(i), t.Field(i).Tag.Get("env")
+		if tag == "" {
+			continue
+		}
+		if field.Kind() == reflect.Struct {
+			if err := loadEnv(field, prefix+tag); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := prefix + tag
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvField(field, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setEnvField parses the variable value into the field
+func setEnvField(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setEnvField(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+var (
+	authMechanisms  = []string{"SCRAM-SHA-1", "SCRAM-SHA-256", "MONGODB-X509", "MONGODB-AWS", "MONGODB-OIDC", "GSSAPI", "PLAIN"}
+	compressorNames = []string{"snappy", "zlib", "zstd"}
+	readConcerns    = []string{"local", "majority", "available", "linearizable", "snapshot"}
+)
+
+// Validate checks the configuration and returns all problems found
+func (c *Config) Validate() error {
+	var errs []error
+	if c.URI == "" {
+		errs = append(errs, errors.New("uri is required"))
+	} else if !strings.HasPrefix(c.URI, "mongodb://") && !strings.HasPrefix(c.URI, "mongodb+srv://") {
+		errs = append(errs, errors.New("uri must start with mongodb:// or mongodb+srv://"))
+	}
+
+	if c.Password != "" && c.Username == "" {
+		errs = append(errs, errors.New("password is set without username"))
+	}
+	if c.AuthMechanism != "" && !slices.Contains(authMechanisms, c.AuthMechanism) {
+		errs = append(errs, fmt.Errorf("authMechanism %q is not one of %s", c.AuthMechanism, strings.Join(authMechanisms, ", ")))
+	}
+
+	if c.MaxPoolSize != 0 && c.MinPoolSize > c.MaxPoolSize {
+		errs = append(errs, fmt.Errorf("minPoolSize (%d) must not exceed maxPoolSize (%d)", c.MinPoolSize, c.MaxPoolSize))
+	}
+	durations := []struct {
+		name  string
+		value Duration
+	}{
+		{"maxConnIdleTime", c.MaxConnIdleTime},
+		{"connectTimeout", c.ConnectTimeout},
+		{"serverSelectionTimeout", c.ServerSelectionTimeout},
+		{"timeout", c.Timeout},
+		{"heartbeatInterval", c.HeartbeatInterval},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", d.name))
+		}
+	}
+
+	if !c.TLS.Enabled && (c.TLS.CAFile != "" || c.TLS.CertFile != "" || c.TLS.KeyFile != "") {
+		errs = append(errs, errors.New("tls files are set but tls is not enabled"))
+	}
+	if c.TLS.KeyFile != "" && c.TLS.CertFile == "" {
+		errs = append(errs, errors.New("tls.keyFile requires tls.certFile"))
+	}
+	for _, file := range [][2]string{{"tls.caFile", c.TLS.CAFile}, {"tls.certFile", c.TLS.CertFile}, {"tls.keyFile", c.TLS.KeyFile}} {
+		if file[1] == "" {
+			continue
+		}
+		if _, err := os.Stat(file[1]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file[0], err))
+		}
+	}
+
+	for _, compressor := range c.Compressors {
+		if !slices.Contains(compressorNames, compressor) {
+			errs = append(errs, fmt.Errorf("compressor %q is not one of %s", compressor, strings.Join(compressorNames, ", ")))
+		}
+	}
+	if c.ReadConcern != "" && !slices.Contains(readConcerns, c.ReadConcern) {
+		errs = append(errs, fmt.Errorf("readConcern %q is not one of %s", c.ReadConcern, strings.Join(readConcerns, ", ")))
+	}
+	if c.ReadPreference != "" {
+		if _, err := readpref.ModeFromString(c.ReadPreference); err != nil {
+			errs = append(errs, fmt.Errorf("readPreference %q is invalid", c.ReadPreference))
+		}
+	}
+	if n, err := strconv.Atoi(c.WriteConcern); err == nil && n < 0 {
+		errs = append(errs, errors.New("writeConcern must not be negative"))
+	}
+
+	if c.StableAPI != "" && c.StableAPI != string(options.ServerAPIVersion1) {
+		errs = append(errs, fmt.Errorf("stableAPI %q is not supported, use %q", c.StableAPI, options.ServerAPIVersion1))
+	}
+	if c.StableAPI == "" && (c.StableAPIStrict || c.StableAPIDeprecationErrors) {
+		errs = append(errs, errors.New("stableAPIStrict and stableAPIDeprecationErrors require stableAPI"))
+	}
+	if c.DirectConnection != nil && *c.DirectConnection && strings.HasPrefix(c.URI, "mongodb+srv://") {
+		errs = append(errs, errors.New("directConnection can't be used with mongodb+srv:// URIs"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid mongo config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// ClientOptions validates the configuration and builds the driver options
+func (c *Config) ClientOptions() (*options.ClientOptions, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	opts := options.Client()
+	if err := c.apply(opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// apply sets the configured settings on the driver options, after the URI
+func (c *Config) apply(opts *options.ClientOptions) error {
+	opts.ApplyURI(c.URI)
+
+	if c.AppName != "" {
+		opts.SetAppName(c.AppName)
+	}
+	if c.Username != "" || c.AuthMechanism != "" || c.AuthSource != "" {
+		auth := options.Credential{}
+		if opts.Auth != nil {
+			auth = *opts.Auth
+		}
+		if c.Username != "" {
+			auth.Username = c.Username
+		}
+		// an empty password keeps the one of the URI
+		if c.Password != "" {
+			auth.Password, auth.PasswordSet = c.Password, true
+		}
+		if c.AuthMechanism != "" {
+			auth.AuthMechanism = c.AuthMechanism
+		}
+		if c.AuthSource != "" {
+			auth.AuthSource = c.AuthSource
+		}
+		opts.SetAuth(auth)
+	}
+
+	if c.MinPoolSize > 0 {
+		opts.SetMinPoolSize(c.MinPoolSize)
+	}
+	if c.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(c.MaxPoolSize)
+	}
+	if c.MaxConnecting > 0 {
+		opts.SetMaxConnecting(c.MaxConnecting)
+	}
+	if c.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(time.Duration(c.MaxConnIdleTime))
+	}
+	if c.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(time.Duration(c.ConnectTimeout))
+	}
+	if c.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(time.Duration(c.ServerSelectionTimeout))
+	}
+	if c.Timeout > 0 {
+		opts.SetTimeout(time.Duration(c.Timeout))
+	}
+	if c.HeartbeatInterval > 0 {
+		opts.SetHeartbeatInterval(time.Duration(c.HeartbeatInterval))
+	}
+
+	if c.TLS.Enabled {
+		tlsConfig, err := c.TLS.load()
+		if err != nil {
+			return err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	if len(c.Compressors) > 0 {
+		opts.SetCompressors(c.Compressors)
+	}
+
+	if c.ReadConcern != "" {
+		opts.SetReadConcern(&readconcern.ReadConcern{Level: c.ReadConcern})
+	}
+	if c.ReadPreference != "" {
+		mode, _ := readpref.ModeFromString(c.ReadPreference)
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return fmt.Errorf("invalid readPreference: %w", err)
+		}
+		opts.SetReadPreference(rp)
+	}
+	if c.WriteConcern != "" || c.Journal != nil {
+		// a copy of the URI write concern, keeping its journal setting
+		wc := &writeconcern.WriteConcern{}
+		if opts.WriteConcern != nil {
+			*wc = *opts.WriteConcern
+		}
+		if c.Journal != nil {
+			wc.Journal = c.Journal
+		}
+		if n, err := strconv.Atoi(c.WriteConcern); err == nil {
+			wc.W = n
+		} else if c.WriteConcern != "" {
+			wc.W = c.WriteConcern
+		}
+		opts.SetWriteConcern(wc)
+	}
+
+	if c.StableAPI != "" {
+		opts.SetServerAPIOptions(options.ServerAPI(options.ServerAPIVersion(c.StableAPI)).
+			SetStrict(c.StableAPIStrict).
+			SetDeprecationErrors(c.StableAPIDeprecationErrors))
+	}
+	if c.DirectConnection != nil {
+		opts.SetDirect(*c.DirectConnection)
+	}
+	if c.ReplicaSet != "" {
+		opts.SetReplicaSet(c.ReplicaSet)
+	}
+	if c.RetryWrites != nil {
+		opts.SetRetryWrites(*c.RetryWrites)
+	}
+	if c.RetryReads != nil {
+		opts.SetRetryReads(*c.RetryReads)
+	}
+	return nil
+}
+
+// load builds the TLS configuration from the files
+func (t TLSConfig) load() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls.caFile: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls.caFile %s has no PEM certificates", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		keyFile := t.KeyFile
+		if keyFile == "" {
+			keyFile = t.CertFile
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Redacted returns a copy of the configuration with the password and URI credentials masked
+func (c Config) Redacted() Config {
+	if c.Password != "" {
+		c.Password = redacted
+	}
+	c.URI = redactURI(c.URI)
+	return c
+}
+
+// String prints the configuration without secrets
+func (c Config) String() string {
+	data, err := json.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("invalid config: %v", err)
+	}
+	return string(data)
+}
+
+// GoString prints the configuration without secrets for the %#v verb
+func (c Config) GoString() string {
+	type config Config
+	return strings.Replace(fmt.Sprintf("%#v", config(c.Redacted())), ".config{", ".Config{", 1)
+}
+
+// secretURIOptions are the query parameters holding credentials besides passwords, secrets and tokens,
+// e.g. the AWS session token in authMechanismProperties
+var secretURIOptions = []string{"authmechanismproperties"}
+
+// redactURI masks the password and the secret query parameters of a connection string
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		// never print what can't be parsed, it may hold credentials
+		if uri == "" {
+			return ""
+		}
+		return redacted
+	}
+	// the raw parameters are masked in place, keeping their order and encoding
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			return redacted
+		}
+		if isSecretURIOption(name) {
+			params[i] = key + "=" + redacted
+		}
+	}
+	u.RawQuery = strings.Join(params, "&")
+	return u.Redacted()
+}
+
+// isSecretURIOption reports whether the connection string option holds credentials
+func isSecretURIOption(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.Contains(lower, "password") || strings.Contains(lower, "secret") || strings.Contains(lower, "token") ||
+		slices.Contains(secretURIOptions, lower)
+}
+
+// NewClientFromConfig validates the configuration and connects with it
+func NewClientFromConfig(ctx context.Context, config *Config, opts ...ClientOptions) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	c := &Client{}
+	if len(opts) > 0 {
+		c.opts = opts[0]
+	}
+
+	// the caller's options are copied, so they keep their settings and monitors
+	clientOpts := options.Client()
+	if c.opts.Options != nil {
+		copied := *c.opts.Options
+		clientOpts = &copied
+	}
+	if err := config.apply(clientOpts); err != nil {
+		return nil, err
+	}
+
+	if err := c.connect(ctx, clientOpts); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
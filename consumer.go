@@ -0,0 +1,288 @@
+package mongoclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const DefaultResumeTokenCollection = "change_stream_tokens"
+
+// ErrChangeStreamInvalidated is passed to the resync callback when the stream was invalidated,
+// e.g. because the collection was dropped or renamed
+var ErrChangeStreamInvalidated = errors.New("change stream invalidated")
+
+// ErrChangeStreamHistoryLost is passed to the resync callback when the resume token is no longer in the oplog
+var ErrChangeStreamHistoryLost = errors.New("change stream history lost")
+
+// ErrConsumerMaxAttempts is returned by Run when the handler failed an event MaxAttempts times
+// and the consumer has no DeadLetter callback
+var ErrConsumerMaxAttempts = errors.New("change event handler exceeded max attempts")
+
+// ResumeTokenStore persists resume tokens of change stream consumers
+type ResumeTokenStore interface {
+	// Load returns the saved token, or nil if the consumer has none
+	Load(ctx context.Context, consumer string) (bson.Raw, error)
+	Save(ctx context.Context, consumer string, token bson.Raw) error
+}
+
+// MongoResumeTokenStore stores resume tokens in a collection, one document per consumer
+type MongoResumeTokenStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoResumeTokenStore creates a token store backed by the collection
+func NewMongoResumeTokenStore(collection *mongo.Collection) *MongoResumeTokenStore {
+	return &MongoResumeTokenStore{collection: collection}
+}
+
+// Load returns the saved token of the consumer
+func (s *MongoResumeTokenStore) Load(ctx context.Context, consumer string) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := s.collection.FindOne(ctx, bson.M{"_id": consumer}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load resume token: %w", err)
+	}
+	return doc.Token, nil
+}
+
+// Save stores the token of the consumer
+func (s *MongoResumeTokenStore) Save(ctx context.Context, consumer string, token bson.Raw) error {
+	update := bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now()}}
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": consumer}, update, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save resume token: %w", err)
+	}
+	return nil
+}
+
+// ConsumerOptions configures a change stream consumer
+type ConsumerOptions struct {
+	// Name identifies the consumer in the token store, required
+	Name string
+	// Store persists resume tokens, a MongoResumeTokenStore on the "change_stream_tokens" collection by default
+	Store ResumeTokenStore
+	// Pipeline filters events, e.g. NewChangeFilter().Pipeline()
+	Pipeline any
+	// StreamOptions are passed to Watch; resume options are set by the consumer
+	StreamOptions []options.Lister[options.ChangeStreamOptions]
+	// CheckpointEvery saves the token after that many handled events, 1 by default
+	CheckpointEvery int
+	// MinRetryDelay and MaxRetryDelay bound the backoff after errors, 1s and 1m by default
+	MinRetryDelay time.Duration
+	MaxRetryDelay time.Duration
+	// Resync is called when the stream is invalidated or its history is lost, with
+	// ErrChangeStreamInvalidated or ErrChangeStreamHistoryLost. Events that happen while it runs
+	// are delivered afterwards. Without it, Run returns the error.
+	Resync func(ctx context.Context, reason error) error
+	// MaxAttempts limits how many times the handler is called for the same event, 0 means no limit.
+	// When it's exceeded the event goes to DeadLetter, or Run returns ErrConsumerMaxAttempts without it.
+	MaxAttempts int
+	// DeadLetter is called with the raw event and the last handler error when MaxAttempts is exceeded.
+	// The event is skipped once it returns nil.
+	DeadLetter func(ctx context.Context, event bson.Raw, err error) error
+	// OnError is called for every error before the consumer retries
+	OnError func(err error)
+}
+
+// Consumer handles change events of a repository and checkpoints its progress,
+// so it resumes where it stopped after restarts and errors. Events are delivered at least once.
+type Consumer[T any] struct {
+	repo    *Repository[T]
+	handler func(ctx context.Context, event ChangeEvent[T]) error
+	opts    ConsumerOptions
+
+	// failedToken and attempts track the handler failures of the same event across streams
+	failedToken bson.Raw
+	attempts    int
+}
+
+// NewConsumer creates a new change stream consumer for the repository
+func NewConsumer[T any](repo *Repository[T], handler func(ctx context.Context, event ChangeEvent[T]) error, opts ConsumerOptions) *Consumer[T] {
+	if opts.Store == nil {
+		opts.Store = NewMongoResumeTokenStore(repo.collection.Database().Collection(DefaultResumeTokenCollection))
+	}
+	if opts.Pipeline == nil {
+		opts.Pipeline = mongo.Pipeline{}
+	}
+	if opts.CheckpointEvery < 1 {
+		opts.CheckpointEvery = 1
+	}
+	if opts.MinRetryDelay <= 0 {
+		opts.MinRetryDelay = time.Second
+	}
+	if opts.MaxRetryDelay <= 0 {
+		opts.MaxRetryDelay = time.Minute
+	}
+	return &Consumer[T]{repo: repo, handler: handler, opts: opts}
+}
+
+// Run consumes events until the context is canceled or an unrecoverable error occurs
+func (c *Consumer[T]) Run(ctx context.Context) error {
+	if c.opts.Name == "" {
+		return errors.New("consumer name is required")
+	}
+	delay := c.opts.MinRetryDelay
+	for {
+		handled, err := c.consume(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if handled {
+			delay = c.opts.MinRetryDelay
+		}
+
+		switch {
+		case errors.Is(err, ErrConsumerMaxAttempts):
+			return err
+		case errors.Is(err, ErrChangeStreamInvalidated), errors.Is(err, ErrChangeStreamHistoryLost):
+			if c.opts.Resync == nil {
+				return err
+			}
+			if err = c.resync(ctx, err); err == nil {
+				continue
+			}
+		case err == nil:
+			continue
+		}
+
+		if c.opts.OnError != nil {
+			c.opts.OnError(err)
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+		delay = min(delay*2, c.opts.MaxRetryDelay)
+	}
+}
+
+// consume runs a single change stream from the saved token until it fails
+func (c *Consumer[T]) consume(ctx context.Context) (bool, error) {
+	token, err := c.opts.Store.Load(ctx, c.opts.Name)
+	if err != nil {
+		return false, err
+	}
+
+	streamOpts := c.opts.StreamOptions
+	if token != nil {
+		streamOpts = append(streamOpts[:len(streamOpts):len(streamOpts)], options.ChangeStream().SetStartAfter(token))
+	}
+	stream, err := c.repo.WatchTyped(ctx, c.opts.Pipeline, streamOpts...)
+	if err != nil {
+		if isHistoryLost(err) {
+			return false, fmt.Errorf("%w: %v", ErrChangeStreamHistoryLost, err)
+		}
+		return false, err
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	var (
+		pending   int
+		lastToken bson.Raw
+		handled   bool
+	)
+	checkpoint := func(ctx context.Context) error {
+		if pending == 0 {
+			return nil
+		}
+		if err := c.opts.Store.Save(ctx, c.opts.Name, lastToken); err != nil {
+			return err
+		}
+		pending = 0
+		return nil
+	}
+	defer checkpoint(context.WithoutCancel(ctx))
+
+	for stream.Next(ctx) {
+		event := stream.Event()
+		if event.OperationType == OperationInvalidate {
+			return handled, ErrChangeStreamInvalidated
+		}
+		if err = c.handle(ctx, event, stream.Raw(), stream.ResumeToken()); err != nil {
+			return handled, err
+		}
+		handled = true
+		lastToken = stream.ResumeToken()
+		pending++
+		if pending >= c.opts.CheckpointEvery {
+			if err = checkpoint(ctx); err != nil {
+				return handled, err
+			}
+		}
+	}
+
+	err = stream.Err()
+	if isHistoryLost(err) {
+		return handled, fmt.Errorf("%w: %v", ErrChangeStreamHistoryLost, err)
+	}
+	return handled, err
+}
+
+// handle calls the handler for the event, and the dead letter callback once the event failed MaxAttempts times
+func (c *Consumer[T]) handle(ctx context.Context, event ChangeEvent[T], raw, token bson.Raw) error {
+	err := c.handler(ctx, event)
+	if err == nil {
+		c.failedToken, c.attempts = nil, 0
+		return nil
+	}
+
+	if !bytes.Equal(token, c.failedToken) {
+		c.failedToken, c.attempts = bytes.Clone(token), 0
+	}
+	c.attempts++
+	if c.opts.MaxAttempts <= 0 || c.attempts < c.opts.MaxAttempts {
+		return fmt.Errorf("failed to handle change event: %w", err)
+	}
+
+	if c.opts.DeadLetter == nil {
+		return fmt.Errorf("%w: %w", ErrConsumerMaxAttempts, err)
+	}
+	if dlErr := c.opts.DeadLetter(ctx, raw, err); dlErr != nil {
+		return fmt.Errorf("failed to dead letter change event: %w", dlErr)
+	}
+	c.failedToken, c.attempts = nil, 0
+	return nil
+}
+
+// resync takes a token for the current time before calling the resync callback and saves it
+// once the callback succeeds, so events that happen during the resync are consumed afterwards
+// and a failed resync is retried
+func (c *Consumer[T]) resync(ctx context.Context, reason error) error {
+	stream, err := c.repo.WatchTyped(ctx, c.opts.Pipeline, c.opts.StreamOptions...)
+	if err != nil {
+		return err
+	}
+	token := stream.ResumeToken()
+	stream.Close(ctx)
+
+	if token == nil {
+		return fmt.Errorf("failed to resync: change stream returned no resume token")
+	}
+	if err = c.opts.Resync(ctx, reason); err != nil {
+		return fmt.Errorf("failed to resync: %w", err)
+	}
+	return c.opts.Store.Save(ctx, c.opts.Name, token)
+}
+
+// isHistoryLost reports whether the resume point is no longer available in the oplog
+func isHistoryLost(err error) bool {
+	var se mongo.ServerError
+	if !errors.As(err, &se) {
+		return false
+	}
+	return se.HasErrorCode(286) || // ChangeStreamHistoryLost
+		se.HasErrorCode(280) // ChangeStreamFatalError
+}
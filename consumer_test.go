@@ -0,0 +1,42 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestIsHistoryLost(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "plain error", err: errors.New("boom"), want: false},
+		{name: "history lost", err: mongo.CommandError{Code: 286, Name: "ChangeStreamHistoryLost"}, want: true},
+		{name: "fatal error", err: mongo.CommandError{Code: 280, Name: "ChangeStreamFatalError"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("failed to watch: %w", mongo.CommandError{Code: 286}), want: true},
+		{name: "other server error", err: mongo.CommandError{Code: 11601}, want: false},
+		{name: "network", err: mongo.CommandError{Labels: []string{"NetworkError"}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isHistoryLost(tt.err); got != tt.want {
+				t.Errorf("isHistoryLost(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsumerRunRequiresName(t *testing.T) {
+	repo := NewRepository[*transferUser](testDatabase(t).Collection("users"))
+	consumer := NewConsumer(repo, func(ctx context.Context, event ChangeEvent[*transferUser]) error { return nil }, ConsumerOptions{})
+	if err := consumer.Run(context.Background()); err == nil {
+		t.Error("Run() error = nil, want the missing name reported")
+	}
+}
@@ -13,22 +13,33 @@ import (
 func (r *Repository[T]) InsertOne(ctx context.Context, document T, opts ...options.Lister[options.InsertOneOptions]) (T, error) {
 	var zero T
 
+	if r.idempotent(ctx) {
+		return Idempotent(ctx, r.idempotency, "insertOne:"+r.collection.Name(), func(ctx context.Context) (T, error) {
+			return r.InsertOne(ctx, document, opts...)
+		})
+	}
+
 	// call BeforeInsert hook if it exists
-	if hook, ok := any(document).(Document); ok {
-		hook.BeforeInsert()
+	if err := r.beforeInsert(ctx, document); err != nil {
+		return zero, fmt.Errorf("failed to prepare document: %w", err)
 	}
 
 	// Insert the document into the collection
 	result, err := r.collection.InsertOne(ctx, document, opts...)
 	if err != nil {
-		return zero, fmt.Errorf("failed to insert document: %w", err)
+		return zero, r.classifyError("InsertOne", nil, fmt.Errorf("failed to insert document: %w", err))
 	}
 
 	// retrieve the inserted document
 	var inserted T
 	err = r.collection.FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(&inserted)
 	if err != nil {
-		return zero, fmt.Errorf("failed to fetch inserted document: %w", err)
+		filter := bson.M{"_id": result.InsertedID}
+		return zero, &InsertedFetchError{
+			OperationInfo: OperationInfo{Operation: "InsertOne", Collection: r.collection.Name(), Filter: filter},
+			ID:            result.InsertedID,
+			Err:           r.classifyError("InsertOne", filter, fmt.Errorf("failed to fetch inserted document: %w", err)),
+		}
 	}
 
 	return inserted, nil
@@ -42,15 +53,15 @@ func (r *Repository[T]) InsertMany(ctx context.Context, documents []T, opts ...o
 
 	interfaces := make([]any, len(documents))
 	for i, doc := range documents {
-		if hook, ok := any(doc).(Document); ok {
-			hook.BeforeInsert()
+		if err := r.beforeInsert(ctx, doc); err != nil {
+			return nil, fmt.Errorf("failed to prepare document: %w", err)
 		}
 		interfaces[i] = doc
 	}
 
 	result, err := r.collection.InsertMany(ctx, interfaces, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert documents: %w", err)
+		return nil, r.classifyError("InsertMany", nil, fmt.Errorf("failed to insert documents: %w", err))
 	}
 
 	return result.InsertedIDs, nil
@@ -62,7 +73,8 @@ func (r *Repository[T]) FindOne(ctx context.Context, filter any, opts ...options
 	if filter == nil {
 		filter = bson.M{}
 	}
-	return result, r.collection.FindOne(ctx, filter, opts...).Decode(&result)
+	err := r.collection.FindOne(ctx, filter, opts...).Decode(&result)
+	return result, r.classifyError("FindOne", filter, err)
 }
 
 // Find retrieves multiple documents
@@ -72,13 +84,13 @@ func (r *Repository[T]) Find(ctx context.Context, filter any, opts ...options.Li
 	}
 	cursor, err := r.collection.Find(ctx, filter, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute find: %w", err)
+		return nil, r.classifyError("Find", filter, fmt.Errorf("failed to execute find: %w", err))
 	}
 	defer cursor.Close(ctx)
 
 	var results []T
 	if err = cursor.All(ctx, &results); err != nil {
-		return nil, fmt.Errorf("failed to decode results: %w", err)
+		return nil, r.classifyError("Find", filter, fmt.Errorf("failed to decode results: %w", err))
 	}
 
 	return results, nil
@@ -110,7 +122,7 @@ func (r *Repository[T]) FindPaginatedWithTotal(ctx context.Context, filter any,
 	// Validation of page/pageSize happens in FindPaginated
 	total, err := r.collection.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count documents: %w", err)
+		return nil, 0, r.classifyError("CountDocuments", filter, fmt.Errorf("failed to count documents: %w", err))
 	}
 
 	results, err := r.FindPaginated(ctx, filter, page, pageSize, opts...)
@@ -127,13 +139,13 @@ func (r *Repository[T]) FindDecoded(ctx context.Context, filter any, opts ...opt
 	}
 	cursor, err := r.collection.Find(ctx, filter, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute find: %w", err)
+		return nil, r.classifyError("Find", filter, fmt.Errorf("failed to execute find: %w", err))
 	}
 	defer cursor.Close(ctx)
 
 	var results []T
 	if err = cursor.All(ctx, &results); err != nil {
-		return nil, fmt.Errorf("failed to decode results: %w", err)
+		return nil, r.classifyError("Find", filter, fmt.Errorf("failed to decode results: %w", err))
 	}
 	return results, nil
 }
@@ -141,7 +153,7 @@ func (r *Repository[T]) FindDecoded(ctx context.Context, filter any, opts ...opt
 func (r *Repository[T]) FindDecodedWithTotal(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) ([]T, int64, error) {
 	total, err := r.collection.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count documents: %w", err)
+		return nil, 0, r.classifyError("CountDocuments", filter, fmt.Errorf("failed to count documents: %w", err))
 	}
 
 	results, err := r.FindDecoded(ctx, filter, opts...)
@@ -161,6 +173,12 @@ func (r *Repository[T]) FindByID(ctx context.Context, id any, opts ...options.Li
 func (r *Repository[T]) FindOneAndUpdate(ctx context.Context, filter, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) (T, error) {
 	var result T
 
+	if r.idempotent(ctx) {
+		return Idempotent(ctx, r.idempotency, "findOneAndUpdate:"+r.collection.Name(), func(ctx context.Context) (T, error) {
+			return r.FindOneAndUpdate(ctx, filter, update, opts...)
+		})
+	}
+
 	switch {
 	case isMongoOperator(update):
 		// Already formatted update (e.g., $set, $inc) -> do nothing
@@ -174,7 +192,8 @@ func (r *Repository[T]) FindOneAndUpdate(ctx context.Context, filter, update any
 	}
 
 	opts = append(opts, options.FindOneAndUpdate().SetReturnDocument(options.After))
-	return result, r.collection.FindOneAndUpdate(ctx, filter, update, opts...).Decode(&result)
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts...).Decode(&result)
+	return result, r.classifyError("FindOneAndUpdate", filter, err)
 }
 
 func (r *Repository[T]) FindOneAndUpdateByID(ctx context.Context, id, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) (T, error) {
@@ -184,7 +203,8 @@ func (r *Repository[T]) FindOneAndUpdateByID(ctx context.Context, id, update any
 // FindOneAndDelete finds a document and deletes it
 func (r *Repository[T]) FindOneAndDelete(ctx context.Context, filter any, opts ...options.Lister[options.FindOneAndDeleteOptions]) (T, error) {
 	var result T
-	return result, r.collection.FindOneAndDelete(ctx, filter, opts...).Decode(&result)
+	err := r.collection.FindOneAndDelete(ctx, filter, opts...).Decode(&result)
+	return result, r.classifyError("FindOneAndDelete", filter, err)
 }
 
 // UpdateOne updates a single document
@@ -200,7 +220,11 @@ func (r *Repository[T]) UpdateOne(ctx context.Context, filter, update any, opts
 	default:
 		return nil, fmt.Errorf("unsupported update type: %T", update)
 	}
-	return r.collection.UpdateOne(ctx, filter, update, opts...)
+	result, err := r.collection.UpdateOne(ctx, filter, update, opts...)
+	if err != nil {
+		return nil, r.classifyError("UpdateOne", filter, fmt.Errorf("failed to update document: %w", err))
+	}
+	return result, nil
 }
 
 // UpdateByID finds a document by its ID
@@ -224,7 +248,7 @@ func (r *Repository[T]) UpdateMany(ctx context.Context, filter any, update any,
 
 	result, err := r.collection.UpdateMany(ctx, filter, update, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update documents: %w", err)
+		return nil, r.classifyError("UpdateMany", filter, fmt.Errorf("failed to update documents: %w", err))
 	}
 	return result, nil
 }
@@ -233,11 +257,11 @@ func (r *Repository[T]) UpdateMany(ctx context.Context, filter any, update any,
 func (r *Repository[T]) DeleteOne(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) error {
 	result, err := r.collection.DeleteOne(ctx, filter, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to delete document: %w", err)
+		return r.classifyError("DeleteOne", filter, fmt.Errorf("failed to delete document: %w", err))
 	}
 
 	if result.DeletedCount == 0 {
-		return mongo.ErrNoDocuments
+		return r.classifyError("DeleteOne", filter, mongo.ErrNoDocuments)
 	}
 
 	return nil
@@ -252,7 +276,7 @@ func (r *Repository[T]) DeleteByID(ctx context.Context, id any, opts ...options.
 func (r *Repository[T]) DeleteMany(ctx context.Context, filter any, opts ...options.Lister[options.DeleteManyOptions]) (int64, error) {
 	result, err := r.collection.DeleteMany(ctx, filter, opts...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to delete documents: %w", err)
+		return 0, r.classifyError("DeleteMany", filter, fmt.Errorf("failed to delete documents: %w", err))
 	}
 
 	return result.DeletedCount, nil
@@ -36,8 +36,10 @@ type IRepository[T any] interface {
 	Transaction(ctx context.Context, fn func(sessCtx context.Context) error, opts ...options.Lister[options.SessionOptions]) error
 	EnsureIndexes(ctx context.Context, indexes []mongo.IndexModel, opts ...options.Lister[options.CreateIndexesOptions]) error
 	GetIndexes(ctx context.Context, opts ...options.Lister[options.ListIndexesOptions]) ([]bson.M, error)
+	SyncIndexes(ctx context.Context, desired []mongo.IndexModel, mode IndexSyncMode, opts ...IndexSyncOptions) (*IndexPlan, error)
 	BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...options.Lister[options.BulkWriteOptions]) (*mongo.BulkWriteResult, error)
 	Watch(ctx context.Context, pipeline any, opts ...options.Lister[options.ChangeStreamOptions]) (*mongo.ChangeStream, error)
+	WatchTyped(ctx context.Context, pipeline any, opts ...options.Lister[options.ChangeStreamOptions]) (*ChangeEventStream[T], error)
 
 	EnsureIndexesAssertType(ctx context.Context, opts ...options.Lister[options.CreateIndexesOptions]) error
 }
@@ -50,7 +52,9 @@ type Document interface {
 
 // Repository implements IRepository interface for MongoDB
 type Repository[T any] struct {
-	collection *mongo.Collection
+	collection  *mongo.Collection
+	sequences   *Sequences
+	idempotency *IdempotencyStore
 }
 
 // NewRepository creates a new MongoDB repository
@@ -1,6 +1,267 @@
 package mongoclient
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
 const (
 	MinPaginationLimit = 1
 	MaxPaginationLimit = 100
 )
+
+// ErrNotFound is matched by errors.Is for operations that found no documents.
+// Such errors also match mongo.ErrNoDocuments.
+var ErrNotFound = errors.New("document not found")
+
+// OperationInfo describes the repository operation that failed
+type OperationInfo struct {
+	Operation  string
+	Collection string
+	Filter     any
+}
+
+// Info returns the operation metadata
+func (i OperationInfo) Info() OperationInfo {
+	return i
+}
+
+// String describes the error with its operation metadata, for logs
+func (i OperationInfo) String() string {
+	if i.Filter == nil {
+		return fmt.Sprintf("%s on %s", i.Operation, i.Collection)
+	}
+	return fmt.Sprintf("%s on %s with filter %v", i.Operation, i.Collection, i.Filter)
+}
+
+// NotFoundError is returned when no document matched the filter
+type NotFoundError struct {
+	OperationInfo
+	Err error
+}
+
+func (e *NotFoundError) Error() string        { return e.Err.Error() }
+func (e *NotFoundError) Unwrap() error        { return e.Err }
+func (e *NotFoundError) Is(target error) bool { return target == ErrNotFound }
+
+// DuplicateKeyError is returned when a write violates a unique index
+type DuplicateKeyError struct {
+	OperationInfo
+	// Index is the name of the violated index
+	Index string
+	// KeyPattern and KeyValues describe the conflicting key, when the server reports them
+	KeyPattern bson.M
+	KeyValues  bson.M
+	Err        error
+}
+
+func (e *DuplicateKeyError) Error() string { return e.Err.Error() }
+func (e *DuplicateKeyError) Unwrap() error { return e.Err }
+
+// ValidationError is returned when a document fails the collection schema validation
+type ValidationError struct {
+	OperationInfo
+	// Details is the validation failure description reported by the server
+	Details bson.Raw
+	Err     error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// TimeoutError is returned when an operation ran out of time, on the client or the server
+type TimeoutError struct {
+	OperationInfo
+	Err error
+}
+
+func (e *TimeoutError) Error() string { return e.Err.Error() }
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// ConflictError is returned when a write conflicts with a concurrent write, typically in transactions
+type ConflictError struct {
+	OperationInfo
+	Err error
+}
+
+func (e *ConflictError) Error() string { return e.Err.Error() }
+func (e *ConflictError) Unwrap() error { return e.Err }
+
+// InsertedFetchError is returned by InsertOne when the document was inserted
+// but reading it back failed. ID is the _id of the inserted document.
+type InsertedFetchError struct {
+	OperationInfo
+	ID  any
+	Err error
+}
+
+func (e *InsertedFetchError) Error() string { return e.Err.Error() }
+func (e *InsertedFetchError) Unwrap() error { return e.Err }
+
+// BulkWriteItemError is the failure of a single write of a bulk operation.
+// Err is a DuplicateKeyError or ValidationError when the failure is one.
+type BulkWriteItemError struct {
+	Index   int
+	Code    int
+	Message string
+	Err     error
+}
+
+func (e BulkWriteItemError) Error() string {
+	return fmt.Sprintf("write %d failed: %s", e.Index, e.Message)
+}
+func (e BulkWriteItemError) Unwrap() error { return e.Err }
+
+// BulkWriteErrors is returned when writes of InsertMany or BulkWrite failed
+type BulkWriteErrors struct {
+	OperationInfo
+	Errors []BulkWriteItemError
+	// WriteConcernError is set when the writes were not acknowledged as requested
+	WriteConcernError *mongo.WriteConcernError
+	Err               error
+}
+
+func (e *BulkWriteErrors) Error() string { return e.Err.Error() }
+
+// Unwrap returns the driver error and the item errors, so errors.As finds typed item errors
+func (e *BulkWriteErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors)+1)
+	errs = append(errs, e.Err)
+	for _, item := range e.Errors {
+		errs = append(errs, item)
+	}
+	return errs
+}
+
+// IsNotFound reports whether the error means that no document was found
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, mongo.ErrNoDocuments)
+}
+
+// IsDuplicateKey reports whether the error is a unique index violation, including in bulk writes
+func IsDuplicateKey(err error) bool {
+	var dke *DuplicateKeyError
+	return errors.As(err, &dke) || mongo.IsDuplicateKeyError(err)
+}
+
+// IsValidation reports whether the error is a schema validation failure
+func IsValidation(err error) bool {
+	var ve *ValidationError
+	return errors.As(err, &ve)
+}
+
+// IsTimeout reports whether the error is a timeout
+func IsTimeout(err error) bool {
+	var te *TimeoutError
+	return errors.As(err, &te) || mongo.IsTimeout(err)
+}
+
+// IsConflict reports whether the error is a write conflict
+func IsConflict(err error) bool {
+	var ce *ConflictError
+	return errors.As(err, &ce)
+}
+
+// operationError is implemented by the typed errors through OperationInfo
+type operationError interface {
+	error
+	Info() OperationInfo
+}
+
+const (
+	codeWriteConflict      = 112
+	codeDocumentValidation = 121
+)
+
+var duplicateIndexPattern = regexp.MustCompile(`index: (\S+) dup key`)
+
+// classifyError turns driver errors into the typed errors of the package.
+// Other errors and errors classified already are returned as is.
+func (r *Repository[T]) classifyError(operation string, filter any, err error) error {
+	if err == nil {
+		return nil
+	}
+	var oe operationError
+	if errors.As(err, &oe) {
+		return err
+	}
+	return newOperationError(OperationInfo{Operation: operation, Collection: r.collection.Name(), Filter: filter}, err)
+}
+
+// newOperationError returns the typed error for the driver error, or the error itself if it has no type
+func newOperationError(info OperationInfo, err error) error {
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) {
+		result := &BulkWriteErrors{OperationInfo: info, WriteConcernError: bwe.WriteConcernError, Err: err}
+		for _, we := range bwe.WriteErrors {
+			item := BulkWriteItemError{Index: we.Index, Code: we.Code, Message: we.Message, Err: we.WriteError}
+			if typed := writeErrorType(info, we.WriteError, we.WriteError); typed != nil {
+				item.Err = typed
+			}
+			result.Errors = append(result.Errors, item)
+		}
+		return result
+	}
+
+	var we mongo.WriteException
+	if errors.As(err, &we) {
+		for _, writeErr := range we.WriteErrors {
+			if typed := writeErrorType(info, writeErr, err); typed != nil {
+				return typed
+			}
+		}
+	}
+
+	var ce mongo.CommandError
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &NotFoundError{OperationInfo: info, Err: err}
+	case errors.As(err, &ce) && mongo.IsDuplicateKeyError(ce):
+		return newDuplicateKeyError(info, ce.Message, ce.Raw, err)
+	case errors.As(err, &ce) && ce.Code == codeDocumentValidation:
+		ve := &ValidationError{OperationInfo: info, Err: err}
+		if details, lookupErr := ce.Raw.LookupErr("errInfo"); lookupErr == nil {
+			ve.Details, _ = details.DocumentOK()
+		}
+		return ve
+	case errors.As(err, &ce) && ce.Code == codeWriteConflict:
+		return &ConflictError{OperationInfo: info, Err: err}
+	case mongo.IsTimeout(err):
+		return &TimeoutError{OperationInfo: info, Err: err}
+	}
+	return err
+}
+
+// writeErrorType returns the typed error of a write error, nil if it has no type
+func writeErrorType(info OperationInfo, we mongo.WriteError, err error) error {
+	switch {
+	case mongo.IsDuplicateKeyError(we):
+		return newDuplicateKeyError(info, we.Message, we.Raw, err)
+	case we.Code == codeDocumentValidation:
+		return &ValidationError{OperationInfo: info, Details: we.Details, Err: err}
+	case we.Code == codeWriteConflict:
+		return &ConflictError{OperationInfo: info, Err: err}
+	}
+	return nil
+}
+
+// newDuplicateKeyError extracts the index and key from the server error
+func newDuplicateKeyError(info OperationInfo, message string, raw bson.Raw, err error) *DuplicateKeyError {
+	dke := &DuplicateKeyError{OperationInfo: info, Err: err}
+	if m := duplicateIndexPattern.FindStringSubmatch(message); m != nil {
+		dke.Index = m[1]
+	}
+	if raw != nil {
+		if value, lookupErr := raw.LookupErr("keyPattern"); lookupErr == nil {
+			_ = value.Unmarshal(&dke.KeyPattern)
+		}
+		if value, lookupErr := raw.LookupErr("keyValue"); lookupErr == nil {
+			_ = value.Unmarshal(&dke.KeyValues)
+		}
+	}
+	return dke
+}
@@ -0,0 +1,155 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestNewOperationError(t *testing.T) {
+	info := OperationInfo{Operation: "InsertOne", Collection: "users"}
+	dupMessage := "E11000 duplicate key error collection: db.users index: email_1 dup key: { email: \"a@example.com\" }"
+	dupRaw, _ := bson.Marshal(bson.M{"keyPattern": bson.M{"email": 1}, "keyValue": bson.M{"email": "a@example.com"}})
+
+	tests := []struct {
+		name  string
+		err   error
+		check func(t *testing.T, err error)
+	}{
+		{
+			name: "not found",
+			err:  fmt.Errorf("failed to find: %w", mongo.ErrNoDocuments),
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrNotFound) || !errors.Is(err, mongo.ErrNoDocuments) || !IsNotFound(err) {
+					t.Errorf("error = %v, want ErrNotFound matching mongo.ErrNoDocuments", err)
+				}
+			},
+		},
+		{
+			name: "duplicate key write",
+			err:  mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: dupMessage, Raw: dupRaw}}},
+			check: func(t *testing.T, err error) {
+				var dke *DuplicateKeyError
+				if !errors.As(err, &dke) {
+					t.Fatalf("error = %T, want *DuplicateKeyError", err)
+				}
+				if dke.Index != "email_1" || dke.KeyValues["email"] != "a@example.com" || dke.Collection != "users" {
+					t.Errorf("DuplicateKeyError = %+v", dke)
+				}
+				if !mongo.IsDuplicateKeyError(err) {
+					t.Error("mongo.IsDuplicateKeyError() = false, want the driver error kept")
+				}
+			},
+		},
+		{
+			name: "validation",
+			err:  mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 121, Details: bson.Raw(dupRaw)}}},
+			check: func(t *testing.T, err error) {
+				var ve *ValidationError
+				if !errors.As(err, &ve) || ve.Details == nil || !IsValidation(err) {
+					t.Errorf("error = %v, want *ValidationError with details", err)
+				}
+			},
+		},
+		{
+			name: "write conflict",
+			err:  mongo.CommandError{Code: 112, Labels: []string{"TransientTransactionError"}},
+			check: func(t *testing.T, err error) {
+				var ce mongo.CommandError
+				if !IsConflict(err) || !errors.As(err, &ce) {
+					t.Errorf("error = %T, want *ConflictError wrapping the command error", err)
+				}
+			},
+		},
+		{
+			name: "timeout",
+			err:  fmt.Errorf("failed: %w", context.DeadlineExceeded),
+			check: func(t *testing.T, err error) {
+				var te *TimeoutError
+				if !errors.As(err, &te) || !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("error = %v, want *TimeoutError wrapping the deadline", err)
+				}
+			},
+		},
+		{
+			name: "bulk write",
+			err: mongo.BulkWriteException{
+				WriteErrors: []mongo.BulkWriteError{
+					{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: dupMessage}},
+					{WriteError: mongo.WriteError{Index: 3, Code: 2, Message: "bad value"}},
+				},
+				WriteConcernError: &mongo.WriteConcernError{Code: 64},
+			},
+			check: func(t *testing.T, err error) {
+				var bwe *BulkWriteErrors
+				if !errors.As(err, &bwe) || len(bwe.Errors) != 2 || bwe.WriteConcernError == nil {
+					t.Fatalf("error = %v, want *BulkWriteErrors with 2 items and a write concern error", err)
+				}
+				var item error = bwe.Errors[0]
+				var dke *DuplicateKeyError
+				if !errors.As(item, &dke) || dke.Index != "email_1" {
+					t.Errorf("item 0 = %v, want a DuplicateKeyError", item)
+				}
+				if got := bwe.Errors[1].Error(); got != "write 3 failed: bad value" {
+					t.Errorf("item 1 Error() = %q", got)
+				}
+				if !IsDuplicateKey(err) {
+					t.Error("IsDuplicateKey() = false, want true")
+				}
+			},
+		},
+		{
+			name: "bulk write items",
+			err: mongo.BulkWriteException{
+				WriteErrors: []mongo.BulkWriteError{
+					{WriteError: mongo.WriteError{Index: 0, Code: 121, Message: "validation failed"}},
+					{WriteError: mongo.WriteError{Index: 2, Code: 112, Message: "write conflict"}},
+				},
+			},
+			check: func(t *testing.T, err error) {
+				var ve *ValidationError
+				if !errors.As(err, &ve) || !IsValidation(err) {
+					t.Errorf("error = %v, want the item ValidationError found through the bulk error", err)
+				}
+				if !IsConflict(err) {
+					t.Error("IsConflict() = false, want the item ConflictError found")
+				}
+				var bwe mongo.BulkWriteException
+				if !errors.As(err, &bwe) || len(bwe.WriteErrors) != 2 {
+					t.Errorf("error = %v, want the driver error kept", err)
+				}
+			},
+		},
+		{
+			name: "untyped",
+			err:  errors.New("boom"),
+			check: func(t *testing.T, err error) {
+				var oe operationError
+				if errors.As(err, &oe) || err.Error() != "boom" {
+					t.Errorf("error = %v (%T), want it returned as is", err, err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, newOperationError(info, tt.err))
+		})
+	}
+}
+
+func TestClassifyErrorKeepsTypedErrors(t *testing.T) {
+	r := NewRepository[*transferUser](nil)
+	typed := &NotFoundError{OperationInfo: OperationInfo{Operation: "FindOne", Collection: "a"}, Err: mongo.ErrNoDocuments}
+	if got := r.classifyError("Transaction", nil, fmt.Errorf("wrapped: %w", typed)); !errors.Is(got, typed) {
+		t.Errorf("classifyError() = %v, want the typed error kept", got)
+	}
+	if got := r.classifyError("Transaction", nil, nil); got != nil {
+		t.Errorf("classifyError(nil) = %v, want nil", got)
+	}
+}
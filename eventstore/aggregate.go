@@ -0,0 +1,111 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Reducer applies an event to the aggregate state
+type Reducer[S any] func(state S, event *Event) (S, error)
+
+// snapshot is the stored state of an aggregate at a stream version
+type snapshot[S any] struct {
+	StreamID string    `bson:"_id"`
+	Version  int64     `bson:"version"`
+	State    S         `bson:"state"`
+	TakenAt  time.Time `bson:"takenAt"`
+}
+
+// AggregateStore loads and saves aggregates of one type by projecting their event streams
+type AggregateStore[S any] struct {
+	store         *Store
+	reducer       Reducer[S]
+	initial       func() S
+	snapshotEvery int64
+}
+
+// NewAggregateStore creates an aggregate store. initial returns the state of an empty stream.
+// If snapshotEvery is greater than zero, a snapshot is saved every snapshotEvery events.
+func NewAggregateStore[S any](store *Store, initial func() S, reducer Reducer[S], snapshotEvery int64) *AggregateStore[S] {
+	return &AggregateStore[S]{store: store, reducer: reducer, initial: initial, snapshotEvery: snapshotEvery}
+}
+
+// Load rebuilds the aggregate from the latest snapshot and the events after it.
+// It returns the state and the stream version to pass to Save.
+func (a *AggregateStore[S]) Load(ctx context.Context, streamID string) (S, int64, error) {
+	state := a.initial()
+	var version int64
+
+	if a.snapshotEvery > 0 {
+		var snap snapshot[S]
+		err := a.store.snapshots.FindOne(ctx, bson.M{"_id": streamID}).Decode(&snap)
+		switch {
+		case err == nil:
+			state, version = snap.State, snap.Version
+		case !errors.Is(err, mongo.ErrNoDocuments):
+			return state, 0, fmt.Errorf("failed to load snapshot: %w", err)
+		}
+	}
+
+	events, err := a.store.Load(ctx, streamID, version)
+	if err != nil {
+		return state, 0, err
+	}
+	return applyEvents(state, version, events, a.reducer)
+}
+
+// applyEvents reduces the events, loaded in version order, onto the state at the version
+func applyEvents[S any](state S, version int64, events []*Event, reducer Reducer[S]) (S, int64, error) {
+	var err error
+	for _, event := range events {
+		if state, err = reducer(state, event); err != nil {
+			return state, 0, fmt.Errorf("failed to apply event %s v%d: %w", event.Type, event.Version, err)
+		}
+		version = event.Version
+	}
+	return state, version, nil
+}
+
+// Save appends events to the aggregate stream with the expected version check,
+// and takes a snapshot when the stream crosses a snapshotEvery boundary.
+func (a *AggregateStore[S]) Save(ctx context.Context, streamID string, expectedVersion int64, events ...NewEvent) (int64, error) {
+	version, err := a.store.Append(ctx, streamID, expectedVersion, events...)
+	if err != nil {
+		return 0, err
+	}
+
+	if crossesSnapshot(version, int64(len(events)), a.snapshotEvery) {
+		if err = a.Snapshot(ctx, streamID); err != nil {
+			return version, err
+		}
+	}
+	return version, nil
+}
+
+// crossesSnapshot reports whether appending n events up to the version crossed a multiple of every
+func crossesSnapshot(version, n, every int64) bool {
+	return every > 0 && version/every > (version-n)/every
+}
+
+// Snapshot stores the current state of the aggregate
+func (a *AggregateStore[S]) Snapshot(ctx context.Context, streamID string) error {
+	state, version, err := a.Load(ctx, streamID)
+	if err != nil {
+		return err
+	}
+
+	snap := snapshot[S]{StreamID: streamID, Version: version, State: state, TakenAt: time.Now()}
+	// Never replace a newer snapshot written concurrently.
+	filter := bson.M{"_id": streamID, "version": bson.M{"$lt": version}}
+	_, err = a.store.snapshots.ReplaceOne(ctx, filter, snap, options.Replace().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return nil
+}
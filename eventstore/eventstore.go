@@ -0,0 +1,255 @@
+// Package eventstore implements an event-sourced aggregate store on top of gomongo-client.
+//
+// Events are stored one per document in the events collection, with a unique index on
+// streamId+version that enforces optimistic concurrency. Aggregate state is rebuilt with a
+// reducer, optionally starting from a snapshot.
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	mongoclient "github.com/inc4/gomongo-client"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	DefaultEventsCollection    = "events"
+	DefaultSnapshotsCollection = "snapshots"
+)
+
+const (
+	// AnyVersion skips the expected version check
+	AnyVersion int64 = -1
+	// NoStream expects the stream to have no events yet
+	NoStream int64 = 0
+)
+
+// ErrConcurrencyConflict is returned when the stream version differs from the expected one
+var ErrConcurrencyConflict = errors.New("stream was modified concurrently")
+
+// Event is a stored event
+type Event struct {
+	ID         bson.ObjectID     `bson:"_id" json:"_id"`
+	StreamID   string            `bson:"streamId" json:"streamId"`
+	Version    int64             `bson:"version" json:"version"`
+	Type       string            `bson:"type" json:"type"`
+	Data       bson.RawValue     `bson:"data" json:"data"`
+	Metadata   map[string]string `bson:"metadata,omitempty" json:"metadata,omitempty"`
+	RecordedAt time.Time         `bson:"recordedAt" json:"recordedAt"`
+}
+
+// Decode unmarshals the event data into v
+func (e Event) Decode(v any) error {
+	return e.Data.Unmarshal(v)
+}
+
+// NewEvent is an event to append
+type NewEvent struct {
+	Type     string
+	Data     any
+	Metadata map[string]string
+}
+
+// Store appends and loads event streams
+type Store struct {
+	events    *mongoclient.Repository[*Event]
+	snapshots *mongo.Collection
+}
+
+// New creates an event store in the database
+func New(db *mongo.Database) *Store {
+	return &Store{
+		events:    mongoclient.NewRepository[*Event](db.Collection(DefaultEventsCollection)),
+		snapshots: db.Collection(DefaultSnapshotsCollection),
+	}
+}
+
+// EnsureIndexes creates the unique streamId+version index
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	return s.events.EnsureIndexes(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "streamId", Value: 1}, {Key: "version", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+}
+
+// Append adds events to the stream and returns the new stream version.
+// expectedVersion is the version the stream must be at, NoStream for a new stream or AnyVersion.
+// Several events are inserted in a transaction, joining the one of the context if any, so a
+// conflicting writer never leaves a stream with part of the events. With AnyVersion the
+// events are appended after the current version, retrying when another writer appends first.
+func (s *Store) Append(ctx context.Context, streamID string, expectedVersion int64, events ...NewEvent) (int64, error) {
+	if len(events) == 0 {
+		return 0, fmt.Errorf("no events to append")
+	}
+	if expectedVersion != AnyVersion {
+		return s.append(ctx, streamID, expectedVersion, events)
+	}
+
+	for attempt := 1; ; attempt++ {
+		current, err := s.Version(ctx, streamID)
+		if err != nil {
+			return 0, err
+		}
+		version, err := s.append(ctx, streamID, current, events)
+		if !errors.Is(err, ErrConcurrencyConflict) || attempt == maxAnyVersionAttempts || mongoclient.TransactionSession(ctx) != nil {
+			return version, err
+		}
+	}
+}
+
+// maxAnyVersionAttempts limits the retries of an AnyVersion append racing other writers
+const maxAnyVersionAttempts = 10
+
+// append inserts the events after the version, the unique streamId+version index rejects them
+// if another writer appended first
+func (s *Store) append(ctx context.Context, streamID string, version int64, events []NewEvent) (int64, error) {
+	docs, err := newEventDocuments(streamID, version, events, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	insert := func(ctx context.Context) (struct{}, error) {
+		_, err := s.events.InsertMany(ctx, docs)
+		return struct{}{}, err
+	}
+	if len(docs) == 1 {
+		_, err = insert(ctx)
+	} else {
+		_, err = mongoclient.WithTransaction(ctx, s.events.Collection().Database().Client(), insert)
+	}
+	if err != nil {
+		return 0, conflictError(err, streamID, version)
+	}
+	return docs[len(docs)-1].Version, nil
+}
+
+// newEventDocuments numbers the events of the stream from the version after the given one
+func newEventDocuments(streamID string, version int64, events []NewEvent, now time.Time) ([]*Event, error) {
+	docs := make([]*Event, len(events))
+	for i, e := range events {
+		t, data, err := bson.MarshalValue(e.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal event %s: %w", e.Type, err)
+		}
+		docs[i] = &Event{
+			ID:         bson.NewObjectID(),
+			StreamID:   streamID,
+			Version:    version + int64(i) + 1,
+			Type:       e.Type,
+			Data:       bson.RawValue{Type: t, Value: data},
+			Metadata:   e.Metadata,
+			RecordedAt: now,
+		}
+	}
+	return docs, nil
+}
+
+// conflictError turns a duplicate streamId+version error into ErrConcurrencyConflict
+func conflictError(err error, streamID string, version int64) error {
+	if mongoclient.IsDuplicateKey(err) {
+		return fmt.Errorf("%w: stream %s, expected version %d", ErrConcurrencyConflict, streamID, version)
+	}
+	return err
+}
+
+// Version returns the current version of the stream, NoStream if it has no events
+func (s *Store) Version(ctx context.Context, streamID string) (int64, error) {
+	last, err := s.events.FindOne(ctx, bson.M{"streamId": streamID},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}).SetProjection(bson.M{"version": 1}))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return NoStream, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stream version: %w", err)
+	}
+	return last.Version, nil
+}
+
+// Load returns events of the stream with a version greater than afterVersion
+func (s *Store) Load(ctx context.Context, streamID string, afterVersion int64) ([]*Event, error) {
+	return s.events.Find(ctx,
+		bson.M{"streamId": streamID, "version": bson.M{"$gt": afterVersion}},
+		options.Find().SetSort(bson.D{{Key: "version", Value: 1}}))
+}
+
+// SubscribeOptions configures Subscribe
+type SubscribeOptions struct {
+	mongoclient.ConsumerOptions
+	// FromStart replays all stored events before live ones when the subscription has no saved position
+	FromStart bool
+}
+
+// Subscribe delivers all appended events in commit order to the handler, at least once.
+// Events replayed with FromStart are ordered per stream only.
+// The position is saved under opts.Name, so a restarted subscription continues where it stopped.
+// Handlers should be idempotent, e.g. by tracking the last handled version of each stream.
+func (s *Store) Subscribe(ctx context.Context, handler func(ctx context.Context, event *Event) error, opts SubscribeOptions) error {
+	if opts.Name == "" {
+		return errors.New("subscription name is required")
+	}
+	consumerOpts := opts.ConsumerOptions
+	consumerOpts.Pipeline = mongoclient.NewChangeFilter().Operations(mongoclient.OperationInsert).Pipeline()
+	consumer := mongoclient.NewConsumer(s.events, func(ctx context.Context, event mongoclient.ChangeEvent[*Event]) error {
+		return handler(ctx, event.FullDocument)
+	}, consumerOpts)
+
+	if opts.FromStart {
+		if err := s.replay(ctx, handler, consumerOpts); err != nil {
+			return err
+		}
+	}
+	return consumer.Run(ctx)
+}
+
+// replay handles stored events of a new subscription stream by stream, in version order.
+// Stored events have no global commit order, so unlike live events, events of different streams
+// are not replayed in the order they were appended. The live position is taken first and saved
+// afterwards, so events appended during the replay are delivered by the consumer.
+func (s *Store) replay(ctx context.Context, handler func(ctx context.Context, event *Event) error, opts mongoclient.ConsumerOptions) error {
+	store := opts.Store
+	if store == nil {
+		store = mongoclient.NewMongoResumeTokenStore(s.events.Collection().Database().Collection(mongoclient.DefaultResumeTokenCollection))
+	}
+	token, err := store.Load(ctx, opts.Name)
+	if err != nil || token != nil {
+		return err
+	}
+
+	stream, err := s.events.Watch(ctx, mongo.Pipeline{})
+	if err != nil {
+		return err
+	}
+	token = stream.ResumeToken()
+	stream.Close(ctx)
+	if token == nil {
+		return fmt.Errorf("failed to get the live position of the events stream")
+	}
+
+	sort := bson.D{{Key: "streamId", Value: 1}, {Key: "version", Value: 1}}
+	cursor, err := s.events.Collection().Find(ctx, bson.M{}, options.Find().SetSort(sort))
+	if err != nil {
+		return fmt.Errorf("failed to execute find: %w", err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var event Event
+		if err = cursor.Decode(&event); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		if err = handler(ctx, &event); err != nil {
+			return fmt.Errorf("failed to handle event: %w", err)
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+
+	return store.Save(ctx, opts.Name, token)
+}
@@ -0,0 +1,148 @@
+package eventstore
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	mongoclient "github.com/inc4/gomongo-client"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestNewEventDocuments(t *testing.T) {
+	now := time.Now()
+	docs, err := newEventDocuments("order-1", 4, []NewEvent{
+		{Type: "created", Data: map[string]int{"n": 1}},
+		{Type: "paid", Data: "ok", Metadata: map[string]string{"user": "a"}},
+	}, now)
+	if err != nil {
+		t.Fatalf("newEventDocuments() error = %v", err)
+	}
+
+	var versions []int64
+	for _, doc := range docs {
+		versions = append(versions, doc.Version)
+		if doc.StreamID != "order-1" || !doc.RecordedAt.Equal(now) || doc.ID.IsZero() {
+			t.Errorf("event = %+v, want the stream, time and an id set", doc)
+		}
+	}
+	if !slices.Equal(versions, []int64{5, 6}) {
+		t.Errorf("versions = %v, want [5 6]", versions)
+	}
+	var data string
+	if err = docs[1].Decode(&data); err != nil || data != "ok" {
+		t.Errorf("Decode() = %q, %v, want ok", data, err)
+	}
+
+	if _, err = newEventDocuments("order-1", 0, []NewEvent{{Type: "bad", Data: make(chan int)}}, now); err == nil {
+		t.Error("newEventDocuments() error = nil, want the marshal error")
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	duplicate := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	other := errors.New("network error")
+
+	tests := []struct {
+		name         string
+		err          error
+		wantConflict bool
+	}{
+		{name: "duplicate key", err: duplicate, wantConflict: true},
+		{name: "classified duplicate key", err: &mongoclient.DuplicateKeyError{Err: duplicate}, wantConflict: true},
+		{
+			name: "duplicate key in a bulk write",
+			err: &mongoclient.BulkWriteErrors{
+				Errors: []mongoclient.BulkWriteItemError{{Index: 1, Code: 11000, Err: &mongoclient.DuplicateKeyError{Err: duplicate}}},
+				Err:    errors.New("bulk write exception"),
+			},
+			wantConflict: true,
+		},
+		{name: "other error", err: fmt.Errorf("failed to insert: %w", other)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := conflictError(tt.err, "order-1", 3)
+			if got := errors.Is(err, ErrConcurrencyConflict); got != tt.wantConflict {
+				t.Errorf("conflictError() = %v, conflict %v, want %v", err, got, tt.wantConflict)
+			}
+			if !tt.wantConflict && !errors.Is(err, other) {
+				t.Errorf("conflictError() = %v, want the error kept", err)
+			}
+		})
+	}
+}
+
+func TestApplyEvents(t *testing.T) {
+	failed := errors.New("invalid transition")
+	reducer := func(state []string, event *Event) ([]string, error) {
+		if event.Type == "bad" {
+			return state, failed
+		}
+		return append(state, event.Type), nil
+	}
+
+	tests := []struct {
+		name        string
+		version     int64
+		events      []*Event
+		want        []string
+		wantVersion int64
+		wantErr     bool
+	}{
+		{name: "no events", version: 3, want: []string{"snapshot"}, wantVersion: 3},
+		{
+			name:        "in version order",
+			version:     3,
+			events:      []*Event{{Type: "a", Version: 4}, {Type: "b", Version: 5}, {Type: "c", Version: 6}},
+			want:        []string{"snapshot", "a", "b", "c"},
+			wantVersion: 6,
+		},
+		{
+			name:    "reducer error",
+			version: 3,
+			events:  []*Event{{Type: "a", Version: 4}, {Type: "bad", Version: 5}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, version, err := applyEvents([]string{"snapshot"}, tt.version, tt.events, reducer)
+			if tt.wantErr {
+				if !errors.Is(err, failed) {
+					t.Fatalf("applyEvents() error = %v, want the reducer error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEvents() error = %v", err)
+			}
+			if !slices.Equal(state, tt.want) || version != tt.wantVersion {
+				t.Errorf("applyEvents() = %v, v%d, want %v, v%d", state, version, tt.want, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestCrossesSnapshot(t *testing.T) {
+	tests := []struct {
+		version, n, every int64
+		want              bool
+	}{
+		{version: 5, n: 1, every: 0, want: false},
+		{version: 9, n: 1, every: 10, want: false},
+		{version: 10, n: 1, every: 10, want: true},
+		{version: 12, n: 3, every: 10, want: true},
+		{version: 13, n: 3, every: 10, want: false},
+		{version: 25, n: 20, every: 10, want: true},
+	}
+	for _, tt := range tests {
+		if got := crossesSnapshot(tt.version, tt.n, tt.every); got != tt.want {
+			t.Errorf("crossesSnapshot(%d, %d, %d) = %v, want %v", tt.version, tt.n, tt.every, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,10 @@ module github.com/inc4/gomongo-client
 
 go 1.24.1
 
-require go.mongodb.org/mongo-driver/v2 v2.4.0
+require (
+	go.mongodb.org/mongo-driver/v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/golang/snappy v1.0.0 // indirect
@@ -0,0 +1,483 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/topology"
+)
+
+var (
+	// ErrBulkheadFull is returned when no concurrency slot was free within the queue timeout
+	ErrBulkheadFull = errors.New("too many concurrent operations")
+	// ErrCircuitOpen is returned while the circuit breaker rejects operations
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets operations through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects operations until the open timeout passes
+	CircuitOpen
+	// CircuitHalfOpen rejects operations while a ping probes the server
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// GuardOptions configures a Guard
+type GuardOptions struct {
+	// MaxConcurrent limits the operations in flight, 100 by default
+	MaxConcurrent int
+	// QueueTimeout is how long an operation waits for a slot, 1s by default
+	QueueTimeout time.Duration
+	// FailureThreshold is the number of consecutive server or network failures that opens the circuit, 5 by default
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before a probe, 10s by default
+	OpenTimeout time.Duration
+	// ProbeTimeout bounds the probing ping, 2s by default
+	ProbeTimeout time.Duration
+	// Ping probes the server in the half-open state, a ping of the primary by default
+	Ping func(ctx context.Context) error
+	// OnStateChange is called after every state transition
+	OnStateChange func(from, to CircuitState)
+}
+
+// GuardMetrics is a snapshot of the guard counters
+type GuardMetrics struct {
+	State               CircuitState
+	InFlight            int64
+	Waiting             int64
+	ConsecutiveFailures int
+	Successes           uint64
+	Failures            uint64
+	// Rejected counts operations that found no free slot in time
+	Rejected uint64
+	// ShortCircuited counts operations rejected by the open circuit
+	ShortCircuited uint64
+}
+
+// Guard protects a deployment from piling up operations: a bulkhead limits concurrent
+// operations, and a circuit breaker fails fast after consecutive server or network failures.
+// A guard may be shared by repositories of the same collection or cluster.
+type Guard struct {
+	opts  GuardOptions
+	slots chan struct{}
+
+	mu                  sync.Mutex
+	state               CircuitState
+	consecutiveFailures int
+	openedAt            time.Time
+
+	inFlight       atomic.Int64
+	waiting        atomic.Int64
+	successes      atomic.Uint64
+	failures       atomic.Uint64
+	rejected       atomic.Uint64
+	shortCircuited atomic.Uint64
+}
+
+// NewGuard creates a guard for operations of the client
+func NewGuard(client *mongo.Client, opts GuardOptions) *Guard {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 100
+	}
+	if opts.QueueTimeout <= 0 {
+		opts.QueueTimeout = time.Second
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = 10 * time.Second
+	}
+	if opts.ProbeTimeout <= 0 {
+		opts.ProbeTimeout = 2 * time.Second
+	}
+	if opts.Ping == nil {
+		opts.Ping = func(ctx context.Context) error { return client.Ping(ctx, nil) }
+	}
+	return &Guard{opts: opts, slots: make(chan struct{}, opts.MaxConcurrent)}
+}
+
+// State returns the circuit state
+func (g *Guard) State() CircuitState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state
+}
+
+// Metrics returns a snapshot of the guard counters
+func (g *Guard) Metrics() GuardMetrics {
+	g.mu.Lock()
+	state, failures := g.state, g.consecutiveFailures
+	g.mu.Unlock()
+
+	return GuardMetrics{
+		State:               state,
+		InFlight:            g.inFlight.Load(),
+		Waiting:             g.waiting.Load(),
+		ConsecutiveFailures: failures,
+		Successes:           g.successes.Load(),
+		Failures:            g.failures.Load(),
+		Rejected:            g.rejected.Load(),
+		ShortCircuited:      g.shortCircuited.Load(),
+	}
+}
+
+// guardContextKey marks contexts of operations already holding a slot of a guard
+type guardContextKey struct{}
+
+// Do runs fn if the circuit is closed and a slot is free within the queue timeout.
+// Calls made with the context passed to fn, like operations in a guarded transaction,
+// reuse its slot and are not counted again.
+func (g *Guard) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if holder, _ := ctx.Value(guardContextKey{}).(*Guard); holder == g {
+		return fn(ctx)
+	}
+	if err := g.allow(); err != nil {
+		g.shortCircuited.Add(1)
+		return err
+	}
+
+	g.waiting.Add(1)
+	timer := time.NewTimer(g.opts.QueueTimeout)
+	select {
+	case g.slots <- struct{}{}:
+		timer.Stop()
+		g.waiting.Add(-1)
+	case <-timer.C:
+		g.waiting.Add(-1)
+		g.rejected.Add(1)
+		return ErrBulkheadFull
+	case <-ctx.Done():
+		timer.Stop()
+		g.waiting.Add(-1)
+		return ctx.Err()
+	}
+
+	err := g.run(context.WithValue(ctx, guardContextKey{}, g), fn)
+	// failures after the caller's context ended say nothing about the deployment
+	if ctx.Err() == nil {
+		g.record(err)
+	}
+	return err
+}
+
+// run calls fn holding a slot, the slot is released even if fn panics
+func (g *Guard) run(ctx context.Context, fn func(ctx context.Context) error) error {
+	g.inFlight.Add(1)
+	defer func() {
+		g.inFlight.Add(-1)
+		<-g.slots
+	}()
+	return fn(ctx)
+}
+
+// allow rejects operations while the circuit is open, and starts a probe
+// once the open timeout has passed
+func (g *Guard) allow() error {
+	g.mu.Lock()
+	switch {
+	case g.state == CircuitClosed:
+		g.mu.Unlock()
+		return nil
+	case g.state == CircuitHalfOpen || time.Since(g.openedAt) < g.opts.OpenTimeout:
+		g.mu.Unlock()
+		return ErrCircuitOpen
+	}
+	g.state = CircuitHalfOpen
+	g.mu.Unlock()
+	g.notify(CircuitOpen, CircuitHalfOpen)
+
+	go g.probe()
+	return ErrCircuitOpen
+}
+
+// probe pings the server and closes the circuit if it answers, it runs in its own
+// goroutine so the operation that triggered it doesn't wait for the ping
+func (g *Guard) probe() {
+	ctx, cancel := context.WithTimeout(context.Background(), g.opts.ProbeTimeout)
+	err := g.opts.Ping(ctx)
+	cancel()
+
+	g.mu.Lock()
+	if err != nil {
+		g.state, g.openedAt = CircuitOpen, time.Now()
+		g.mu.Unlock()
+		g.notify(CircuitHalfOpen, CircuitOpen)
+		return
+	}
+	g.state, g.consecutiveFailures = CircuitClosed, 0
+	g.mu.Unlock()
+	g.notify(CircuitHalfOpen, CircuitClosed)
+}
+
+// record counts the outcome of an operation and opens the circuit after too many failures in a row
+func (g *Guard) record(err error) {
+	if !isGuardFailure(err) {
+		g.successes.Add(1)
+		g.mu.Lock()
+		g.consecutiveFailures = 0
+		g.mu.Unlock()
+		return
+	}
+
+	g.failures.Add(1)
+	g.mu.Lock()
+	g.consecutiveFailures++
+	if g.state != CircuitClosed || g.consecutiveFailures < g.opts.FailureThreshold {
+		g.mu.Unlock()
+		return
+	}
+	g.state, g.openedAt = CircuitOpen, time.Now()
+	g.mu.Unlock()
+	g.notify(CircuitClosed, CircuitOpen)
+}
+
+func (g *Guard) notify(from, to CircuitState) {
+	if g.opts.OnStateChange != nil {
+		g.opts.OnStateChange(from, to)
+	}
+}
+
+// isGuardFailure reports whether the error of an operation whose context is still alive means
+// the deployment is unhealthy. Errors caused by the operation itself like duplicate keys don't
+// count, and of the timeouts only server selection, pool and server side ones do.
+func isGuardFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	// server selection and pool waits end with the deadline the driver puts on their context
+	var sse topology.ServerSelectionError
+	if errors.As(err, &sse) || ClassifyError(err) == ErrorClassPoolTimeout {
+		return true
+	}
+	if isContextError(err) {
+		return false
+	}
+	var se mongo.ServerError
+	if errors.As(err, &se) && se.HasErrorCode(50) { // MaxTimeMSExpired
+		return true
+	}
+	switch ClassifyError(err) {
+	case ErrorClassNetwork, ErrorClassNotPrimary, ErrorClassExceededTimeLimit:
+		return true
+	}
+	return false
+}
+
+// guardCall runs fn through the guard
+func guardCall[R any](ctx context.Context, g *Guard, fn func(ctx context.Context) (R, error)) (R, error) {
+	var result R
+	err := g.Do(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = fn(ctx)
+		return err
+	})
+	return result, err
+}
+
+// GuardedRepository is a decorator of a repository that runs its operations through a Guard.
+// Change streams are not guarded, as they hold no slot for their lifetime.
+type GuardedRepository[T any] struct {
+	IRepository[T]
+	guard *Guard
+}
+
+// NewGuardedRepository wraps the repository with the guard
+func NewGuardedRepository[T any](repo IRepository[T], guard *Guard) *GuardedRepository[T] {
+	return &GuardedRepository[T]{IRepository: repo, guard: guard}
+}
+
+// Guard returns the guard of the repository
+func (r *GuardedRepository[T]) Guard() *Guard {
+	return r.guard
+}
+
+// InsertOne inserts a new document through the guard
+func (r *GuardedRepository[T]) InsertOne(ctx context.Context, document T, opts ...options.Lister[options.InsertOneOptions]) (T, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (T, error) {
+		return r.IRepository.InsertOne(ctx, document, opts...)
+	})
+}
+
+// InsertMany inserts multiple documents through the guard
+func (r *GuardedRepository[T]) InsertMany(ctx context.Context, documents []T, opts ...options.Lister[options.InsertManyOptions]) ([]any, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) ([]any, error) {
+		return r.IRepository.InsertMany(ctx, documents, opts...)
+	})
+}
+
+// Find retrieves multiple documents through the guard
+func (r *GuardedRepository[T]) Find(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) ([]T, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) ([]T, error) {
+		return r.IRepository.Find(ctx, filter, opts...)
+	})
+}
+
+// FindPaginated retrieves a page of documents through the guard
+func (r *GuardedRepository[T]) FindPaginated(ctx context.Context, filter any, page, pageSize int64) ([]T, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) ([]T, error) {
+		return r.IRepository.FindPaginated(ctx, filter, page, pageSize)
+	})
+}
+
+// FindPaginatedWithTotal retrieves a page of documents and the total count through the guard
+func (r *GuardedRepository[T]) FindPaginatedWithTotal(ctx context.Context, filter any, page, pageSize int64) ([]T, int64, error) {
+	var total int64
+	documents, err := guardCall(ctx, r.guard, func(ctx context.Context) ([]T, error) {
+		var (
+			documents []T
+			err       error
+		)
+		documents, total, err = r.IRepository.FindPaginatedWithTotal(ctx, filter, page, pageSize)
+		return documents, err
+	})
+	return documents, total, err
+}
+
+// FindOne retrieves a single document through the guard
+func (r *GuardedRepository[T]) FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) (T, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (T, error) {
+		return r.IRepository.FindOne(ctx, filter, opts...)
+	})
+}
+
+// FindByID finds a document by its ID through the guard
+func (r *GuardedRepository[T]) FindByID(ctx context.Context, id any, opts ...options.Lister[options.FindOneOptions]) (T, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (T, error) {
+		return r.IRepository.FindByID(ctx, id, opts...)
+	})
+}
+
+// FindOneAndUpdate finds a document and updates it through the guard
+func (r *GuardedRepository[T]) FindOneAndUpdate(ctx context.Context, filter, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) (T, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (T, error) {
+		return r.IRepository.FindOneAndUpdate(ctx, filter, update, opts...)
+	})
+}
+
+// FindOneAndUpdateByID finds a document by its ID and updates it through the guard
+func (r *GuardedRepository[T]) FindOneAndUpdateByID(ctx context.Context, id, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) (T, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (T, error) {
+		return r.IRepository.FindOneAndUpdateByID(ctx, id, update, opts...)
+	})
+}
+
+// FindOneAndDelete finds a document and deletes it through the guard
+func (r *GuardedRepository[T]) FindOneAndDelete(ctx context.Context, filter any, opts ...options.Lister[options.FindOneAndDeleteOptions]) (T, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (T, error) {
+		return r.IRepository.FindOneAndDelete(ctx, filter, opts...)
+	})
+}
+
+// UpdateOne updates a single document through the guard
+func (r *GuardedRepository[T]) UpdateOne(ctx context.Context, filter, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (*mongo.UpdateResult, error) {
+		return r.IRepository.UpdateOne(ctx, filter, update, opts...)
+	})
+}
+
+// UpdateByID updates a document by its ID through the guard
+func (r *GuardedRepository[T]) UpdateByID(ctx context.Context, id any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (*mongo.UpdateResult, error) {
+		return r.IRepository.UpdateByID(ctx, id, update, opts...)
+	})
+}
+
+// UpdateMany updates multiple documents through the guard
+func (r *GuardedRepository[T]) UpdateMany(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateManyOptions]) (*mongo.UpdateResult, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (*mongo.UpdateResult, error) {
+		return r.IRepository.UpdateMany(ctx, filter, update, opts...)
+	})
+}
+
+// DeleteOne removes a single document through the guard
+func (r *GuardedRepository[T]) DeleteOne(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) error {
+	return r.guard.Do(ctx, func(ctx context.Context) error {
+		return r.IRepository.DeleteOne(ctx, filter, opts...)
+	})
+}
+
+// DeleteByID removes a document by its ID through the guard
+func (r *GuardedRepository[T]) DeleteByID(ctx context.Context, id any, opts ...options.Lister[options.DeleteOneOptions]) error {
+	return r.guard.Do(ctx, func(ctx context.Context) error {
+		return r.IRepository.DeleteByID(ctx, id, opts...)
+	})
+}
+
+// DeleteMany removes multiple documents through the guard
+func (r *GuardedRepository[T]) DeleteMany(ctx context.Context, filter any, opts ...options.Lister[options.DeleteManyOptions]) (int64, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (int64, error) {
+		return r.IRepository.DeleteMany(ctx, filter, opts...)
+	})
+}
+
+// EstimatedCount returns the estimated number of documents through the guard
+func (r *GuardedRepository[T]) EstimatedCount(ctx context.Context, opts ...options.Lister[options.EstimatedDocumentCountOptions]) (int64, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (int64, error) {
+		return r.IRepository.EstimatedCount(ctx, opts...)
+	})
+}
+
+// CountDocuments counts matching documents through the guard
+func (r *GuardedRepository[T]) CountDocuments(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (int64, error) {
+		return r.IRepository.CountDocuments(ctx, filter, opts...)
+	})
+}
+
+// Aggregate runs an aggregation pipeline through the guard
+func (r *GuardedRepository[T]) Aggregate(ctx context.Context, pipeline any, opts ...options.Lister[options.AggregateOptions]) ([]bson.M, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) ([]bson.M, error) {
+		return r.IRepository.Aggregate(ctx, pipeline, opts...)
+	})
+}
+
+// AggregateTyped runs an aggregation pipeline decoding results into T through the guard
+func (r *GuardedRepository[T]) AggregateTyped(ctx context.Context, pipeline any, opts ...options.Lister[options.AggregateOptions]) ([]T, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) ([]T, error) {
+		return r.IRepository.AggregateTyped(ctx, pipeline, opts...)
+	})
+}
+
+// Distinct returns the distinct values of a field through the guard
+func (r *GuardedRepository[T]) Distinct(ctx context.Context, fieldName string, filter any, opts ...options.Lister[options.DistinctOptions]) ([]any, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) ([]any, error) {
+		return r.IRepository.Distinct(ctx, fieldName, filter, opts...)
+	})
+}
+
+// BulkWrite executes bulk write operations through the guard
+func (r *GuardedRepository[T]) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...options.Lister[options.BulkWriteOptions]) (*mongo.BulkWriteResult, error) {
+	return guardCall(ctx, r.guard, func(ctx context.Context) (*mongo.BulkWriteResult, error) {
+		return r.IRepository.BulkWrite(ctx, models, opts...)
+	})
+}
+
+// Transaction runs the function in a transaction through the guard
+func (r *GuardedRepository[T]) Transaction(ctx context.Context, fn func(sessCtx context.Context) error, opts ...options.Lister[options.SessionOptions]) error {
+	return r.guard.Do(ctx, func(ctx context.Context) error {
+		return r.IRepository.Transaction(ctx, fn, opts...)
+	})
+}
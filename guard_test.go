@@ -0,0 +1,128 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/topology"
+)
+
+func TestIsGuardFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "plain error", err: errors.New("boom"), want: false},
+		{name: "duplicate key", err: mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "client side timeout", err: fmt.Errorf("find: %w", context.DeadlineExceeded), want: false},
+		{name: "pool timeout", err: topology.WaitQueueTimeoutError{Wrapped: context.DeadlineExceeded}, want: true},
+		{name: "server selection timeout", err: topology.ServerSelectionError{Wrapped: context.DeadlineExceeded}, want: true},
+		{name: "max time expired", err: mongo.CommandError{Code: 50}, want: true},
+		{name: "exceeded time limit", err: mongo.CommandError{Code: 262}, want: true},
+		{name: "not primary", err: mongo.CommandError{Code: 10107}, want: true},
+		{name: "network", err: mongo.CommandError{Labels: []string{"NetworkError"}}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isGuardFailure(tt.err); got != tt.want {
+				t.Errorf("isGuardFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestGuard(ping func(ctx context.Context) error) *Guard {
+	return NewGuard(nil, GuardOptions{
+		MaxConcurrent:    1,
+		QueueTimeout:     10 * time.Millisecond,
+		FailureThreshold: 1,
+		OpenTimeout:      time.Millisecond,
+		Ping:             ping,
+	})
+}
+
+func TestGuardReleasesSlotOnPanic(t *testing.T) {
+	g := newTestGuard(nil)
+	func() {
+		defer func() { _ = recover() }()
+		_ = g.Do(context.Background(), func(ctx context.Context) error { panic("boom") })
+	}()
+
+	if got := g.Metrics().InFlight; got != 0 {
+		t.Errorf("InFlight = %d, want 0", got)
+	}
+	if err := g.Do(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("Do() after panic = %v, want the slot released", err)
+	}
+}
+
+func TestGuardIgnoresCallerDeadline(t *testing.T) {
+	g := newTestGuard(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := g.Do(ctx, func(ctx context.Context) error {
+		cancel()
+		return topology.ServerSelectionError{Wrapped: ctx.Err()}
+	})
+	if err == nil {
+		t.Fatal("Do() = nil, want the selection error")
+	}
+	if m := g.Metrics(); m.State != CircuitClosed || m.Failures != 0 {
+		t.Errorf("metrics = %+v, want the failure not counted", m)
+	}
+}
+
+func TestGuardNestedCalls(t *testing.T) {
+	g := newTestGuard(nil)
+	err := g.Do(context.Background(), func(ctx context.Context) error {
+		return g.Do(ctx, func(ctx context.Context) error { return nil })
+	})
+	if err != nil {
+		t.Fatalf("nested Do() = %v, want it to reuse the slot", err)
+	}
+	if m := g.Metrics(); m.Successes != 1 || m.Rejected != 0 {
+		t.Errorf("metrics = %+v, want one success", m)
+	}
+}
+
+func TestGuardProbe(t *testing.T) {
+	pinged := make(chan struct{})
+	release := make(chan struct{})
+	g := newTestGuard(func(ctx context.Context) error {
+		close(pinged)
+		<-release
+		return nil
+	})
+
+	failure := mongo.CommandError{Labels: []string{"NetworkError"}}
+	var ce mongo.CommandError
+	if err := g.Do(context.Background(), func(ctx context.Context) error { return failure }); !errors.As(err, &ce) {
+		t.Fatalf("Do() = %v, want the failure", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	// the operation that starts the probe is rejected without waiting for the ping
+	if err := g.Do(context.Background(), func(ctx context.Context) error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Do() = %v, want ErrCircuitOpen", err)
+	}
+	<-pinged
+	if got := g.State(); got != CircuitHalfOpen {
+		t.Errorf("State() = %v, want half-open", got)
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for g.State() != CircuitClosed && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := g.State(); got != CircuitClosed {
+		t.Errorf("State() = %v, want closed after a successful probe", got)
+	}
+}
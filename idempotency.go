@@ -0,0 +1,287 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const DefaultIdempotencyCollection = "idempotency_keys"
+
+const (
+	idempotencyPending   = "pending"
+	idempotencyCompleted = "completed"
+)
+
+// ErrIdempotencyKeyLost is returned when the lock of the key expired and another call took it over
+// while fn ran, or the key was removed before the result was stored
+var ErrIdempotencyKeyLost = errors.New("idempotency key lock lost")
+
+// idempotencyKey is the context key of the idempotency key
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context carrying the idempotency key of the request
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the idempotency key of the context
+func IdempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKey{}).(string)
+	return key, ok && key != ""
+}
+
+// IdempotencyOptions configures an IdempotencyStore
+type IdempotencyOptions struct {
+	// TTL is how long results are kept and replayed, 24h by default
+	TTL time.Duration
+	// LockTTL is how long a call holds the key without renewal before another call may take it over,
+	// 30s by default. The lock is renewed every third of it while the call runs.
+	LockTTL time.Duration
+	// PollInterval is the pause between checks while another call with the same key runs, 100ms by default
+	PollInterval time.Duration
+}
+
+// idempotencyRecord is the stored state of an idempotency key
+type idempotencyRecord struct {
+	ID          string    `bson:"_id"`
+	Status      string    `bson:"status"`
+	Owner       string    `bson:"owner"`
+	Result      bson.Raw  `bson:"result,omitempty"`
+	LockedUntil time.Time `bson:"lockedUntil"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+// idempotentResult wraps results, so any type can be stored as a document
+type idempotentResult[R any] struct {
+	Value R `bson:"value"`
+}
+
+// IdempotencyStore keeps the first successful result of writes per idempotency key,
+// so retried requests replay it instead of writing again
+type IdempotencyStore struct {
+	collection *mongo.Collection
+	opts       IdempotencyOptions
+}
+
+// NewIdempotencyStore creates an idempotency store in the database
+func NewIdempotencyStore(db *mongo.Database, opts IdempotencyOptions) *IdempotencyStore {
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = 30 * time.Second
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 100 * time.Millisecond
+	}
+	return &IdempotencyStore{collection: db.Collection(DefaultIdempotencyCollection), opts: opts}
+}
+
+// EnsureIndexes creates the TTL index that removes expired keys
+func (s *IdempotencyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+	return nil
+}
+
+// Idempotent runs fn once per idempotency key of the context and scope, and replays its first
+// successful result afterwards. Calls with the same key wait while one of them runs.
+// Failed calls release the key, so they can be retried. Without a key in the context fn just runs.
+//
+// The lock on the key is renewed while fn runs, and fn's context is canceled with ErrIdempotencyKeyLost
+// as the cause if that fails. fn's writes and the stored result are only atomic when Idempotent runs
+// within a transaction: the key is then claimed and the result stored in it, so they commit or abort
+// together with fn's writes. Otherwise a crash between fn and storing the result runs fn again on retry.
+func Idempotent[R any](ctx context.Context, store *IdempotencyStore, scope string, fn func(ctx context.Context) (R, error)) (R, error) {
+	var zero R
+	key, ok := IdempotencyKeyFromContext(ctx)
+	if !ok {
+		return fn(ctx)
+	}
+	id := scope + ":" + key
+	owner := bson.NewObjectID().Hex()
+
+	var lockedUntil time.Time
+	for {
+		record, until, err := store.claim(ctx, id, owner)
+		if err != nil {
+			return zero, err
+		}
+		if record == nil && !until.IsZero() {
+			lockedUntil = until
+			break
+		}
+		if result, done, err := storedResult[R](record); done || err != nil {
+			return result, err
+		}
+
+		// another call holds the key
+		select {
+		case <-time.After(store.opts.PollInterval):
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	}
+
+	// In a transaction the claim isn't visible to other calls until commit, so it needs no renewal.
+	fnCtx, stop := ctx, func() {}
+	if TransactionSession(ctx) == nil {
+		fnCtx, stop = store.hold(ctx, id, owner, lockedUntil)
+	}
+
+	// the key is not passed down, so repository calls inside fn write as usual
+	result, err := fn(WithIdempotencyKey(fnCtx, ""))
+	stop()
+	if err != nil {
+		_, _ = store.collection.DeleteOne(context.WithoutCancel(ctx), bson.M{"_id": id, "owner": owner})
+		return zero, err
+	}
+	if cause := context.Cause(fnCtx); errors.Is(cause, ErrIdempotencyKeyLost) {
+		return zero, fmt.Errorf("failed to store result of %s: %w", id, cause)
+	}
+
+	raw, err := bson.Marshal(idempotentResult[R]{Value: result})
+	if err != nil {
+		return zero, fmt.Errorf("failed to encode result of %s: %w", id, err)
+	}
+	res, err := store.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "owner": owner},
+		bson.M{"$set": bson.M{
+			"status":    idempotencyCompleted,
+			"result":    bson.Raw(raw),
+			"expiresAt": time.Now().Add(store.opts.TTL),
+		}})
+	if err != nil {
+		return zero, fmt.Errorf("failed to store result of %s: %w", id, err)
+	}
+	if res.MatchedCount == 0 {
+		return zero, fmt.Errorf("failed to store result of %s: %w", id, ErrIdempotencyKeyLost)
+	}
+	return result, nil
+}
+
+// storedResult returns the result of a completed record, done is false if there is none yet
+func storedResult[R any](record *idempotencyRecord) (R, bool, error) {
+	var result idempotentResult[R]
+	if record == nil || record.Status != idempotencyCompleted {
+		return result.Value, false, nil
+	}
+	if err := bson.Unmarshal(record.Result, &result); err != nil {
+		var zero R
+		return zero, false, fmt.Errorf("failed to decode stored result of %s: %w", record.ID, err)
+	}
+	return result.Value, true, nil
+}
+
+// claim takes the key if it's new or its holder's lock expired, and returns when the lock expires.
+// Otherwise it returns the current record, nil if it was removed in between.
+func (s *IdempotencyStore) claim(ctx context.Context, id, owner string) (*idempotencyRecord, time.Time, error) {
+	now := time.Now()
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": idempotencyPending, "lockedUntil": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{
+			"status":      idempotencyPending,
+			"owner":       owner,
+			"lockedUntil": now.Add(s.opts.LockTTL),
+			"expiresAt":   now.Add(s.opts.TTL),
+		}},
+		options.UpdateOne().SetUpsert(true))
+	if err == nil {
+		return nil, now.Add(s.opts.LockTTL), nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, time.Time{}, fmt.Errorf("failed to claim idempotency key %s: %w", id, err)
+	}
+
+	var record idempotencyRecord
+	err = s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to load idempotency key %s: %w", id, err)
+	}
+	return &record, time.Time{}, nil
+}
+
+// hold renews the lock of the key in the background until stop is called. The returned context
+// is canceled with ErrIdempotencyKeyLost when the lock was taken over or was not renewed one
+// interval before it expires.
+func (s *IdempotencyStore) hold(ctx context.Context, id, owner string, lockedUntil time.Time) (context.Context, func()) {
+	holdCtx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.renew(holdCtx, cancel, id, owner, lockedUntil)
+	}()
+	return holdCtx, func() {
+		// fn has returned, so a later loss of the lock doesn't affect it
+		cancel(context.Canceled)
+		<-done
+	}
+}
+
+// renew extends the lock every third of LockTTL, like the migration and lock leases
+func (s *IdempotencyStore) renew(ctx context.Context, cancel context.CancelCauseFunc, id, owner string, lockedUntil time.Time) {
+	interval := renewInterval(s.opts.LockTTL)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		renewDeadline := lockedUntil.Add(-interval)
+		deadline := time.NewTimer(time.Until(renewDeadline))
+		select {
+		case <-ctx.Done():
+			deadline.Stop()
+			return
+		case <-deadline.C:
+			cancel(ErrIdempotencyKeyLost)
+			return
+		case <-ticker.C:
+			deadline.Stop()
+		}
+
+		// The new expiry is measured from when the request was sent, not when it returned.
+		sent := time.Now()
+		renewCtx, cancelRenew := context.WithDeadline(ctx, renewDeadline)
+		res, err := s.collection.UpdateOne(renewCtx,
+			bson.M{"_id": id, "owner": owner, "status": idempotencyPending},
+			bson.M{"$set": bson.M{"lockedUntil": sent.Add(s.opts.LockTTL)}})
+		cancelRenew()
+
+		if err == nil && res.MatchedCount == 0 {
+			cancel(ErrIdempotencyKeyLost)
+			return
+		}
+		if err == nil {
+			lockedUntil = sent.Add(s.opts.LockTTL)
+		}
+	}
+}
+
+// UseIdempotency makes InsertOne and FindOneAndUpdate of the repository idempotent
+// when the context carries an idempotency key
+func (r *Repository[T]) UseIdempotency(store *IdempotencyStore) *Repository[T] {
+	r.idempotency = store
+	return r
+}
+
+// idempotent reports whether the call must go through the idempotency store
+func (r *Repository[T]) idempotent(ctx context.Context) bool {
+	if r.idempotency == nil {
+		return false
+	}
+	_, ok := IdempotencyKeyFromContext(ctx)
+	return ok
+}
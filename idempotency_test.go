@@ -0,0 +1,119 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestStoredResult(t *testing.T) {
+	type order struct {
+		ID    string `bson:"id"`
+		Total int    `bson:"total"`
+	}
+	encode := func(v any) bson.Raw {
+		raw, err := bson.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	tests := []struct {
+		name     string
+		record   *idempotencyRecord
+		want     order
+		wantDone bool
+		wantErr  bool
+	}{
+		{name: "removed meanwhile"},
+		{name: "pending", record: &idempotencyRecord{ID: "s:k", Status: idempotencyPending}},
+		{
+			name:     "completed",
+			record:   &idempotencyRecord{ID: "s:k", Status: idempotencyCompleted, Result: encode(idempotentResult[order]{Value: order{ID: "o1", Total: 5}})},
+			want:     order{ID: "o1", Total: 5},
+			wantDone: true,
+		},
+		{
+			name:    "result of another type",
+			record:  &idempotencyRecord{ID: "s:k", Status: idempotencyCompleted, Result: encode(bson.M{"value": "text"})},
+			wantErr: true,
+		},
+		{
+			name:    "corrupted result",
+			record:  &idempotencyRecord{ID: "s:k", Status: idempotencyCompleted, Result: bson.Raw{1, 2, 3}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, done, err := storedResult[order](tt.record)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("storedResult() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || done != tt.wantDone {
+				t.Errorf("storedResult() = %+v, %v, want %+v, %v", got, done, tt.want, tt.wantDone)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreHold(t *testing.T) {
+	lockTTL := 150 * time.Millisecond
+	store := NewIdempotencyStore(testDatabase(t), IdempotencyOptions{LockTTL: lockTTL})
+
+	tests := []struct {
+		name      string
+		stopAfter time.Duration
+		wantCause error
+	}{
+		// Renewals fail against the unreachable database, so the lock is given up before it expires.
+		{name: "renewal fails", wantCause: ErrIdempotencyKeyLost},
+		{name: "stopped by the call", stopAfter: 10 * time.Millisecond, wantCause: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			ctx, stop := store.hold(context.Background(), "s:k", "owner", start.Add(lockTTL))
+			defer stop()
+			if tt.stopAfter > 0 {
+				time.Sleep(tt.stopAfter)
+				stop()
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("hold context wasn't canceled")
+			}
+			if cause := context.Cause(ctx); !errors.Is(cause, tt.wantCause) {
+				t.Errorf("cause = %v, want %v", cause, tt.wantCause)
+			}
+			if elapsed := time.Since(start); elapsed >= lockTTL {
+				t.Errorf("canceled after %v, want before the %v lock expired", elapsed, lockTTL)
+			}
+		})
+	}
+}
+
+func TestIdempotentWithoutKey(t *testing.T) {
+	calls := 0
+	fn := func(ctx context.Context) (int, error) {
+		calls++
+		return calls, nil
+	}
+	store := NewIdempotencyStore(testDatabase(t), IdempotencyOptions{})
+	for range 2 {
+		if _, err := Idempotent(context.Background(), store, "orders", fn); err != nil {
+			t.Fatalf("Idempotent() error = %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("fn calls = %d, want 2: without a key every call runs", calls)
+	}
+}
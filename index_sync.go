@@ -0,0 +1,567 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// IndexSyncMode controls what SyncIndexes does with the computed plan
+type IndexSyncMode int
+
+const (
+	// IndexSyncDryRun only computes the plan, nothing is changed
+	IndexSyncDryRun IndexSyncMode = iota
+	// IndexSyncApply executes the plan, stale indexes are dropped
+	IndexSyncApply
+	// IndexSyncApplyHidden executes the plan, but stale indexes are hidden instead of dropped,
+	// so they can be unhidden if the rollout goes wrong
+	IndexSyncApplyHidden
+)
+
+// IndexAction is a single kind of change in an index plan
+type IndexAction string
+
+const (
+	IndexActionCreate   IndexAction = "create"
+	IndexActionDrop     IndexAction = "drop"
+	IndexActionRebuild  IndexAction = "rebuild"
+	IndexActionConflict IndexAction = "conflict"
+	// IndexActionHide and IndexActionUnhide change only the hidden flag of an index
+	IndexActionHide   IndexAction = "hide"
+	IndexActionUnhide IndexAction = "unhide"
+)
+
+// IndexSyncOptions configures SyncIndexes
+type IndexSyncOptions struct {
+	// Output receives the plan in dry-run mode, it's discarded by default
+	// as the plan is returned as well
+	Output io.Writer
+}
+
+// IndexPlanItem describes one change required to bring the collection indexes in sync
+type IndexPlanItem struct {
+	Action IndexAction
+	Name   string
+	Keys   bson.D
+	Reason string
+	// Model is the desired index, nil for drops
+	Model *mongo.IndexModel
+
+	// previous is the specification of the rebuilt index, restored if the rebuild fails
+	previous bson.Raw
+}
+
+// IndexPlan is the list of changes computed by SyncIndexes
+type IndexPlan struct {
+	Collection string
+	Items      []IndexPlanItem
+}
+
+// HasConflicts reports whether the plan contains changes that can't be applied automatically
+func (p *IndexPlan) HasConflicts() bool {
+	for _, item := range p.Items {
+		if item.Action == IndexActionConflict {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the plan in a human-readable form
+func (p *IndexPlan) String() string {
+	if len(p.Items) == 0 {
+		return fmt.Sprintf("%s: indexes are in sync\n", p.Collection)
+	}
+	var b strings.Builder
+	for _, item := range p.Items {
+		fmt.Fprintf(&b, "%s: %-8s %s %s", p.Collection, item.Action, item.Name, formatIndexKeys(item.Keys))
+		if item.Reason != "" {
+			fmt.Fprintf(&b, " (%s)", item.Reason)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// existingIndex is the subset of listIndexes output used to compare indexes
+type existingIndex struct {
+	Name                    string   `bson:"name"`
+	Key                     bson.D   `bson:"key"`
+	Unique                  bool     `bson:"unique,omitempty"`
+	Sparse                  bool     `bson:"sparse,omitempty"`
+	Hidden                  bool     `bson:"hidden,omitempty"`
+	ExpireAfterSeconds      *int64   `bson:"expireAfterSeconds,omitempty"`
+	PartialFilterExpression bson.Raw `bson:"partialFilterExpression,omitempty"`
+	Weights                 bson.D   `bson:"weights,omitempty"`
+
+	// spec is the full listIndexes entry
+	spec bson.Raw
+}
+
+// desiredIndex is a normalized form of mongo.IndexModel
+type desiredIndex struct {
+	model   mongo.IndexModel
+	name    string
+	keys    bson.D
+	options *options.IndexOptions
+}
+
+// SyncIndexes compares the collection indexes with the desired ones and returns the plan.
+// In dry-run mode the plan is only computed and written to the options output.
+// In apply modes the plan is executed, unless it contains conflicts.
+func (r *Repository[T]) SyncIndexes(ctx context.Context, desired []mongo.IndexModel, mode IndexSyncMode, opts ...IndexSyncOptions) (*IndexPlan, error) {
+	var o IndexSyncOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Output == nil {
+		o.Output = io.Discard
+	}
+
+	existing, err := r.listExistingIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planIndexes(r.collection.Name(), existing, desired)
+	if err != nil {
+		return nil, err
+	}
+	if mode == IndexSyncDryRun {
+		if _, err = io.WriteString(o.Output, plan.String()); err != nil {
+			return plan, fmt.Errorf("failed to print index plan: %w", err)
+		}
+		return plan, nil
+	}
+	if plan.HasConflicts() {
+		return plan, fmt.Errorf("index plan for %s has conflicts, resolve them manually", plan.Collection)
+	}
+	return plan, r.applyIndexPlan(ctx, plan, mode)
+}
+
+// planIndexes computes the changes turning the existing indexes into the desired ones
+func planIndexes(collection string, existing []existingIndex, desired []mongo.IndexModel) (*IndexPlan, error) {
+	plan := &IndexPlan{Collection: collection}
+	matched := make(map[string]bool, len(existing))
+
+	for _, model := range desired {
+		want, err := normalizeIndexModel(model)
+		if err != nil {
+			return nil, err
+		}
+
+		var sameKeys, sameName *existingIndex
+		for i := range existing {
+			if indexKeysEqual(existing[i].Key, want.keys) {
+				sameKeys = &existing[i]
+			}
+			if existing[i].Name == want.name {
+				sameName = &existing[i]
+			}
+		}
+
+		switch {
+		case sameName != nil && !indexKeysEqual(sameName.Key, want.keys):
+			matched[sameName.Name] = true
+			plan.Items = append(plan.Items, IndexPlanItem{
+				Action: IndexActionConflict,
+				Name:   want.name,
+				Keys:   want.keys,
+				Reason: fmt.Sprintf("index name is already used with keys %s", formatIndexKeys(sameName.Key)),
+				Model:  &want.model,
+			})
+		case sameKeys == nil:
+			plan.Items = append(plan.Items, IndexPlanItem{
+				Action: IndexActionCreate,
+				Name:   want.name,
+				Keys:   want.keys,
+				Model:  &want.model,
+			})
+		default:
+			matched[sameKeys.Name] = true
+			if diff := diffIndexOptions(sameKeys, want); diff != "" {
+				plan.Items = append(plan.Items, IndexPlanItem{
+					Action:   IndexActionRebuild,
+					Name:     sameKeys.Name,
+					Keys:     want.keys,
+					Reason:   diff,
+					Model:    &want.model,
+					previous: sameKeys.spec,
+				})
+				continue
+			}
+			if wantHidden := want.options.Hidden != nil && *want.options.Hidden; sameKeys.Hidden != wantHidden {
+				action := IndexActionUnhide
+				if wantHidden {
+					action = IndexActionHide
+				}
+				plan.Items = append(plan.Items, IndexPlanItem{
+					Action: action,
+					Name:   sameKeys.Name,
+					Keys:   want.keys,
+					Model:  &want.model,
+				})
+			}
+		}
+	}
+
+	for _, idx := range existing {
+		if idx.Name == "_id_" || matched[idx.Name] {
+			continue
+		}
+		plan.Items = append(plan.Items, IndexPlanItem{
+			Action: IndexActionDrop,
+			Name:   idx.Name,
+			Keys:   idx.Key,
+			Reason: "not declared",
+		})
+	}
+
+	return plan, nil
+}
+
+func (r *Repository[T]) applyIndexPlan(ctx context.Context, plan *IndexPlan, mode IndexSyncMode) error {
+	indexes := r.collection.Indexes()
+	for _, item := range plan.Items {
+		switch item.Action {
+		case IndexActionCreate:
+			if _, err := indexes.CreateOne(ctx, *item.Model); err != nil {
+				return fmt.Errorf("failed to create index %s: %w", item.Name, err)
+			}
+		case IndexActionRebuild:
+			// The server rejects two indexes with the same keys, so the old index is dropped
+			// first and restored from its specification if the new one can't be built.
+			if err := indexes.DropOne(ctx, item.Name); err != nil {
+				return fmt.Errorf("failed to drop index %s: %w", item.Name, err)
+			}
+			if _, err := indexes.CreateOne(ctx, *item.Model); err != nil {
+				if restoreErr := r.restoreIndex(ctx, item.previous); restoreErr != nil {
+					return fmt.Errorf("failed to create index %s: %w (and to restore the old index: %v)", item.Name, err, restoreErr)
+				}
+				return fmt.Errorf("failed to create index %s, the old index was restored: %w", item.Name, err)
+			}
+		case IndexActionHide, IndexActionUnhide:
+			if err := r.setIndexHidden(ctx, item.Name, item.Action == IndexActionHide); err != nil {
+				return err
+			}
+		case IndexActionDrop:
+			if mode == IndexSyncApplyHidden {
+				if err := r.setIndexHidden(ctx, item.Name, true); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := indexes.DropOne(ctx, item.Name); err != nil {
+				return fmt.Errorf("failed to drop index %s: %w", item.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setIndexHidden hides or unhides an index with collMod
+func (r *Repository[T]) setIndexHidden(ctx context.Context, name string, hidden bool) error {
+	cmd := bson.D{
+		{Key: "collMod", Value: r.collection.Name()},
+		{Key: "index", Value: bson.D{{Key: "name", Value: name}, {Key: "hidden", Value: hidden}}},
+	}
+	if err := r.collection.Database().RunCommand(ctx, cmd).Err(); err != nil {
+		return fmt.Errorf("failed to set hidden=%t on index %s: %w", hidden, name, err)
+	}
+	return nil
+}
+
+// restoreIndex recreates an index from its listIndexes specification
+func (r *Repository[T]) restoreIndex(ctx context.Context, spec bson.Raw) error {
+	if spec == nil {
+		return errors.New("no specification of the old index")
+	}
+	var index bson.D
+	if err := bson.Unmarshal(spec, &index); err != nil {
+		return fmt.Errorf("failed to decode index specification: %w", err)
+	}
+	index = slices.DeleteFunc(index, func(e bson.E) bool { return e.Key == "ns" })
+
+	cmd := bson.D{
+		{Key: "createIndexes", Value: r.collection.Name()},
+		{Key: "indexes", Value: bson.A{index}},
+	}
+	return r.collection.Database().RunCommand(ctx, cmd).Err()
+}
+
+func (r *Repository[T]) listExistingIndexes(ctx context.Context) ([]existingIndex, error) {
+	cursor, err := r.collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []existingIndex
+	for cursor.Next(ctx) {
+		var idx existingIndex
+		if err = cursor.Decode(&idx); err != nil {
+			return nil, fmt.Errorf("failed to decode indexes: %w", err)
+		}
+		idx.spec = slices.Clone(cursor.Current)
+		idx.Key = textIndexKeys(idx.Key, idx.Weights)
+		results = append(results, idx)
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to decode indexes: %w", err)
+	}
+	return results, nil
+}
+
+// textIndexKeys turns the keys of a text index as stored by the server,
+// e.g. {_fts: "text", _ftsx: 1}, back into the declared form, e.g. {body: "text", title: "text"}
+func textIndexKeys(keys, weights bson.D) bson.D {
+	i := slices.IndexFunc(keys, func(e bson.E) bool { return e.Key == "_fts" })
+	if i < 0 {
+		return keys
+	}
+	fields := make(bson.D, len(weights))
+	for j, w := range weights {
+		fields[j] = bson.E{Key: w.Key, Value: "text"}
+	}
+	sortTextFields(fields)
+
+	result := slices.Clone(keys[:i])
+	result = append(result, fields...)
+	for _, k := range keys[i+1:] {
+		if k.Key != "_ftsx" {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+// sortTextFields orders the text fields of index keys by name, the server ignores their order
+func sortTextFields(keys bson.D) {
+	start := slices.IndexFunc(keys, isTextKey)
+	if start < 0 {
+		return
+	}
+	end := start
+	for end < len(keys) && isTextKey(keys[end]) {
+		end++
+	}
+	slices.SortFunc(keys[start:end], func(a, b bson.E) int { return strings.Compare(a.Key, b.Key) })
+}
+
+func isTextKey(e bson.E) bool {
+	return e.Value == "text"
+}
+
+func normalizeIndexModel(model mongo.IndexModel) (desiredIndex, error) {
+	raw, err := bson.Marshal(model.Keys)
+	if err != nil {
+		return desiredIndex{}, fmt.Errorf("failed to marshal index keys: %w", err)
+	}
+	var keys bson.D
+	if err = bson.Unmarshal(raw, &keys); err != nil {
+		return desiredIndex{}, fmt.Errorf("failed to unmarshal index keys: %w", err)
+	}
+
+	opts := &options.IndexOptions{}
+	if model.Options != nil {
+		for _, set := range model.Options.List() {
+			if err = set(opts); err != nil {
+				return desiredIndex{}, fmt.Errorf("failed to apply index options: %w", err)
+			}
+		}
+	}
+
+	name := defaultIndexName(keys)
+	if opts.Name != nil {
+		name = *opts.Name
+	}
+	keys = slices.Clone(keys)
+	sortTextFields(keys)
+	return desiredIndex{model: model, name: name, keys: keys, options: opts}, nil
+}
+
+// defaultIndexName generates the same name the server would, e.g. "email_1_age_-1"
+func defaultIndexName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		parts = append(parts, k.Key, fmt.Sprint(k.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func indexKeysEqual(a, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key || normalizeIndexValue(a[i].Value) != normalizeIndexValue(b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeIndexValue makes 1, int64(1) and 1.0 compare equal
+func normalizeIndexValue(v any) string {
+	switch n := v.(type) {
+	case int32:
+		return fmt.Sprint(float64(n))
+	case int64:
+		return fmt.Sprint(float64(n))
+	case int:
+		return fmt.Sprint(float64(n))
+	case float64:
+		return fmt.Sprint(n)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// diffIndexOptions returns a description of the option differences, or an empty string
+func diffIndexOptions(have *existingIndex, want desiredIndex) string {
+	var diffs []string
+	opts := want.options
+
+	if wantUnique := opts.Unique != nil && *opts.Unique; have.Unique != wantUnique {
+		diffs = append(diffs, fmt.Sprintf("unique %t -> %t", have.Unique, wantUnique))
+	}
+	if wantSparse := opts.Sparse != nil && *opts.Sparse; have.Sparse != wantSparse {
+		diffs = append(diffs, fmt.Sprintf("sparse %t -> %t", have.Sparse, wantSparse))
+	}
+
+	var haveTTL, wantTTL int64 = -1, -1
+	if have.ExpireAfterSeconds != nil {
+		haveTTL = *have.ExpireAfterSeconds
+	}
+	if opts.ExpireAfterSeconds != nil {
+		wantTTL = int64(*opts.ExpireAfterSeconds)
+	}
+	if haveTTL != wantTTL {
+		diffs = append(diffs, fmt.Sprintf("expireAfterSeconds %d -> %d", haveTTL, wantTTL))
+	}
+
+	havePartial, err := canonicalDocument(have.PartialFilterExpression)
+	if err != nil {
+		return fmt.Sprintf("invalid partialFilterExpression: %v", err)
+	}
+	wantPartial, err := canonicalDocument(opts.PartialFilterExpression)
+	if err != nil {
+		return fmt.Sprintf("invalid partialFilterExpression: %v", err)
+	}
+	if havePartial != wantPartial {
+		diffs = append(diffs, "partialFilterExpression changed")
+	}
+
+	if slices.ContainsFunc(want.keys, isTextKey) {
+		if diff := diffTextWeights(have.Weights, want); diff != "" {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	if opts.Name != nil && *opts.Name != have.Name {
+		diffs = append(diffs, fmt.Sprintf("name %s -> %s", have.Name, *opts.Name))
+	}
+
+	return strings.Join(diffs, ", ")
+}
+
+// canonicalDocument returns the document as Extended JSON with the fields of every
+// embedded document sorted, so documents differing only in field order compare equal.
+// A nil or empty document gives an empty string.
+func canonicalDocument(doc any) (string, error) {
+	if doc == nil {
+		return "", nil
+	}
+	if raw, ok := doc.(bson.Raw); ok && len(raw) == 0 {
+		return "", nil
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	var d bson.D
+	if err = bson.Unmarshal(data, &d); err != nil {
+		return "", err
+	}
+	if len(d) == 0 {
+		return "", nil
+	}
+	out, err := bson.MarshalExtJSON(sortFields(d), false, false)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// sortFields sorts the fields of documents by name, recursively
+func sortFields(v any) any {
+	switch v := v.(type) {
+	case bson.D:
+		sorted := make(bson.D, len(v))
+		for i, e := range v {
+			sorted[i] = bson.E{Key: e.Key, Value: sortFields(e.Value)}
+		}
+		slices.SortFunc(sorted, func(a, b bson.E) int { return strings.Compare(a.Key, b.Key) })
+		return sorted
+	case bson.A:
+		sorted := make(bson.A, len(v))
+		for i, e := range v {
+			sorted[i] = sortFields(e)
+		}
+		return sorted
+	default:
+		return v
+	}
+}
+
+// diffTextWeights compares the text field weights, a field weighs 1 unless set otherwise
+func diffTextWeights(have bson.D, want desiredIndex) string {
+	wantWeights := make(map[string]string)
+	for _, k := range want.keys {
+		if isTextKey(k) {
+			wantWeights[k.Key] = normalizeIndexValue(int32(1))
+		}
+	}
+	if want.options.Weights != nil {
+		raw, err := bson.Marshal(want.options.Weights)
+		if err != nil {
+			return fmt.Sprintf("invalid weights: %v", err)
+		}
+		var weights bson.D
+		if err = bson.Unmarshal(raw, &weights); err != nil {
+			return fmt.Sprintf("invalid weights: %v", err)
+		}
+		for _, w := range weights {
+			wantWeights[w.Key] = normalizeIndexValue(w.Value)
+		}
+	}
+
+	haveWeights := make(map[string]string, len(have))
+	for _, w := range have {
+		haveWeights[w.Key] = normalizeIndexValue(w.Value)
+	}
+	for field, weight := range wantWeights {
+		if haveWeights[field] != weight {
+			return "text weights changed"
+		}
+	}
+	if len(haveWeights) != len(wantWeights) {
+		return "text weights changed"
+	}
+	return ""
+}
+
+func formatIndexKeys(keys bson.D) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s: %v", k.Key, k.Value)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
@@ -0,0 +1,181 @@
+package mongoclient
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestPlanIndexes(t *testing.T) {
+	ttl := int64(3600)
+	idIndex := existingIndex{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}}
+	partial, _ := bson.Marshal(bson.D{
+		{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{"a", "b"}}}},
+		{Key: "age", Value: bson.D{{Key: "$lt", Value: int32(65)}, {Key: "$gte", Value: int32(18)}}},
+	})
+
+	tests := []struct {
+		name     string
+		existing []existingIndex
+		desired  []mongo.IndexModel
+		want     []IndexAction
+	}{
+		{
+			name:     "in sync",
+			existing: []existingIndex{idIndex, {Name: "email_1", Key: bson.D{{Key: "email", Value: int32(1)}}, Unique: true}},
+			desired:  []mongo.IndexModel{{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)}},
+		},
+		{
+			name:     "create missing",
+			existing: []existingIndex{idIndex},
+			desired:  []mongo.IndexModel{{Keys: bson.D{{Key: "email", Value: 1}}}},
+			want:     []IndexAction{IndexActionCreate},
+		},
+		{
+			name:     "drop undeclared",
+			existing: []existingIndex{idIndex, {Name: "age_1", Key: bson.D{{Key: "age", Value: int32(1)}}}},
+			want:     []IndexAction{IndexActionDrop},
+		},
+		{
+			name:     "rebuild on changed options",
+			existing: []existingIndex{idIndex, {Name: "createdAt_1", Key: bson.D{{Key: "createdAt", Value: int32(1)}}, ExpireAfterSeconds: &ttl}},
+			desired:  []mongo.IndexModel{{Keys: bson.D{{Key: "createdAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(60)}},
+			want:     []IndexAction{IndexActionRebuild},
+		},
+		{
+			name:     "partial filter in another field order",
+			existing: []existingIndex{idIndex, {Name: "email_1", Key: bson.D{{Key: "email", Value: int32(1)}}, PartialFilterExpression: partial}},
+			desired: []mongo.IndexModel{{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetPartialFilterExpression(bson.M{
+				"age":    bson.M{"$gte": 18, "$lt": 65},
+				"status": bson.M{"$in": bson.A{"a", "b"}},
+			})}},
+		},
+		{
+			name:     "partial filter changed",
+			existing: []existingIndex{idIndex, {Name: "email_1", Key: bson.D{{Key: "email", Value: int32(1)}}, PartialFilterExpression: partial}},
+			desired: []mongo.IndexModel{{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetPartialFilterExpression(bson.M{
+				"age":    bson.M{"$gte": 21, "$lt": 65},
+				"status": bson.M{"$in": bson.A{"a", "b"}},
+			})}},
+			want: []IndexAction{IndexActionRebuild},
+		},
+		{
+			name:     "partial filter removed",
+			existing: []existingIndex{idIndex, {Name: "email_1", Key: bson.D{{Key: "email", Value: int32(1)}}, PartialFilterExpression: partial}},
+			desired:  []mongo.IndexModel{{Keys: bson.D{{Key: "email", Value: 1}}}},
+			want:     []IndexAction{IndexActionRebuild},
+		},
+		{
+			name:     "conflict on reused name",
+			existing: []existingIndex{idIndex, {Name: "by_user", Key: bson.D{{Key: "userId", Value: int32(1)}}}},
+			desired:  []mongo.IndexModel{{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("by_user")}},
+			want:     []IndexAction{IndexActionConflict},
+		},
+		{
+			name:     "unhide declared index",
+			existing: []existingIndex{idIndex, {Name: "email_1", Key: bson.D{{Key: "email", Value: int32(1)}}, Hidden: true}},
+			desired:  []mongo.IndexModel{{Keys: bson.D{{Key: "email", Value: 1}}}},
+			want:     []IndexAction{IndexActionUnhide},
+		},
+		{
+			name:     "hide declared index",
+			existing: []existingIndex{idIndex, {Name: "email_1", Key: bson.D{{Key: "email", Value: int32(1)}}}},
+			desired:  []mongo.IndexModel{{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetHidden(true)}},
+			want:     []IndexAction{IndexActionHide},
+		},
+		{
+			name: "text index in sync",
+			existing: []existingIndex{idIndex, {
+				Name:    "title_text_body_text",
+				Key:     textIndexKeys(bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}}, bson.D{{Key: "body", Value: int32(1)}, {Key: "title", Value: int32(1)}}),
+				Weights: bson.D{{Key: "body", Value: int32(1)}, {Key: "title", Value: int32(1)}},
+			}},
+			desired: []mongo.IndexModel{{Keys: bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}}},
+		},
+		{
+			name: "text index weights changed",
+			existing: []existingIndex{idIndex, {
+				Name:    "title_text",
+				Key:     textIndexKeys(bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}}, bson.D{{Key: "title", Value: int32(1)}}),
+				Weights: bson.D{{Key: "title", Value: int32(1)}},
+			}},
+			desired: []mongo.IndexModel{{Keys: bson.D{{Key: "title", Value: "text"}}, Options: options.Index().SetWeights(bson.D{{Key: "title", Value: 10}})}},
+			want:    []IndexAction{IndexActionRebuild},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planIndexes("users", tt.existing, tt.desired)
+			if err != nil {
+				t.Fatalf("planIndexes() error = %v", err)
+			}
+			var got []IndexAction
+			for _, item := range plan.Items {
+				got = append(got, item.Action)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("planIndexes() actions = %v, want %v\n%s", got, tt.want, plan)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("planIndexes() actions = %v, want %v\n%s", got, tt.want, plan)
+				}
+			}
+		})
+	}
+}
+
+func TestTextIndexKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    bson.D
+		weights bson.D
+		want    string
+	}{
+		{
+			name: "regular index",
+			keys: bson.D{{Key: "email", Value: int32(1)}},
+			want: "{email: 1}",
+		},
+		{
+			name:    "text fields",
+			keys:    bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+			weights: bson.D{{Key: "title", Value: int32(1)}, {Key: "body", Value: int32(5)}},
+			want:    "{body: text, title: text}",
+		},
+		{
+			name:    "compound with prefix and suffix",
+			keys:    bson.D{{Key: "tenant", Value: int32(1)}, {Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}, {Key: "age", Value: int32(-1)}},
+			weights: bson.D{{Key: "title", Value: int32(1)}},
+			want:    "{tenant: 1, title: text, age: -1}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatIndexKeys(textIndexKeys(tt.keys, tt.weights)); got != tt.want {
+				t.Errorf("textIndexKeys() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultIndexName(t *testing.T) {
+	tests := []struct {
+		keys bson.D
+		want string
+	}{
+		{bson.D{{Key: "email", Value: 1}}, "email_1"},
+		{bson.D{{Key: "email", Value: 1}, {Key: "age", Value: -1}}, "email_1_age_-1"},
+		{bson.D{{Key: "title", Value: "text"}}, "title_text"},
+	}
+
+	for _, tt := range tests {
+		if got := defaultIndexName(tt.keys); got != tt.want {
+			t.Errorf("defaultIndexName(%v) = %s, want %s", tt.keys, got, tt.want)
+		}
+	}
+}
@@ -22,7 +22,7 @@ func (r *Repository[T]) EnsureIndexesAssertType(ctx context.Context, opts ...opt
 	}
 	_, err := r.collection.Indexes().CreateMany(ctx, documentWithIndexes.Indexes(), opts...)
 	if err != nil {
-		return fmt.Errorf("failed to create indexes: %w", err)
+		return r.classifyError("EnsureIndexes", nil, fmt.Errorf("failed to create indexes: %w", err))
 	}
 	return nil
 }
@@ -31,7 +31,7 @@ func (r *Repository[T]) EnsureIndexesAssertType(ctx context.Context, opts ...opt
 func (r *Repository[T]) EnsureIndexes(ctx context.Context, indexes []mongo.IndexModel, opts ...options.Lister[options.CreateIndexesOptions]) error {
 	_, err := r.collection.Indexes().CreateMany(ctx, indexes, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to create indexes: %w", err)
+		return r.classifyError("EnsureIndexes", nil, fmt.Errorf("failed to create indexes: %w", err))
 	}
 	return nil
 }
@@ -40,13 +40,13 @@ func (r *Repository[T]) EnsureIndexes(ctx context.Context, indexes []mongo.Index
 func (r *Repository[T]) GetIndexes(ctx context.Context, opts ...options.Lister[options.ListIndexesOptions]) ([]bson.M, error) {
 	cursor, err := r.collection.Indexes().List(ctx, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list indexes: %w", err)
+		return nil, r.classifyError("GetIndexes", nil, fmt.Errorf("failed to list indexes: %w", err))
 	}
 	defer cursor.Close(ctx)
 
 	var results []bson.M
 	if err = cursor.All(ctx, &results); err != nil {
-		return nil, fmt.Errorf("failed to decode indexes: %w", err)
+		return nil, r.classifyError("GetIndexes", nil, fmt.Errorf("failed to decode indexes: %w", err))
 	}
 
 	return results, nil
@@ -0,0 +1,147 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// LeaderElectionOptions configures a LeaderElector
+type LeaderElectionOptions struct {
+	// Name identifies the election, instances with the same name compete for leadership, required
+	Name string
+	// Identity identifies this instance, hostname-pid-random by default
+	Identity string
+	// LeaseDuration is how long leadership lasts without renewal, 15s by default.
+	// The lease is renewed every third of it, and the leader steps down when a renewal didn't
+	// succeed one third before the lease expires, so two leaders never overlap.
+	LeaseDuration time.Duration
+	// RetryInterval is the pause between attempts to become the leader, 2s by default
+	RetryInterval time.Duration
+	// OnStartedLeading is called in a new goroutine when this instance becomes the leader.
+	// Its context is canceled when leadership is lost, with ErrLockLost as the cause, and it must
+	// return then; it has up to a third of LeaseDuration before another instance may take over.
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called after OnStartedLeading returned and leadership was released
+	OnStoppedLeading func()
+	// OnError is called when an election attempt fails
+	OnError func(err error)
+}
+
+// LeaderElector elects a single leader among instances sharing a database.
+// It's built on LockManager: the leadership is a lock lease, and the term is its fencing token.
+type LeaderElector struct {
+	locks    *LockManager
+	opts     LeaderElectionOptions
+	isLeader atomic.Bool
+	term     atomic.Int64
+}
+
+// NewLeaderElector creates a new leader elector
+func NewLeaderElector(db *mongo.Database, opts LeaderElectionOptions) *LeaderElector {
+	if opts.Identity == "" {
+		host, _ := os.Hostname()
+		opts.Identity = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), bson.NewObjectID().Hex())
+	}
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = 15 * time.Second
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 2 * time.Second
+	}
+	return &LeaderElector{
+		locks: NewLockManager(db, LockOptions{RetryInterval: opts.RetryInterval, Holder: opts.Identity}),
+		opts:  opts,
+	}
+}
+
+// EnsureIndexes creates the indexes of the underlying locks collection
+func (e *LeaderElector) EnsureIndexes(ctx context.Context) error {
+	return e.locks.EnsureIndexes(ctx)
+}
+
+// IsLeader reports whether this instance currently holds the leadership
+func (e *LeaderElector) IsLeader() bool {
+	return e.isLeader.Load()
+}
+
+// Term returns the term of the current or last leadership of this instance.
+// Terms increase with every new leader, so they can be used as fencing tokens.
+func (e *LeaderElector) Term() int64 {
+	return e.term.Load()
+}
+
+// Identity returns the identity of this instance
+func (e *LeaderElector) Identity() string {
+	return e.opts.Identity
+}
+
+// Run competes for leadership until the context is canceled.
+// On shutdown the leadership is released, so another instance takes over immediately.
+func (e *LeaderElector) Run(ctx context.Context) error {
+	if e.opts.Name == "" {
+		return errors.New("leader election name is required")
+	}
+	for ctx.Err() == nil {
+		lock, err := e.locks.TryAcquire(ctx, e.opts.Name, e.opts.LeaseDuration)
+		switch {
+		case err == nil:
+			e.lead(ctx, lock)
+			continue
+		case errors.Is(err, ErrLockHeld), ctx.Err() != nil:
+		default:
+			if e.opts.OnError != nil {
+				e.opts.OnError(err)
+			}
+		}
+
+		select {
+		case <-time.After(e.opts.RetryInterval):
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
+
+// lead runs the leader callbacks until the lease is lost or the context is canceled.
+// The lock context is canceled one renew interval before the lease expires, so the leader
+// steps down before another instance can acquire it.
+func (e *LeaderElector) lead(ctx context.Context, lock *Lock) {
+	leaderCtx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(lock.Context(), func() { cancel(context.Cause(lock.Context())) })
+	defer stop()
+
+	e.term.Store(lock.Token())
+	e.isLeader.Store(true)
+
+	var wg sync.WaitGroup
+	if e.opts.OnStartedLeading != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.opts.OnStartedLeading(leaderCtx)
+		}()
+	}
+
+	<-leaderCtx.Done()
+	e.isLeader.Store(false)
+	wg.Wait()
+
+	releaseCtx, releaseCancel := context.WithTimeout(context.WithoutCancel(ctx), e.opts.LeaseDuration)
+	if err := lock.Release(releaseCtx); err != nil && e.opts.OnError != nil {
+		e.opts.OnError(err)
+	}
+	releaseCancel()
+	cancel(nil)
+
+	if e.opts.OnStoppedLeading != nil {
+		e.opts.OnStoppedLeading()
+	}
+}
@@ -0,0 +1,59 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLeaderElectorRunRequiresName(t *testing.T) {
+	elector := NewLeaderElector(testDatabase(t), LeaderElectionOptions{})
+	if err := elector.Run(context.Background()); err == nil {
+		t.Error("Run() error = nil, want the missing name reported")
+	}
+}
+
+func TestLeaderElectorStepsDownBeforeLeaseExpiry(t *testing.T) {
+	lease := 150 * time.Millisecond
+	var (
+		isLeader  bool
+		cause     error
+		steppedAt time.Duration
+		stopped   bool
+	)
+	start := time.Now()
+	var e *LeaderElector
+	e = NewLeaderElector(testDatabase(t), LeaderElectionOptions{
+		Name:          "test",
+		LeaseDuration: lease,
+		OnStartedLeading: func(ctx context.Context) {
+			isLeader = e.IsLeader()
+			<-ctx.Done()
+			steppedAt = time.Since(start)
+			cause = context.Cause(ctx)
+		},
+		OnStoppedLeading: func() { stopped = true },
+	})
+
+	lock := heldLock(t, lease)
+	lock.token = 7
+	e.lead(context.Background(), lock)
+
+	if !isLeader || e.IsLeader() {
+		t.Errorf("IsLeader() = %v while leading and %v after, want true and false", isLeader, e.IsLeader())
+	}
+	if e.Term() != 7 {
+		t.Errorf("Term() = %d, want the fencing token 7", e.Term())
+	}
+	if !errors.Is(cause, ErrLockLost) {
+		t.Errorf("leader context cause = %v, want ErrLockLost", cause)
+	}
+	// Renewals fail, so the leader steps down one renew interval before the lease expires.
+	if steppedAt >= lease || steppedAt < lease-renewInterval(lease)-20*time.Millisecond {
+		t.Errorf("stepped down after %v, want about %v", steppedAt, lease-renewInterval(lease))
+	}
+	if !stopped {
+		t.Error("OnStoppedLeading wasn't called")
+	}
+}
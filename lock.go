@@ -0,0 +1,233 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	DefaultLocksCollection      = "locks"
+	DefaultLockFencesCollection = "lock_fences"
+)
+
+var (
+	// ErrLockHeld is returned by TryAcquire when the lock is held by someone else
+	ErrLockHeld = errors.New("lock is held by another owner")
+	// ErrLockLost is returned when the lease of a held lock was lost
+	ErrLockLost = errors.New("lock lease lost")
+)
+
+// LockOptions configures a LockManager
+type LockOptions struct {
+	// RetryInterval is the pause between attempts of Acquire, 1s by default
+	RetryInterval time.Duration
+	// Holder is stored on held locks to show who holds them
+	Holder string
+}
+
+// LockManager hands out named locks with leases stored in the locks collection.
+// Expired leases are removed by a TTL index; fencing tokens are kept in the lock_fences collection,
+// so they keep increasing across expirations.
+type LockManager struct {
+	collection *mongo.Collection
+	fences     *mongo.Collection
+	opts       LockOptions
+}
+
+// NewLockManager creates a lock manager in the database
+func NewLockManager(db *mongo.Database, opts LockOptions) *LockManager {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	return &LockManager{
+		collection: db.Collection(DefaultLocksCollection),
+		fences:     db.Collection(DefaultLockFencesCollection),
+		opts:       opts,
+	}
+}
+
+// EnsureIndexes creates the TTL index that removes expired leases
+func (m *LockManager) EnsureIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+	return nil
+}
+
+// Lock is a held lock. Its lease is renewed in the background until Release.
+type Lock struct {
+	manager *LockManager
+	name    string
+	owner   string
+	token   int64
+	ttl     time.Duration
+
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// Name returns the lock name
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Token returns the fencing token, it's greater than the token of any previous holder of the lock
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Context returns a context that is canceled when the lease is lost or the lock is released.
+// context.Cause returns ErrLockLost if the lease was lost.
+func (l *Lock) Context() context.Context {
+	return l.ctx
+}
+
+// Release stops the lease renewal and releases the lock
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stopped) })
+	l.cancel(context.Canceled)
+
+	_, err := l.manager.collection.DeleteOne(ctx, bson.M{"_id": l.name, "owner": l.owner})
+	if err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", l.name, err)
+	}
+	return nil
+}
+
+// TryAcquire acquires the lock if it's free and returns ErrLockHeld otherwise
+func (m *LockManager) TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid ttl: must be > 0")
+	}
+	owner := bson.NewObjectID().Hex()
+	now := time.Now()
+
+	// The upsert fails with a duplicate key error while an unexpired lease exists.
+	_, err := m.collection.UpdateOne(ctx,
+		bson.M{"_id": name, "expiresAt": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"owner": owner, "holder": m.opts.Holder, "expiresAt": now.Add(ttl), "acquiredAt": now}},
+		options.UpdateOne().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrLockHeld
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+	}
+
+	token, err := m.nextToken(ctx, name, owner)
+	if err != nil {
+		_, _ = m.collection.DeleteOne(context.WithoutCancel(ctx), bson.M{"_id": name, "owner": owner})
+		return nil, err
+	}
+
+	lockCtx, cancel := context.WithCancelCause(context.Background())
+	l := &Lock{
+		manager: m,
+		name:    name,
+		owner:   owner,
+		token:   token,
+		ttl:     ttl,
+		ctx:     lockCtx,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	go l.renew(now.Add(ttl))
+	return l, nil
+}
+
+// Acquire waits until the lock is acquired or the context is done
+func (m *LockManager) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	for {
+		l, err := m.TryAcquire(ctx, name, ttl)
+		if !errors.Is(err, ErrLockHeld) {
+			return l, err
+		}
+		select {
+		case <-time.After(m.opts.RetryInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// nextToken increments the fencing counter of the lock and stores the token on the lease,
+// failing if the lease was taken over in between
+func (m *LockManager) nextToken(ctx context.Context, name, owner string) (int64, error) {
+	var fence struct {
+		Token int64 `bson:"token"`
+	}
+	err := m.fences.FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"token": int64(1)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&fence)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get fencing token for lock %s: %w", name, err)
+	}
+
+	result, err := m.collection.UpdateOne(ctx, bson.M{"_id": name, "owner": owner}, bson.M{"$set": bson.M{"token": fence.Token}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+	}
+	if result.MatchedCount == 0 {
+		return 0, ErrLockLost
+	}
+	return fence.Token, nil
+}
+
+// renewInterval returns how often a lease of the ttl is renewed, a third of it,
+// and at least a millisecond for very short leases
+func renewInterval(ttl time.Duration) time.Duration {
+	return max(ttl/3, time.Millisecond)
+}
+
+// renew extends the lease every third of the ttl. The lock context is canceled when the
+// lease is taken over, or when it was not renewed one interval before it expires.
+func (l *Lock) renew(expiresAt time.Time) {
+	interval := renewInterval(l.ttl)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		renewDeadline := expiresAt.Add(-interval)
+		deadline := time.NewTimer(time.Until(renewDeadline))
+		select {
+		case <-l.stopped:
+			deadline.Stop()
+			return
+		case <-deadline.C:
+			l.cancel(ErrLockLost)
+			return
+		case <-ticker.C:
+			deadline.Stop()
+		}
+
+		// The new expiry is measured from when the request was sent, not when it returned.
+		sent := time.Now()
+		ctx, cancel := context.WithDeadline(l.ctx, renewDeadline)
+		result, err := l.manager.collection.UpdateOne(ctx,
+			bson.M{"_id": l.name, "owner": l.owner},
+			bson.M{"$set": bson.M{"expiresAt": sent.Add(l.ttl)}})
+		cancel()
+
+		if err == nil && result.MatchedCount == 0 {
+			l.cancel(ErrLockLost)
+			return
+		}
+		if err == nil {
+			expiresAt = sent.Add(l.ttl)
+		}
+	}
+}
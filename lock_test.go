@@ -0,0 +1,86 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRenewInterval(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{ttl: 30 * time.Second, want: 10 * time.Second},
+		{ttl: 90 * time.Millisecond, want: 30 * time.Millisecond},
+		{ttl: time.Millisecond, want: time.Millisecond},
+		{ttl: 2, want: time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := renewInterval(tt.ttl); got != tt.want {
+			t.Errorf("renewInterval(%v) = %v, want %v", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+// heldLock returns a lock whose lease renewal runs against an unreachable database, so every renewal fails
+func heldLock(t *testing.T, ttl time.Duration) *Lock {
+	t.Helper()
+	lockCtx, cancel := context.WithCancelCause(context.Background())
+	l := &Lock{
+		manager: NewLockManager(testDatabase(t), LockOptions{}),
+		name:    "test",
+		owner:   "owner",
+		token:   1,
+		ttl:     ttl,
+		ctx:     lockCtx,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	go l.renew(time.Now().Add(ttl))
+	return l
+}
+
+func TestLockRenewGivesUp(t *testing.T) {
+	ttl := 150 * time.Millisecond
+	start := time.Now()
+	l := heldLock(t, ttl)
+
+	select {
+	case <-l.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock context wasn't canceled")
+	}
+	elapsed := time.Since(start)
+	if cause := context.Cause(l.Context()); !errors.Is(cause, ErrLockLost) {
+		t.Errorf("cause = %v, want ErrLockLost", cause)
+	}
+	// The lease is given up one renew interval before it expires, never after.
+	if elapsed >= ttl {
+		t.Errorf("gave up after %v, want before the %v lease expired", elapsed, ttl)
+	}
+	if earliest := ttl - renewInterval(ttl) - 20*time.Millisecond; elapsed < earliest {
+		t.Errorf("gave up after %v, want the failing renewals retried until about %v", elapsed, ttl-renewInterval(ttl))
+	}
+}
+
+func TestLockReleaseStopsRenewal(t *testing.T) {
+	l := heldLock(t, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_ = l.Release(ctx) // the delete fails, the database is unreachable
+
+	if cause := context.Cause(l.Context()); !errors.Is(cause, context.Canceled) {
+		t.Errorf("cause = %v, want context.Canceled", cause)
+	}
+}
+
+func TestLockManagerTryAcquireInvalidTTL(t *testing.T) {
+	m := NewLockManager(testDatabase(t), LockOptions{})
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		if _, err := m.TryAcquire(context.Background(), "test", ttl); err == nil {
+			t.Errorf("TryAcquire(ttl %v) error = nil, want invalid ttl", ttl)
+		}
+	}
+}
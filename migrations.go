@@ -0,0 +1,366 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	DefaultMigrationsCollection = "schema_migrations"
+	DefaultMigrationLockTTL     = 5 * time.Minute
+	// MinMigrationLockTTL is the shortest lock TTL, shorter ones are raised to it
+	MinMigrationLockTTL = time.Second
+	migrationLockID     = "migration_lock"
+)
+
+var (
+	// ErrMigrationLocked is returned when another instance holds the migration lock
+	ErrMigrationLocked = errors.New("migrations are locked by another instance")
+	// ErrMigrationLockLost is returned when the migration lock could not be renewed,
+	// the running migration is aborted through its context
+	ErrMigrationLockLost = errors.New("migration lock was lost")
+)
+
+// MigrationFunc applies or reverts a single schema change
+type MigrationFunc func(ctx context.Context, db *mongo.Database) error
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version     int64
+	Description string
+	Up          MigrationFunc
+	Down        MigrationFunc
+	// Transactional runs the migration and its bookkeeping in one transaction
+	Transactional bool
+}
+
+// MigrationRecord is stored in the migrations collection for every applied migration
+type MigrationRecord struct {
+	Version     int64     `bson:"version" json:"version"`
+	Description string    `bson:"description" json:"description"`
+	AppliedAt   time.Time `bson:"appliedAt" json:"appliedAt"`
+}
+
+// MigrationStatus describes whether a registered migration has been applied
+type MigrationStatus struct {
+	Version     int64     `json:"version"`
+	Description string    `json:"description"`
+	Applied     bool      `json:"applied"`
+	AppliedAt   time.Time `json:"appliedAt,omitempty"`
+}
+
+// Migrator applies registered migrations and records them in the migrations collection
+type Migrator struct {
+	db         *mongo.Database
+	collection *mongo.Collection
+	migrations []Migration
+	owner      string
+	lockTTL    time.Duration
+	// err is the registration error, returned by Status, Up and Down
+	err error
+}
+
+// NewMigrator creates a new migrator for the database. If migrations have duplicate
+// versions or no Up function, Status, Up and Down return the error.
+func NewMigrator(db *mongo.Database, migrations ...Migration) *Migrator {
+	sorted, err := sortMigrations(migrations)
+
+	host, _ := os.Hostname()
+	return &Migrator{
+		db:         db,
+		collection: db.Collection(DefaultMigrationsCollection),
+		migrations: sorted,
+		owner:      fmt.Sprintf("%s-%d-%s", host, os.Getpid(), bson.NewObjectID().Hex()),
+		lockTTL:    DefaultMigrationLockTTL,
+		err:        err,
+	}
+}
+
+// sortMigrations orders the migrations by version and checks them
+func sortMigrations(migrations []Migration) ([]Migration, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d has no Up function", m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+	return sorted, nil
+}
+
+// SetCollection overrides the collection used to record applied migrations
+func (m *Migrator) SetCollection(name string) *Migrator {
+	m.collection = m.db.Collection(name)
+	return m
+}
+
+// SetLockTTL sets how long the migration lock is held before it's considered abandoned.
+// The lock is renewed every third of the TTL while migrations run. A TTL <= 0 restores
+// the default, a TTL shorter than MinMigrationLockTTL is raised to it.
+func (m *Migrator) SetLockTTL(ttl time.Duration) *Migrator {
+	switch {
+	case ttl <= 0:
+		m.lockTTL = DefaultMigrationLockTTL
+	case ttl < MinMigrationLockTTL:
+		m.lockTTL = MinMigrationLockTTL
+	default:
+		m.lockTTL = ttl
+	}
+	return m
+}
+
+// Status returns all registered migrations with their applied state
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i] = MigrationStatus{Version: mig.Version, Description: mig.Description}
+		if rec, ok := applied[mig.Version]; ok {
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = rec.AppliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Up applies pending migrations up to and including version to.
+// If to is 0, all pending migrations are applied. It returns the applied versions.
+func (m *Migrator) Up(ctx context.Context, to int64) ([]int64, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	ctx, release, err := m.hold(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int64
+	for _, mig := range m.migrations {
+		if to > 0 && mig.Version > to {
+			break
+		}
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		err = m.run(ctx, mig, mig.Up, func(ctx context.Context) error {
+			_, err := m.collection.InsertOne(ctx, MigrationRecord{
+				Version:     mig.Version,
+				Description: mig.Description,
+				AppliedAt:   time.Now(),
+			})
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to apply migration %d: %w", mig.Version, lockError(ctx, err))
+		}
+		done = append(done, mig.Version)
+	}
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations and returns the reverted versions
+func (m *Migrator) Down(ctx context.Context, steps int) ([]int64, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("invalid steps: must be >= 1")
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	ctx, release, err := m.hold(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int64
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == nil {
+			return done, fmt.Errorf("migration %d has no Down function", mig.Version)
+		}
+		err = m.run(ctx, mig, mig.Down, func(ctx context.Context) error {
+			_, err := m.collection.DeleteOne(ctx, bson.M{"version": mig.Version})
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to revert migration %d: %w", mig.Version, lockError(ctx, err))
+		}
+		done = append(done, mig.Version)
+	}
+	return done, nil
+}
+
+// run executes the migration func and the bookkeeping, in a transaction if requested
+func (m *Migrator) run(ctx context.Context, mig Migration, fn MigrationFunc, record func(ctx context.Context) error) error {
+	if !mig.Transactional {
+		if err := fn(ctx, m.db); err != nil {
+			return err
+		}
+		return record(ctx)
+	}
+
+	session, err := m.db.Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx context.Context) (any, error) {
+		if err := fn(sessCtx, m.db); err != nil {
+			return nil, err
+		}
+		return nil, record(sessCtx)
+	})
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]MigrationRecord, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{"version": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []MigrationRecord
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode applied migrations: %w", err)
+	}
+
+	applied := make(map[int64]MigrationRecord, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+	return applied, nil
+}
+
+// lock takes the migration lock, or takes over one that has expired.
+// The lock is a document with a fixed _id in the migrations collection,
+// so a concurrent upsert fails with a duplicate key error.
+func (m *Migrator) lock(ctx context.Context) error {
+	now := time.Now()
+	filter := bson.M{
+		"_id": migrationLockID,
+		"$or": bson.A{
+			bson.M{"expiresAt": bson.M{"$lt": now}},
+			bson.M{"owner": m.owner},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": m.owner, "expiresAt": now.Add(m.lockTTL)}}
+
+	_, err := m.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrMigrationLocked
+	}
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	return nil
+}
+
+// hold takes the migration lock and renews it until release is called. The returned
+// context is canceled with ErrMigrationLockLost if the lock can't be renewed in time.
+func (m *Migrator) hold(ctx context.Context) (context.Context, func(), error) {
+	expiresAt := time.Now().Add(m.lockTTL)
+	if err := m.lock(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.renew(lockCtx, cancel, expiresAt)
+	}()
+
+	release := func() {
+		cancel(nil)
+		<-done
+		m.unlock(context.WithoutCancel(ctx))
+	}
+	return lockCtx, release, nil
+}
+
+// renew extends the lock every third of its TTL. It gives up, canceling the migration, when
+// the lock was taken over or was not renewed one interval before it expires.
+func (m *Migrator) renew(ctx context.Context, cancel context.CancelCauseFunc, expiresAt time.Time) {
+	interval := m.lockTTL / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		renewDeadline := expiresAt.Add(-interval)
+		deadline := time.NewTimer(time.Until(renewDeadline))
+		select {
+		case <-ctx.Done():
+			deadline.Stop()
+			return
+		case <-deadline.C:
+			cancel(ErrMigrationLockLost)
+			return
+		case <-ticker.C:
+			deadline.Stop()
+		}
+
+		// The new expiry is measured from when the request was sent, not when it returned.
+		sent := time.Now()
+		renewCtx, cancelRenew := context.WithDeadline(ctx, renewDeadline)
+		res, err := m.collection.UpdateOne(renewCtx,
+			bson.M{"_id": migrationLockID, "owner": m.owner},
+			bson.M{"$set": bson.M{"expiresAt": sent.Add(m.lockTTL)}},
+		)
+		cancelRenew()
+
+		if err == nil && res.MatchedCount == 0 {
+			cancel(ErrMigrationLockLost)
+			return
+		}
+		if err == nil {
+			expiresAt = sent.Add(m.lockTTL)
+		}
+	}
+}
+
+// lockError returns ErrMigrationLockLost if the migration failed because the lock was lost
+func lockError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrMigrationLockLost) {
+		return fmt.Errorf("%w: %w", cause, err)
+	}
+	return err
+}
+
+func (m *Migrator) unlock(ctx context.Context) {
+	_, _ = m.collection.DeleteOne(ctx, bson.M{"_id": migrationLockID, "owner": m.owner})
+}
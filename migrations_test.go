@@ -0,0 +1,110 @@
+package mongoclient
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func testDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+	client, err := mongo.Connect(options.Client().ApplyURI("mongodb://localhost:1").SetServerSelectionTimeout(10 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+	return client.Database("test")
+}
+
+func TestSortMigrations(t *testing.T) {
+	up := func(ctx context.Context, db *mongo.Database) error { return nil }
+
+	tests := []struct {
+		name       string
+		migrations []Migration
+		want       []int64
+		wantErr    string
+	}{
+		{name: "empty"},
+		{
+			name:       "ordered by version",
+			migrations: []Migration{{Version: 3, Up: up}, {Version: 1, Up: up}, {Version: 20, Up: up}, {Version: 2, Up: up}},
+			want:       []int64{1, 2, 3, 20},
+		},
+		{
+			name:       "duplicate version",
+			migrations: []Migration{{Version: 2, Up: up}, {Version: 1, Up: up}, {Version: 2, Up: up}},
+			wantErr:    "duplicate migration version 2",
+		},
+		{
+			name:       "missing up",
+			migrations: []Migration{{Version: 1, Up: up}, {Version: 2}},
+			wantErr:    "migration 2 has no Up function",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted, err := sortMigrations(tt.migrations)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("sortMigrations() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sortMigrations() error = %v", err)
+			}
+			var versions []int64
+			for _, m := range sorted {
+				versions = append(versions, m.Version)
+			}
+			if !slices.Equal(versions, tt.want) {
+				t.Errorf("sortMigrations() versions = %v, want %v", versions, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigratorReportsRegistrationErrors(t *testing.T) {
+	m := NewMigrator(testDatabase(t), Migration{Version: 1})
+
+	if _, err := m.Status(context.Background()); err == nil {
+		t.Error("Status() error = nil, want the registration error")
+	}
+	if _, err := m.Up(context.Background(), 0); err == nil {
+		t.Error("Up() error = nil, want the registration error")
+	}
+	if _, err := m.Down(context.Background(), 1); err == nil {
+		t.Error("Down() error = nil, want the registration error")
+	}
+}
+
+func TestMigratorSetLockTTL(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{ttl: 0, want: DefaultMigrationLockTTL},
+		{ttl: -time.Second, want: DefaultMigrationLockTTL},
+		{ttl: time.Nanosecond, want: MinMigrationLockTTL},
+		{ttl: 2, want: MinMigrationLockTTL},
+		{ttl: MinMigrationLockTTL, want: MinMigrationLockTTL},
+		{ttl: time.Minute, want: time.Minute},
+	}
+
+	db := testDatabase(t)
+	for _, tt := range tests {
+		m := NewMigrator(db).SetLockTTL(tt.ttl)
+		if m.lockTTL != tt.want {
+			t.Errorf("SetLockTTL(%v) = %v, want %v", tt.ttl, m.lockTTL, tt.want)
+		}
+		if m.lockTTL/3 <= 0 {
+			t.Errorf("SetLockTTL(%v) gives renew interval %v, want > 0", tt.ttl, m.lockTTL/3)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package mongoclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MirrorChange describes a change applied to a Mirror. Old is zero for inserts and New for deletes.
+type MirrorChange[T any] struct {
+	Operation OperationType
+	ID        any
+	Old       T
+	New       T
+}
+
+// MirrorOptions configures a Mirror
+type MirrorOptions[T any] struct {
+	// Filter restricts the mirrored documents, all documents by default
+	Filter any
+	// Match must accept the same documents as Filter, Run fails without it when Filter is set.
+	// Changed documents it rejects are removed from the mirror.
+	Match func(document T) bool
+	// OnChange is called after every change, including the differences found by a resync
+	OnChange func(change MirrorChange[T])
+	// OnError is called for every error before the mirror resyncs
+	OnError func(err error)
+	// MinRetryDelay and MaxRetryDelay bound the backoff after errors, 1s and 1m by default
+	MinRetryDelay time.Duration
+	MaxRetryDelay time.Duration
+}
+
+// mirrorEntry is a mirrored document with its encoding, used to find changes on resync
+type mirrorEntry[T any] struct {
+	id  any
+	doc T
+	raw bson.Raw
+}
+
+// Mirror is an in-memory copy of a collection kept current by a change stream.
+// It's meant for small reference collections read far more often than written.
+// Returned documents are shared and must not be modified.
+type Mirror[T any] struct {
+	repo *Repository[T]
+	opts MirrorOptions[T]
+
+	mu      sync.RWMutex
+	entries map[string]mirrorEntry[T]
+
+	readyOnce sync.Once
+	ready     chan struct{}
+}
+
+// NewMirror creates a mirror of the repository collection, it's empty until Run loads it
+func NewMirror[T any](repo *Repository[T], opts MirrorOptions[T]) *Mirror[T] {
+	if opts.MinRetryDelay <= 0 {
+		opts.MinRetryDelay = time.Second
+	}
+	if opts.MaxRetryDelay <= 0 {
+		opts.MaxRetryDelay = time.Minute
+	}
+	return &Mirror[T]{
+		repo:    repo,
+		opts:    opts,
+		entries: make(map[string]mirrorEntry[T]),
+		ready:   make(chan struct{}),
+	}
+}
+
+// Ready returns a channel that is closed once the collection is loaded
+func (m *Mirror[T]) Ready() <-chan struct{} {
+	return m.ready
+}
+
+// Get returns the document with the id
+func (m *Mirror[T]) Get(id any) (T, bool) {
+	var zero T
+	key, err := mirrorKey(id)
+	if err != nil {
+		return zero, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, ok := m.entries[key]
+	return entry.doc, ok
+}
+
+// List returns the documents accepted by the predicate, all documents if it's nil
+func (m *Mirror[T]) List(predicate func(document T) bool) []T {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]T, 0, len(m.entries))
+	for _, entry := range m.entries {
+		if predicate == nil || predicate(entry.doc) {
+			result = append(result, entry.doc)
+		}
+	}
+	return result
+}
+
+// Len returns the number of mirrored documents
+func (m *Mirror[T]) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.entries)
+}
+
+// Run loads the collection and applies its changes until the context is canceled.
+// When the stream is invalidated, its history is lost or it fails, the collection is loaded again.
+func (m *Mirror[T]) Run(ctx context.Context) error {
+	if m.opts.Filter != nil && m.opts.Match == nil {
+		return errors.New("mirror filter requires a match function")
+	}
+	delay := m.opts.MinRetryDelay
+	for {
+		synced, err := m.sync(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if synced {
+			delay = m.opts.MinRetryDelay
+		}
+
+		if m.opts.OnError != nil && err != nil {
+			m.opts.OnError(err)
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+		delay = min(delay*2, m.opts.MaxRetryDelay)
+	}
+}
+
+// sync opens a change stream, loads the collection and applies events until the stream ends.
+// The stream is opened first, so changes made during the load are not missed.
+func (m *Mirror[T]) sync(ctx context.Context) (bool, error) {
+	stream, err := m.repo.WatchTyped(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	if err = m.load(ctx); err != nil {
+		return false, err
+	}
+	m.readyOnce.Do(func() { close(m.ready) })
+
+	for stream.Next(ctx) {
+		event := stream.Event()
+		if event.OperationType == OperationInvalidate {
+			return true, ErrChangeStreamInvalidated
+		}
+		if err = m.apply(event); err != nil {
+			return true, err
+		}
+	}
+
+	err = stream.Err()
+	if isHistoryLost(err) {
+		return true, fmt.Errorf("%w: %v", ErrChangeStreamHistoryLost, err)
+	}
+	return true, err
+}
+
+// load replaces the mirrored documents with the collection contents and reports the differences
+func (m *Mirror[T]) load(ctx context.Context) error {
+	filter := m.opts.Filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+	documents, err := m.repo.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to load mirror: %w", err)
+	}
+
+	entries := make(map[string]mirrorEntry[T], len(documents))
+	for _, doc := range documents {
+		key, entry, err := newMirrorEntry(doc)
+		if err != nil {
+			return err
+		}
+		entries[key] = entry
+	}
+
+	m.mu.Lock()
+	previous := m.entries
+	m.entries = entries
+	m.mu.Unlock()
+
+	if m.opts.OnChange == nil {
+		return nil
+	}
+	var zero T
+	for key, old := range previous {
+		entry, ok := entries[key]
+		switch {
+		case !ok:
+			m.opts.OnChange(MirrorChange[T]{Operation: OperationDelete, ID: old.id, Old: old.doc, New: zero})
+		case !bytes.Equal(old.raw, entry.raw):
+			m.opts.OnChange(MirrorChange[T]{Operation: OperationReplace, ID: entry.id, Old: old.doc, New: entry.doc})
+		}
+	}
+	for key, entry := range entries {
+		if _, ok := previous[key]; !ok {
+			m.opts.OnChange(MirrorChange[T]{Operation: OperationInsert, ID: entry.id, Old: zero, New: entry.doc})
+		}
+	}
+	return nil
+}
+
+// apply updates the mirror with a change event
+func (m *Mirror[T]) apply(event ChangeEvent[T]) error {
+	id, ok := event.DocumentKey["_id"]
+	if !ok {
+		// drop and rename events are followed by an invalidate
+		return nil
+	}
+	key, err := mirrorKey(id)
+	if err != nil {
+		return err
+	}
+
+	var (
+		zero  T
+		entry mirrorEntry[T]
+		keep  bool
+	)
+	switch event.OperationType {
+	case OperationInsert, OperationUpdate, OperationReplace:
+		// updates have no full document if it was deleted before the lookup
+		if isEmptyDocument(event.FullDocument) {
+			break
+		}
+		raw, err := bson.Marshal(event.FullDocument)
+		if err != nil {
+			return fmt.Errorf("failed to encode mirrored document: %w", err)
+		}
+		keep = m.opts.Match == nil || m.opts.Match(event.FullDocument)
+		entry = mirrorEntry[T]{id: id, doc: event.FullDocument, raw: raw}
+	case OperationDelete:
+	default:
+		return nil
+	}
+
+	m.mu.Lock()
+	old, existed := m.entries[key]
+	if keep {
+		m.entries[key] = entry
+	} else {
+		delete(m.entries, key)
+	}
+	m.mu.Unlock()
+
+	if m.opts.OnChange == nil {
+		return nil
+	}
+	switch {
+	case keep && existed:
+		m.opts.OnChange(MirrorChange[T]{Operation: event.OperationType, ID: id, Old: old.doc, New: entry.doc})
+	case keep:
+		m.opts.OnChange(MirrorChange[T]{Operation: OperationInsert, ID: id, Old: zero, New: entry.doc})
+	case existed:
+		m.opts.OnChange(MirrorChange[T]{Operation: OperationDelete, ID: id, Old: old.doc, New: zero})
+	}
+	return nil
+}
+
+// isEmptyDocument reports whether the event carried no document: nil for pointers, maps and
+// interfaces, the zero value for structs, which always have an _id when decoded from the server
+func isEmptyDocument[T any](doc T) bool {
+	v := reflect.ValueOf(&doc).Elem()
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// newMirrorEntry encodes the document and returns it with the key of its _id
+func newMirrorEntry[T any](doc T) (string, mirrorEntry[T], error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return "", mirrorEntry[T]{}, fmt.Errorf("failed to encode mirrored document: %w", err)
+	}
+	value, err := bson.Raw(raw).LookupErr("_id")
+	if err != nil {
+		return "", mirrorEntry[T]{}, errors.New("mirrored document has no _id")
+	}
+	var id any
+	if err = value.Unmarshal(&id); err != nil {
+		return "", mirrorEntry[T]{}, fmt.Errorf("failed to decode document _id: %w", err)
+	}
+	return value.Type.String() + ":" + value.String(), mirrorEntry[T]{id: id, doc: doc, raw: raw}, nil
+}
+
+// mirrorKey returns the map key of a document id, ids of the same BSON type and value give equal keys
+func mirrorKey(id any) (string, error) {
+	raw, err := bson.Marshal(bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode id: %w", err)
+	}
+	value := bson.Raw(raw).Lookup("_id")
+	return value.Type.String() + ":" + value.String(), nil
+}
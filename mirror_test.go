@@ -0,0 +1,200 @@
+package mongoclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type mirrorItem struct {
+	ID     any    `bson:"_id"`
+	Name   string `bson:"name"`
+	Active bool   `bson:"active"`
+}
+
+func TestMirrorKey(t *testing.T) {
+	ids := []any{
+		bson.NewObjectID(),
+		"code",
+		int32(7),
+		int64(7),
+		bson.D{{Key: "tenant", Value: "a"}, {Key: "n", Value: int32(1)}},
+	}
+
+	seen := make(map[string]any)
+	for _, id := range ids {
+		t.Run(fmt.Sprintf("%T", id), func(t *testing.T) {
+			key, err := mirrorKey(id)
+			if err != nil {
+				t.Fatalf("mirrorKey() error = %v", err)
+			}
+			if other, ok := seen[key]; ok {
+				t.Errorf("mirrorKey(%v) = %s, same as for %v", id, key, other)
+			}
+			seen[key] = id
+
+			docKey, _, err := newMirrorEntry(&mirrorItem{ID: id})
+			if err != nil {
+				t.Fatalf("newMirrorEntry() error = %v", err)
+			}
+			if docKey != key {
+				t.Errorf("newMirrorEntry() key = %s, want %s as for the event id", docKey, key)
+			}
+		})
+	}
+}
+
+func TestMirrorApply(t *testing.T) {
+	active := func(name string) *mirrorItem { return &mirrorItem{ID: "x", Name: name, Active: true} }
+
+	tests := []struct {
+		name      string
+		existing  *mirrorItem
+		event     ChangeEvent[*mirrorItem]
+		wantName  string
+		wantEvent OperationType
+	}{
+		{
+			name:      "insert",
+			event:     ChangeEvent[*mirrorItem]{OperationType: OperationInsert, FullDocument: active("a")},
+			wantName:  "a",
+			wantEvent: OperationInsert,
+		},
+		{
+			name:      "update",
+			existing:  active("a"),
+			event:     ChangeEvent[*mirrorItem]{OperationType: OperationUpdate, FullDocument: active("b")},
+			wantName:  "b",
+			wantEvent: OperationUpdate,
+		},
+		{
+			name:      "update to a rejected document removes it",
+			existing:  active("a"),
+			event:     ChangeEvent[*mirrorItem]{OperationType: OperationUpdate, FullDocument: &mirrorItem{ID: "x", Name: "a"}},
+			wantEvent: OperationDelete,
+		},
+		{
+			name:      "update to an accepted document adds it",
+			event:     ChangeEvent[*mirrorItem]{OperationType: OperationUpdate, FullDocument: active("a")},
+			wantName:  "a",
+			wantEvent: OperationInsert,
+		},
+		{
+			name:      "update without full document removes it",
+			existing:  active("a"),
+			event:     ChangeEvent[*mirrorItem]{OperationType: OperationUpdate},
+			wantEvent: OperationDelete,
+		},
+		{
+			name:      "delete",
+			existing:  active("a"),
+			event:     ChangeEvent[*mirrorItem]{OperationType: OperationDelete},
+			wantEvent: OperationDelete,
+		},
+		{
+			name:  "delete of an unknown document",
+			event: ChangeEvent[*mirrorItem]{OperationType: OperationDelete},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []MirrorChange[*mirrorItem]
+			m := NewMirror(NewRepository[*mirrorItem](nil), MirrorOptions[*mirrorItem]{
+				Filter:   bson.M{"active": true},
+				Match:    func(item *mirrorItem) bool { return item.Active },
+				OnChange: func(change MirrorChange[*mirrorItem]) { changes = append(changes, change) },
+			})
+			if tt.existing != nil {
+				key, entry, err := newMirrorEntry(tt.existing)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m.entries[key] = entry
+			}
+
+			tt.event.DocumentKey = bson.M{"_id": "x"}
+			if err := m.apply(tt.event); err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+
+			got, ok := m.Get("x")
+			switch {
+			case tt.wantName == "" && ok:
+				t.Errorf("Get() = %v, want no document", got)
+			case tt.wantName != "" && (!ok || got.Name != tt.wantName):
+				t.Errorf("Get() = %v, %v, want %s", got, ok, tt.wantName)
+			}
+
+			switch {
+			case tt.wantEvent == "" && len(changes) > 0:
+				t.Errorf("OnChange called with %v, want no calls", changes)
+			case tt.wantEvent != "" && (len(changes) != 1 || changes[0].Operation != tt.wantEvent):
+				t.Errorf("OnChange calls = %v, want one %s", changes, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestIsEmptyDocument(t *testing.T) {
+	var nilItem *mirrorItem
+	tests := []struct {
+		name  string
+		empty bool
+		got   bool
+	}{
+		{name: "nil pointer", empty: true, got: isEmptyDocument(nilItem)},
+		{name: "pointer", empty: false, got: isEmptyDocument(&mirrorItem{})},
+		{name: "zero struct", empty: true, got: isEmptyDocument(mirrorItem{})},
+		{name: "struct", empty: false, got: isEmptyDocument(mirrorItem{ID: "x"})},
+		{name: "nil map", empty: true, got: isEmptyDocument(bson.M(nil))},
+		{name: "empty map", empty: false, got: isEmptyDocument(bson.M{})},
+		{name: "nil interface", empty: true, got: isEmptyDocument[any](nil)},
+		{name: "nil bson.D", empty: true, got: isEmptyDocument(bson.D(nil))},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.empty {
+			t.Errorf("%s: isEmptyDocument() = %v, want %v", tt.name, tt.got, tt.empty)
+		}
+	}
+}
+
+func TestMirrorApplyValueType(t *testing.T) {
+	var changes []MirrorChange[mirrorItem]
+	m := NewMirror(&Repository[mirrorItem]{}, MirrorOptions[mirrorItem]{
+		OnChange: func(change MirrorChange[mirrorItem]) { changes = append(changes, change) },
+	})
+	key := bson.M{"_id": "x"}
+
+	events := []ChangeEvent[mirrorItem]{
+		{OperationType: OperationInsert, DocumentKey: key, FullDocument: mirrorItem{ID: "x", Name: "a"}},
+		{OperationType: OperationUpdate, DocumentKey: key, FullDocument: mirrorItem{ID: "x", Name: "b"}},
+		{OperationType: OperationUpdate, DocumentKey: key},
+	}
+	want := []struct {
+		name      string
+		operation OperationType
+	}{{"a", OperationInsert}, {"b", OperationUpdate}, {"", OperationDelete}}
+
+	for i, event := range events {
+		if err := m.apply(event); err != nil {
+			t.Fatalf("apply(%d) error = %v", i, err)
+		}
+		got, ok := m.Get("x")
+		if want[i].name == "" && ok || want[i].name != "" && got.Name != want[i].name {
+			t.Errorf("after event %d Get() = %v, %v, want %q", i, got, ok, want[i].name)
+		}
+		if len(changes) != i+1 || changes[i].Operation != want[i].operation {
+			t.Errorf("after event %d changes = %v, want %s", i, changes, want[i].operation)
+		}
+	}
+}
+
+func TestMirrorRunRequiresMatch(t *testing.T) {
+	m := NewMirror(NewRepository[*mirrorItem](nil), MirrorOptions[*mirrorItem]{Filter: bson.M{"active": true}})
+	if err := m.Run(context.Background()); err == nil {
+		t.Error("Run() = nil, want an error for a filter without a match function")
+	}
+}
@@ -0,0 +1,406 @@
+package mongoclient
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	DefaultOutboxCollection           = "outbox"
+	DefaultOutboxDeadLetterCollection = "outbox_dead_letter"
+	DefaultOutboxSequenceCollection   = "outbox_sequences"
+)
+
+// OutboxStatus is the delivery state of an outbox message
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "pending"
+	OutboxDelivered OutboxStatus = "delivered"
+	OutboxDead      OutboxStatus = "dead"
+)
+
+// OutboxMessage is a domain message stored in the outbox collection
+type OutboxMessage struct {
+	ID            bson.ObjectID     `bson:"_id" json:"_id"`
+	Topic         string            `bson:"topic" json:"topic"`
+	Key           string            `bson:"key" json:"key"`
+	Seq           int64             `bson:"seq,omitempty" json:"seq,omitempty"`
+	Payload       bson.RawValue     `bson:"payload" json:"payload"`
+	Headers       map[string]string `bson:"headers,omitempty" json:"headers,omitempty"`
+	Status        OutboxStatus      `bson:"status" json:"status"`
+	Attempts      int               `bson:"attempts" json:"attempts"`
+	LastError     string            `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt     time.Time         `bson:"createdAt" json:"createdAt"`
+	NextAttemptAt time.Time         `bson:"nextAttemptAt" json:"nextAttemptAt"`
+	DeliveredAt   time.Time         `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+}
+
+// DecodePayload unmarshals the payload into v
+func (m OutboxMessage) DecodePayload(v any) error {
+	return m.Payload.Unmarshal(v)
+}
+
+// Publisher delivers outbox messages to a broker
+type Publisher interface {
+	Publish(ctx context.Context, msg OutboxMessage) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, msg OutboxMessage) error
+
+// Publish calls f(ctx, msg)
+func (f PublisherFunc) Publish(ctx context.Context, msg OutboxMessage) error {
+	return f(ctx, msg)
+}
+
+// Outbox writes messages to the outbox collection
+type Outbox struct {
+	collection *mongo.Collection
+	deadLetter *mongo.Collection
+	sequences  *mongo.Collection
+}
+
+// NewOutbox creates a new outbox in the database
+func NewOutbox(db *mongo.Database) *Outbox {
+	return &Outbox{
+		collection: db.Collection(DefaultOutboxCollection),
+		deadLetter: db.Collection(DefaultOutboxDeadLetterCollection),
+		sequences:  db.Collection(DefaultOutboxSequenceCollection),
+	}
+}
+
+// EnsureIndexes creates the indexes used by the relay
+func (o *Outbox) EnsureIndexes(ctx context.Context) error {
+	_, err := o.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "key", Value: 1}, {Key: "seq", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "deliveredAt", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+	return nil
+}
+
+// Add writes a message to the outbox. Call it with the session context of a Transaction,
+// so the message is committed together with the business write.
+// Messages with the same non-empty key get a per-key sequence and are published in its order,
+// which is the commit order of their transactions: concurrent transactions adding to a key conflict
+// on its sequence and are retried. Outside a transaction, concurrent Adds of a key may be published
+// out of order. Messages without a key are not ordered.
+func (o *Outbox) Add(ctx context.Context, topic, key string, payload any, headers map[string]string) (bson.ObjectID, error) {
+	now := time.Now()
+	doc := bson.M{
+		"_id":           bson.NewObjectID(),
+		"topic":         topic,
+		"key":           key,
+		"payload":       payload,
+		"status":        OutboxPending,
+		"attempts":      0,
+		"createdAt":     now,
+		"nextAttemptAt": now,
+	}
+	if len(headers) > 0 {
+		doc["headers"] = headers
+	}
+	if key != "" {
+		var counter struct {
+			Value int64 `bson:"value"`
+		}
+		err := o.sequences.FindOneAndUpdate(ctx,
+			bson.M{"_id": key},
+			bson.M{"$inc": bson.M{"value": int64(1)}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&counter)
+		if err != nil {
+			return bson.ObjectID{}, fmt.Errorf("failed to reserve outbox sequence: %w", err)
+		}
+		doc["seq"] = counter.Value
+	}
+	if _, err := o.collection.InsertOne(ctx, doc); err != nil {
+		return bson.ObjectID{}, fmt.Errorf("failed to add outbox message: %w", err)
+	}
+	return doc["_id"].(bson.ObjectID), nil
+}
+
+// OutboxRelayOptions configures an OutboxRelay
+type OutboxRelayOptions struct {
+	// BatchSize is the number of pending messages read per poll, 100 by default
+	BatchSize int64
+	// PollInterval is the pause between polls when the outbox is drained, 1s by default
+	PollInterval time.Duration
+	// MaxAttempts moves a message to the dead-letter collection after that many failures, 10 by default
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the exponential delay between attempts, 1s and 5m by default
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Retention is how long delivered messages are kept before cleanup, 24h by default
+	Retention time.Duration
+	// OnError is called when publishing a message fails
+	OnError func(msg OutboxMessage, err error)
+	// OnRelayError is called when a relay pass fails, e.g. on a database error, before Run polls again
+	OnRelayError func(err error)
+}
+
+// OutboxRelay publishes outbox messages at least once, in order per key.
+// Only one relay should run per outbox, e.g. under a leader election.
+type OutboxRelay struct {
+	outbox      *Outbox
+	publisher   Publisher
+	opts        OutboxRelayOptions
+	lastCleanup time.Time
+}
+
+// NewOutboxRelay creates a relay publishing messages of the outbox
+func NewOutboxRelay(outbox *Outbox, publisher Publisher, opts OutboxRelayOptions) *OutboxRelay {
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 100
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 10
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 24 * time.Hour
+	}
+	return &OutboxRelay{outbox: outbox, publisher: publisher, opts: opts}
+}
+
+// Run relays messages until the context is canceled. Failed passes are reported to OnRelayError
+// and retried after the poll interval, so Run only returns when ctx is done.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	for {
+		published, err := r.RelayOnce(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil && r.opts.OnRelayError != nil {
+			r.opts.OnRelayError(err)
+		}
+		if err == nil && published > 0 {
+			continue
+		}
+		select {
+		case <-time.After(r.opts.PollInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// RelayOnce publishes one batch of due messages and returns the number of delivered ones
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	if err := r.cleanup(ctx); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	waiting, err := r.waitingKeys(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	filter := bson.M{"status": OutboxPending, "nextAttemptAt": bson.M{"$lte": now}}
+	if len(waiting) > 0 {
+		filter["key"] = bson.M{"$nin": waiting}
+	}
+	findOpts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(r.opts.BatchSize)
+	cursor, err := r.outbox.collection.Find(ctx, filter, findOpts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute find: %w", err)
+	}
+	var messages []OutboxMessage
+	if err = cursor.All(ctx, &messages); err != nil {
+		return 0, fmt.Errorf("failed to decode outbox messages: %w", err)
+	}
+
+	heads, err := r.pendingHeads(ctx, messages)
+	if err != nil {
+		return 0, err
+	}
+	messages = orderByKey(messages)
+
+	blocked := make(map[string]bool)
+	published := 0
+	for _, msg := range messages {
+		if heldBack(msg, heads, blocked) {
+			blocked[msg.Key] = true
+			continue
+		}
+
+		if err = r.publisher.Publish(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return published, ctx.Err()
+			}
+			if msg.Key != "" {
+				blocked[msg.Key] = true
+			}
+			if r.opts.OnError != nil {
+				r.opts.OnError(msg, err)
+			}
+			if err = r.fail(ctx, msg, err); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		update := bson.M{"$set": bson.M{"status": OutboxDelivered, "deliveredAt": time.Now()}, "$inc": bson.M{"attempts": 1}}
+		if _, err = r.outbox.collection.UpdateOne(ctx, bson.M{"_id": msg.ID}, update); err != nil {
+			return published, fmt.Errorf("failed to mark outbox message delivered: %w", err)
+		}
+		published++
+	}
+	return published, nil
+}
+
+// heldBack reports whether an earlier message of the key failed in this batch, or is pending but not part of it.
+// Messages without a key are never held back.
+func heldBack(msg OutboxMessage, heads map[string]int64, blocked map[string]bool) bool {
+	if msg.Key == "" {
+		return false
+	}
+	return blocked[msg.Key] || (msg.Seq > 0 && heads[msg.Key] > 0 && heads[msg.Key] < msg.Seq)
+}
+
+// waitingKeys returns the keys whose first pending message waits for a retry. Their messages are
+// left out of the batch, so they can't fill it and starve the other keys.
+func (r *OutboxRelay) waitingKeys(ctx context.Context, now time.Time) ([]string, error) {
+	cursor, err := r.outbox.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": OutboxPending, "key": bson.M{"$gt": ""}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "key", Value: 1}, {Key: "seq", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$key", "nextAttemptAt": bson.M{"$first": "$nextAttemptAt"}}}},
+		{{Key: "$match", Value: bson.M{"nextAttemptAt": bson.M{"$gt": now}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute aggregate: %w", err)
+	}
+	var groups []struct {
+		Key string `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode waiting outbox keys: %w", err)
+	}
+	keys := make([]string, len(groups))
+	for i, g := range groups {
+		keys[i] = g.Key
+	}
+	return keys, nil
+}
+
+// pendingHeads returns the lowest sequence of the pending messages of every key in the batch
+// that are not part of it, e.g. because they wait for a retry
+func (r *OutboxRelay) pendingHeads(ctx context.Context, messages []OutboxMessage) (map[string]int64, error) {
+	var (
+		keys []string
+		ids  []bson.ObjectID
+	)
+	for _, msg := range messages {
+		if msg.Key != "" && !slices.Contains(keys, msg.Key) {
+			keys = append(keys, msg.Key)
+		}
+		ids = append(ids, msg.ID)
+	}
+	heads := make(map[string]int64, len(keys))
+	if len(keys) == 0 {
+		return heads, nil
+	}
+
+	cursor, err := r.outbox.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"status": OutboxPending,
+			"key":    bson.M{"$in": keys},
+			"_id":    bson.M{"$nin": ids},
+			"seq":    bson.M{"$gt": 0},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$key", "seq": bson.M{"$min": "$seq"}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute aggregate: %w", err)
+	}
+	var groups []struct {
+		Key string `bson:"_id"`
+		Seq int64  `bson:"seq"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode outbox sequences: %w", err)
+	}
+	for _, g := range groups {
+		heads[g.Key] = g.Seq
+	}
+	return heads, nil
+}
+
+// orderByKey sorts messages of the same key by their sequence, keeping the keys in the order they first appear
+func orderByKey(messages []OutboxMessage) []OutboxMessage {
+	first := make(map[string]int, len(messages))
+	for i, msg := range messages {
+		if _, ok := first[msg.Key]; !ok {
+			first[msg.Key] = i
+		}
+	}
+	slices.SortStableFunc(messages, func(a, b OutboxMessage) int {
+		if c := cmp.Compare(first[a.Key], first[b.Key]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Seq, b.Seq)
+	})
+	return messages
+}
+
+// fail schedules a retry with exponential backoff, or moves the message to the dead-letter collection
+func (r *OutboxRelay) fail(ctx context.Context, msg OutboxMessage, cause error) error {
+	msg.Attempts++
+	msg.LastError = cause.Error()
+
+	if msg.Attempts >= r.opts.MaxAttempts {
+		msg.Status = OutboxDead
+		if _, err := r.outbox.deadLetter.InsertOne(ctx, msg); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to dead-letter outbox message: %w", err)
+		}
+		if _, err := r.outbox.collection.DeleteOne(ctx, bson.M{"_id": msg.ID}); err != nil {
+			return fmt.Errorf("failed to delete outbox message: %w", err)
+		}
+		return nil
+	}
+
+	backoff := r.opts.MinBackoff << (msg.Attempts - 1)
+	if backoff <= 0 || backoff > r.opts.MaxBackoff {
+		backoff = r.opts.MaxBackoff
+	}
+	update := bson.M{"$set": bson.M{
+		"attempts":      msg.Attempts,
+		"lastError":     msg.LastError,
+		"nextAttemptAt": time.Now().Add(backoff),
+	}}
+	if _, err := r.outbox.collection.UpdateOne(ctx, bson.M{"_id": msg.ID}, update); err != nil {
+		return fmt.Errorf("failed to reschedule outbox message: %w", err)
+	}
+	return nil
+}
+
+// cleanup deletes delivered messages older than the retention, at most once a minute
+func (r *OutboxRelay) cleanup(ctx context.Context) error {
+	if time.Since(r.lastCleanup) < time.Minute {
+		return nil
+	}
+	filter := bson.M{"status": OutboxDelivered, "deliveredAt": bson.M{"$lt": time.Now().Add(-r.opts.Retention)}}
+	if _, err := r.outbox.collection.DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("failed to delete delivered outbox messages: %w", err)
+	}
+	r.lastCleanup = time.Now()
+	return nil
+}
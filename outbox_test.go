@@ -0,0 +1,123 @@
+package mongoclient
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestOrderByKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []OutboxMessage
+		want     []string
+	}{
+		{
+			name:     "empty",
+			messages: nil,
+		},
+		{
+			name: "sequence order within a key",
+			messages: []OutboxMessage{
+				{Key: "a", Seq: 3, Topic: "a3"},
+				{Key: "a", Seq: 1, Topic: "a1"},
+				{Key: "a", Seq: 2, Topic: "a2"},
+			},
+			want: []string{"a1", "a2", "a3"},
+		},
+		{
+			name: "keys keep their first position",
+			messages: []OutboxMessage{
+				{Key: "b", Seq: 2, Topic: "b2"},
+				{Key: "a", Seq: 5, Topic: "a5"},
+				{Key: "b", Seq: 1, Topic: "b1"},
+				{Key: "a", Seq: 4, Topic: "a4"},
+			},
+			want: []string{"b1", "b2", "a4", "a5"},
+		},
+		{
+			name: "unkeyed messages keep their order",
+			messages: []OutboxMessage{
+				{Topic: "x"},
+				{Key: "a", Seq: 1, Topic: "a1"},
+				{Topic: "y"},
+			},
+			want: []string{"x", "y", "a1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, msg := range orderByKey(tt.messages) {
+				got = append(got, msg.Topic)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("orderByKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeldBack(t *testing.T) {
+	heads := map[string]int64{"a": 3}
+	blocked := map[string]bool{"b": true, "": true}
+
+	tests := []struct {
+		name string
+		msg  OutboxMessage
+		want bool
+	}{
+		{name: "unkeyed", msg: OutboxMessage{}, want: false},
+		{name: "key without earlier messages", msg: OutboxMessage{Key: "c", Seq: 1}, want: false},
+		{name: "earlier message pending outside the batch", msg: OutboxMessage{Key: "a", Seq: 4}, want: true},
+		{name: "head of the key", msg: OutboxMessage{Key: "a", Seq: 3}, want: false},
+		{name: "before the pending head", msg: OutboxMessage{Key: "a", Seq: 2}, want: false},
+		{name: "earlier message failed", msg: OutboxMessage{Key: "b", Seq: 9}, want: true},
+		{name: "key without sequence", msg: OutboxMessage{Key: "a"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := heldBack(tt.msg, heads, blocked); got != tt.want {
+				t.Errorf("heldBack(%+v) = %v, want %v", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutboxRelayRunKeepsRunningAfterErrors(t *testing.T) {
+	client, err := mongo.Connect(options.Client().ApplyURI("mongodb://localhost:1").SetServerSelectionTimeout(10 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var errs int
+	relay := NewOutboxRelay(NewOutbox(client.Database("test")), PublisherFunc(func(ctx context.Context, msg OutboxMessage) error {
+		return nil
+	}), OutboxRelayOptions{
+		PollInterval: time.Millisecond,
+		OnRelayError: func(err error) {
+			if errs++; errs == 3 {
+				cancel()
+			}
+		},
+	})
+
+	done := make(chan error)
+	go func() { done <- relay.Run(ctx) }()
+	select {
+	case err := <-done:
+		if err != nil || errs < 3 {
+			t.Errorf("Run() = %v after %d errors, want nil after 3", err, errs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() didn't return")
+	}
+}
@@ -0,0 +1,446 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	DefaultJobsCollection           = "jobs"
+	DefaultJobsDeadLetterCollection = "jobs_dead_letter"
+)
+
+var (
+	// ErrNoJobs is returned by Dequeue when no job is ready
+	ErrNoJobs = errors.New("no jobs available")
+	// ErrDuplicateJob is returned by Enqueue when a job with the same key is already queued
+	ErrDuplicateJob = errors.New("job with this key already exists")
+	// ErrLeaseLost is returned when the job lease expired and another worker took the job
+	ErrLeaseLost = errors.New("job lease lost")
+)
+
+// JobStatus is the state of a job
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDead    JobStatus = "dead"
+)
+
+// Job is a unit of work stored in the jobs collection
+type Job struct {
+	ID          bson.ObjectID `bson:"_id" json:"_id"`
+	Queue       string        `bson:"queue" json:"queue"`
+	Key         string        `bson:"key,omitempty" json:"key,omitempty"`
+	Payload     bson.RawValue `bson:"payload" json:"payload"`
+	Priority    int           `bson:"priority" json:"priority"`
+	Status      JobStatus     `bson:"status" json:"status"`
+	Attempts    int           `bson:"attempts" json:"attempts"`
+	MaxAttempts int           `bson:"maxAttempts" json:"maxAttempts"`
+	RunAt       time.Time     `bson:"runAt" json:"runAt"`
+	LeaseOwner  string        `bson:"leaseOwner,omitempty" json:"leaseOwner,omitempty"`
+	LeaseUntil  time.Time     `bson:"leaseUntil,omitempty" json:"leaseUntil,omitempty"`
+	LastError   string        `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt   time.Time     `bson:"createdAt" json:"createdAt"`
+}
+
+// DecodePayload unmarshals the payload into v
+func (j *Job) DecodePayload(v any) error {
+	return j.Payload.Unmarshal(v)
+}
+
+// QueueOptions configures a Queue
+type QueueOptions struct {
+	// VisibilityTimeout is how long a dequeued job is leased to a worker, 30s by default
+	VisibilityTimeout time.Duration
+	// MaxAttempts is the default number of attempts before a job is dead-lettered, 5 by default
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the exponential delay after a failed attempt, 1s and 10m by default
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PollInterval is the pause of an idle worker, 1s by default. Workers back off from it up to
+	// MaxBackoff after errors.
+	PollInterval time.Duration
+	// OnError is called when a worker fails to dequeue, ack, nack or heartbeat a job before it retries
+	OnError func(err error)
+}
+
+// EnqueueOptions configures a single job
+type EnqueueOptions struct {
+	// Priority orders ready jobs, higher first
+	Priority int
+	// Delay postpones the first attempt
+	Delay time.Duration
+	// Key makes the job unique in the queue until it's acknowledged
+	Key string
+	// MaxAttempts overrides the queue default
+	MaxAttempts int
+}
+
+// Queue is a durable work queue backed by a collection
+type Queue struct {
+	name       string
+	collection *mongo.Collection
+	deadLetter *mongo.Collection
+	opts       QueueOptions
+}
+
+// NewQueue creates a queue with the given name, queues share the jobs collection
+func NewQueue(db *mongo.Database, name string, opts QueueOptions) *Queue {
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30 * time.Second
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 5
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 10 * time.Minute
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	return &Queue{
+		name:       name,
+		collection: db.Collection(DefaultJobsCollection),
+		deadLetter: db.Collection(DefaultJobsDeadLetterCollection),
+		opts:       opts,
+	}
+}
+
+// EnsureIndexes creates the indexes used for dequeueing and unique keys
+func (q *Queue) EnsureIndexes(ctx context.Context) error {
+	_, err := q.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "queue", Value: 1}, {Key: "status", Value: 1}, {Key: "priority", Value: -1}, {Key: "runAt", Value: 1}}},
+		{Keys: bson.D{{Key: "queue", Value: 1}, {Key: "status", Value: 1}, {Key: "leaseUntil", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "queue", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"key": bson.M{"$type": "string"}}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+	return nil
+}
+
+// Enqueue adds a job to the queue
+func (q *Queue) Enqueue(ctx context.Context, payload any, opts ...EnqueueOptions) (bson.ObjectID, error) {
+	var eo EnqueueOptions
+	if len(opts) > 0 {
+		eo = opts[0]
+	}
+	if eo.MaxAttempts < 1 {
+		eo.MaxAttempts = q.opts.MaxAttempts
+	}
+
+	now := time.Now()
+	doc := bson.M{
+		"_id":         bson.NewObjectID(),
+		"queue":       q.name,
+		"payload":     payload,
+		"priority":    eo.Priority,
+		"status":      JobQueued,
+		"attempts":    0,
+		"maxAttempts": eo.MaxAttempts,
+		"runAt":       now.Add(eo.Delay),
+		"createdAt":   now,
+	}
+	if eo.Key != "" {
+		doc["key"] = eo.Key
+	}
+
+	if _, err := q.collection.InsertOne(ctx, doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return bson.ObjectID{}, ErrDuplicateJob
+		}
+		return bson.ObjectID{}, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return doc["_id"].(bson.ObjectID), nil
+}
+
+// Dequeue atomically leases the next ready job, or a job whose lease expired.
+// It returns ErrNoJobs if there is nothing to do.
+func (q *Queue) Dequeue(ctx context.Context) (*Job, error) {
+	for {
+		now := time.Now()
+		filter := bson.M{
+			"queue": q.name,
+			"$or": bson.A{
+				bson.M{"status": JobQueued, "runAt": bson.M{"$lte": now}},
+				bson.M{"status": JobRunning, "leaseUntil": bson.M{"$lt": now}},
+			},
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"status":     JobRunning,
+				"leaseOwner": bson.NewObjectID().Hex(),
+				"leaseUntil": now.Add(q.opts.VisibilityTimeout),
+			},
+			"$inc": bson.M{"attempts": 1},
+		}
+		opts := options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "runAt", Value: 1}}).
+			SetReturnDocument(options.After)
+
+		var job Job
+		err := q.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNoJobs
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to dequeue job: %w", err)
+		}
+
+		// A job whose worker died on its last attempt is dead-lettered instead of retried.
+		if job.Attempts > job.MaxAttempts {
+			if err = q.bury(ctx, &job, "lease expired on the last attempt"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return &job, nil
+	}
+}
+
+// Heartbeat extends the lease of a running job
+func (q *Queue) Heartbeat(ctx context.Context, job *Job) error {
+	leaseUntil := time.Now().Add(q.opts.VisibilityTimeout)
+	result, err := q.collection.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "leaseOwner": job.LeaseOwner},
+		bson.M{"$set": bson.M{"leaseUntil": leaseUntil}})
+	if err != nil {
+		return fmt.Errorf("failed to extend job lease: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	job.LeaseUntil = leaseUntil
+	return nil
+}
+
+// Ack marks the job as done and removes it from the queue
+func (q *Queue) Ack(ctx context.Context, job *Job) error {
+	result, err := q.collection.DeleteOne(ctx, bson.M{"_id": job.ID, "leaseOwner": job.LeaseOwner})
+	if err != nil {
+		return fmt.Errorf("failed to ack job: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Nack returns the job to the queue with exponential backoff,
+// or moves it to the dead-letter collection after the last attempt
+func (q *Queue) Nack(ctx context.Context, job *Job, cause error) error {
+	reason := "nack"
+	if cause != nil {
+		reason = cause.Error()
+	}
+	if job.Attempts >= job.MaxAttempts {
+		return q.bury(ctx, job, reason)
+	}
+
+	result, err := q.collection.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "leaseOwner": job.LeaseOwner},
+		bson.M{
+			"$set":   bson.M{"status": JobQueued, "runAt": time.Now().Add(q.backoff(job.Attempts)), "lastError": reason},
+			"$unset": bson.M{"leaseOwner": "", "leaseUntil": ""},
+		})
+	if err != nil {
+		return fmt.Errorf("failed to nack job: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// backoff returns the delay before the next attempt of a job that failed the given attempt
+func (q *Queue) backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		return q.opts.MaxBackoff
+	}
+	backoff := q.opts.MinBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > q.opts.MaxBackoff {
+		return q.opts.MaxBackoff
+	}
+	return backoff
+}
+
+// release returns a job interrupted by a worker shutdown to the queue, ready to run again.
+// The attempt taken by Dequeue is given back, as the job didn't fail.
+func (q *Queue) release(ctx context.Context, job *Job) error {
+	result, err := q.collection.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "leaseOwner": job.LeaseOwner},
+		bson.M{
+			"$set":   bson.M{"status": JobQueued, "runAt": time.Now()},
+			"$unset": bson.M{"leaseOwner": "", "leaseUntil": ""},
+			"$inc":   bson.M{"attempts": -1},
+		})
+	if err != nil {
+		return fmt.Errorf("failed to release job: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// bury moves the job to the dead-letter collection
+func (q *Queue) bury(ctx context.Context, job *Job, reason string) error {
+	job.Status = JobDead
+	job.LastError = reason
+	if _, err := q.deadLetter.InsertOne(ctx, job); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to dead-letter job: %w", err)
+	}
+	if _, err := q.collection.DeleteOne(ctx, bson.M{"_id": job.ID, "leaseOwner": job.LeaseOwner}); err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+	return nil
+}
+
+// JobHandler processes a job, returning an error nacks it
+type JobHandler func(ctx context.Context, job *Job) error
+
+// Run processes jobs with the given number of workers until the context is canceled.
+// While a job runs its lease is extended in the background; if the lease is lost, or can't be
+// extended before it expires, the handler context is canceled. A job that fails because ctx is
+// canceled is returned to the queue without counting the attempt. Errors of the queue operations
+// are reported to OnError and retried with backoff, so Run only returns when ctx is done.
+func (q *Queue) Run(ctx context.Context, workers int, handler JobHandler) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, handler)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// work runs jobs one by one, pausing when the queue is empty and backing off after errors
+func (q *Queue) work(ctx context.Context, handler JobHandler) {
+	delay := q.opts.PollInterval
+	for ctx.Err() == nil {
+		job, err := q.Dequeue(ctx)
+		if err == nil {
+			err = q.process(ctx, job, handler)
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == nil:
+			delay = q.opts.PollInterval
+			continue
+		case errors.Is(err, ErrNoJobs):
+			delay = q.opts.PollInterval
+		default:
+			q.reportError(err)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		if err != ErrNoJobs {
+			delay = min(delay*2, q.opts.MaxBackoff)
+		}
+	}
+}
+
+func (q *Queue) reportError(err error) {
+	if q.opts.OnError != nil {
+		q.opts.OnError(err)
+	}
+}
+
+// process runs the handler with lease renewal and acks or nacks the job
+func (q *Queue) process(ctx context.Context, job *Job, handler JobHandler) error {
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	done := make(chan struct{})
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		q.heartbeat(jobCtx, cancel, *job, done)
+	}()
+
+	err := handler(jobCtx, job)
+	close(done)
+	<-heartbeatDone
+
+	// The lease is gone, another worker may own the job now.
+	if jobCtx.Err() != nil && ctx.Err() == nil {
+		return nil
+	}
+	bg := context.WithoutCancel(ctx)
+	switch {
+	case err == nil:
+		err = q.Ack(bg, job)
+	case ctx.Err() != nil:
+		// The worker is shutting down, the job didn't fail.
+		err = q.release(bg, job)
+	default:
+		err = q.Nack(bg, job, err)
+	}
+	if errors.Is(err, ErrLeaseLost) {
+		return nil
+	}
+	return err
+}
+
+// heartbeat extends the lease of a copy of the job every third of the visibility timeout until done
+// is closed, so the handler's job isn't written concurrently. A failed heartbeat is retried on the
+// next tick; the job is canceled when the lease is lost or has less than one interval left.
+func (q *Queue) heartbeat(ctx context.Context, cancel context.CancelCauseFunc, job Job, done <-chan struct{}) {
+	interval := q.opts.VisibilityTimeout / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// The request can't extend a lease that already expired.
+			hbCtx, hbCancel := context.WithDeadline(ctx, job.LeaseUntil)
+			err := q.Heartbeat(hbCtx, &job)
+			hbCancel()
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, ErrLeaseLost) {
+				cancel(err)
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			q.reportError(err)
+			if time.Until(job.LeaseUntil) < interval {
+				cancel(fmt.Errorf("%w: %w", ErrLeaseLost, err))
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueueBackoff(t *testing.T) {
+	q := NewQueue(testDatabase(t), "test", QueueOptions{MinBackoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 10 * time.Second},
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 4, want: 8 * time.Second},
+		{attempt: 5, want: 10 * time.Second},
+		{attempt: 80, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := q.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestQueueProcess(t *testing.T) {
+	// The database is unreachable, so the error names the operation that settled the job.
+	q := NewQueue(testDatabase(t), "test", QueueOptions{})
+
+	tests := []struct {
+		name     string
+		shutdown bool
+		failed   bool
+		want     string
+	}{
+		{name: "success", want: "failed to ack job"},
+		{name: "failure", failed: true, want: "failed to nack job"},
+		{name: "failure on shutdown", shutdown: true, failed: true, want: "failed to release job"},
+		{name: "success on shutdown", shutdown: true, want: "failed to ack job"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			job := &Job{Attempts: 1, MaxAttempts: 5, LeaseUntil: time.Now().Add(time.Minute)}
+
+			err := q.process(ctx, job, func(ctx context.Context, job *Job) error {
+				if tt.shutdown {
+					cancel()
+				}
+				if tt.failed {
+					return errors.New("boom")
+				}
+				return nil
+			})
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("process() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/topology"
+)
+
+// ErrorClass is the retry classification of a driver error
+type ErrorClass int
+
+const (
+	// ErrorClassPermanent errors are not retried
+	ErrorClassPermanent ErrorClass = iota
+	// ErrorClassNetwork errors happened on the connection, the operation may have been applied
+	ErrorClassNetwork
+	// ErrorClassRetryableWrite errors carry the RetryableWriteError label, the write may have been applied
+	ErrorClassRetryableWrite
+	// ErrorClassTransientTransaction errors carry the TransientTransactionError label
+	ErrorClassTransientTransaction
+	// ErrorClassNotPrimary errors come from a node that is not primary, or no primary could be
+	// selected, the operation was not applied
+	ErrorClassNotPrimary
+	// ErrorClassExceededTimeLimit errors come from a server running out of its time limit
+	ErrorClassExceededTimeLimit
+	// ErrorClassPoolTimeout errors happen waiting for a pooled connection, the operation was not sent
+	ErrorClassPoolTimeout
+	// ErrorClassNoWritesPerformed errors carry the NoWritesPerformed label, the write was not applied
+	ErrorClassNoWritesPerformed
+	// ErrorClassInterrupted errors come from operations interrupted by a shutdown or a step down,
+	// multi-document writes may have been applied partly
+	ErrorClassInterrupted
+	// ErrorClassWriteConcern errors carry a write concern error, the write was applied but may not be durable
+	ErrorClassWriteConcern
+)
+
+var errorClassNames = map[ErrorClass]string{
+	ErrorClassPermanent:            "permanent",
+	ErrorClassNetwork:              "network",
+	ErrorClassRetryableWrite:       "retryable write",
+	ErrorClassTransientTransaction: "transient transaction",
+	ErrorClassNotPrimary:           "not primary",
+	ErrorClassExceededTimeLimit:    "exceeded time limit",
+	ErrorClassPoolTimeout:          "pool timeout",
+	ErrorClassNoWritesPerformed:    "no writes performed",
+	ErrorClassInterrupted:          "interrupted",
+	ErrorClassWriteConcern:         "write concern",
+}
+
+func (c ErrorClass) String() string {
+	return errorClassNames[c]
+}
+
+// Retryable reports whether operations failing with the class may succeed when retried
+func (c ErrorClass) Retryable() bool {
+	return c != ErrorClassPermanent
+}
+
+// NotApplied reports whether the failed operation certainly had no effect, so even
+// non-idempotent writes can be retried
+func (c ErrorClass) NotApplied() bool {
+	return c == ErrorClassNoWritesPerformed || c == ErrorClassNotPrimary || c == ErrorClassPoolTimeout
+}
+
+// notPrimaryCodes are the server error codes of nodes that rejected the operation before running it
+var notPrimaryCodes = []int{
+	10107, // NotWritablePrimary
+	13435, // NotPrimaryNoSecondaryOk
+	13436, // NotPrimaryOrSecondary
+}
+
+// interruptedCodes are the server error codes of operations killed while they may have been running
+var interruptedCodes = []int{
+	11600, // InterruptedAtShutdown
+	11602, // InterruptedDueToReplStateChange
+	189,   // PrimarySteppedDown
+	91,    // ShutdownInProgress
+}
+
+// ClassifyError returns the retry classification of the error
+func ClassifyError(err error) ErrorClass {
+	// Pool and server selection timeouts may wrap context.DeadlineExceeded, the operation was not sent anyway.
+	var (
+		wqe topology.WaitQueueTimeoutError
+		sse topology.ServerSelectionError
+	)
+	switch {
+	case err == nil:
+		return ErrorClassPermanent
+	case errors.As(err, &wqe):
+		return ErrorClassPoolTimeout
+	case errors.As(err, &sse):
+		return ErrorClassNotPrimary
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassPermanent
+	case hasErrorLabel(err, "NoWritesPerformed"):
+		return ErrorClassNoWritesPerformed
+	case hasWriteConcernError(err):
+		return ErrorClassWriteConcern
+	}
+
+	var se mongo.ServerError
+	if errors.As(err, &se) {
+		for _, code := range notPrimaryCodes {
+			if se.HasErrorCode(code) {
+				return ErrorClassNotPrimary
+			}
+		}
+		for _, code := range interruptedCodes {
+			if se.HasErrorCode(code) {
+				return ErrorClassInterrupted
+			}
+		}
+		if se.HasErrorCode(262) { // ExceededTimeLimit
+			return ErrorClassExceededTimeLimit
+		}
+	}
+	switch {
+	case mongo.IsNetworkError(err):
+		return ErrorClassNetwork
+	case hasErrorLabel(err, "RetryableWriteError"):
+		return ErrorClassRetryableWrite
+	case hasErrorLabel(err, labelTransientTransaction):
+		return ErrorClassTransientTransaction
+	}
+	return ErrorClassPermanent
+}
+
+// hasWriteConcernError reports whether the write was applied but failed its write concern
+func hasWriteConcernError(err error) bool {
+	var (
+		we  mongo.WriteException
+		bwe mongo.BulkWriteException
+	)
+	return (errors.As(err, &we) && we.WriteConcernError != nil) ||
+		(errors.As(err, &bwe) && bwe.WriteConcernError != nil)
+}
+
+// RetryPolicy configures retries of an operation
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one, 3 by default; 1 disables retries
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, 100ms by default
+	InitialBackoff time.Duration
+	// MaxBackoff bounds the delay between attempts, 5s by default
+	MaxBackoff time.Duration
+	// Jitter randomizes delays by up to this fraction, 0.2 by default
+	Jitter float64
+	// Budget bounds the total time of all attempts, the context deadline bounds it too
+	Budget time.Duration
+	// Idempotent allows retrying writes after errors that leave their outcome unknown,
+	// set it for writes that can be applied twice safely, e.g. $set by _id
+	Idempotent bool
+}
+
+// RetryAttempt describes a failed attempt passed to the OnRetry hook
+type RetryAttempt struct {
+	Method  string
+	Attempt int
+	Err     error
+	Class   ErrorClass
+	// Delay is the pause before the next attempt, zero if the call gives up
+	Delay time.Duration
+}
+
+// RetryOptions configures a RetryRepository
+type RetryOptions struct {
+	// Default applies to methods without their own policy
+	Default RetryPolicy
+	// Methods overrides the policy per method name, e.g. "UpdateOne"
+	Methods map[string]RetryPolicy
+	// OnRetry is called after every failed attempt with a retryable error
+	OnRetry func(attempt RetryAttempt)
+}
+
+// RetryRepository is a decorator of a repository that retries operations failing with
+// transient errors. Reads are retried on every retryable error; writes only when the error
+// guarantees they were not applied, or on any retryable error if their policy is Idempotent.
+// Operations inside transactions are not retried, WithTransaction retries the whole transaction.
+type RetryRepository[T any] struct {
+	IRepository[T]
+	opts RetryOptions
+}
+
+// NewRetryRepository wraps the repository with retries
+func NewRetryRepository[T any](repo IRepository[T], opts RetryOptions) *RetryRepository[T] {
+	opts.Default = opts.Default.withDefaults()
+	methods := make(map[string]RetryPolicy, len(opts.Methods))
+	for method, policy := range opts.Methods {
+		methods[method] = policy.withDefaults()
+	}
+	opts.Methods = methods
+	return &RetryRepository[T]{IRepository: repo, opts: opts}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 5 * time.Second
+	}
+	if p.Jitter <= 0 {
+		p.Jitter = 0.2
+	}
+	return p
+}
+
+// backoff returns the delay after the failed attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff << (attempt - 1)
+	if delay <= 0 || delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	jitter := 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(float64(delay) * jitter)
+}
+
+// retryCall runs fn with the policy of the method until it succeeds, fails permanently
+// or the attempts or budget run out
+func retryCall[R any](ctx context.Context, opts RetryOptions, method string, write bool, fn func() (R, error)) (R, error) {
+	policy, ok := opts.Methods[method]
+	if !ok {
+		policy = opts.Default
+	}
+	if TransactionSession(ctx) != nil {
+		return fn()
+	}
+
+	var deadline time.Time
+	if policy.Budget > 0 {
+		deadline = time.Now().Add(policy.Budget)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		class := ClassifyError(err)
+		if err == nil || !class.Retryable() || (write && !policy.Idempotent && !class.NotApplied()) {
+			return result, err
+		}
+
+		delay := policy.backoff(attempt)
+		giveUp := attempt >= policy.MaxAttempts || (!deadline.IsZero() && time.Now().Add(delay).After(deadline))
+		if giveUp {
+			delay = 0
+		}
+		if opts.OnRetry != nil {
+			opts.OnRetry(RetryAttempt{Method: method, Attempt: attempt, Err: err, Class: class, Delay: delay})
+		}
+		if giveUp {
+			return result, err
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return result, err
+		}
+	}
+}
+
+// retryErr adapts retryCall to methods that return only an error
+func retryErr(ctx context.Context, opts RetryOptions, method string, write bool, fn func() error) error {
+	_, err := retryCall(ctx, opts, method, write, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+// InsertOne inserts a new document with retries. When only reading the inserted document
+// fails, the read is retried with the FindByID policy instead of the insert.
+func (r *RetryRepository[T]) InsertOne(ctx context.Context, document T, opts ...options.Lister[options.InsertOneOptions]) (T, error) {
+	var insertedID any
+	inserted, err := retryCall(ctx, r.opts, "InsertOne", true, func() (T, error) {
+		inserted, err := r.IRepository.InsertOne(ctx, document, opts...)
+		var fe *InsertedFetchError
+		if errors.As(err, &fe) {
+			insertedID = fe.ID
+			return inserted, nil
+		}
+		return inserted, err
+	})
+	if err != nil || insertedID == nil {
+		return inserted, err
+	}
+	return retryCall(ctx, r.opts, "FindByID", false, func() (T, error) {
+		return r.IRepository.FindByID(ctx, insertedID)
+	})
+}
+
+// InsertMany inserts multiple documents with retries
+func (r *RetryRepository[T]) InsertMany(ctx context.Context, documents []T, opts ...options.Lister[options.InsertManyOptions]) ([]any, error) {
+	return retryCall(ctx, r.opts, "InsertMany", true, func() ([]any, error) {
+		return r.IRepository.InsertMany(ctx, documents, opts...)
+	})
+}
+
+// Find retrieves multiple documents with retries
+func (r *RetryRepository[T]) Find(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) ([]T, error) {
+	return retryCall(ctx, r.opts, "Find", false, func() ([]T, error) {
+		return r.IRepository.Find(ctx, filter, opts...)
+	})
+}
+
+// FindPaginated retrieves a page of documents with retries
+func (r *RetryRepository[T]) FindPaginated(ctx context.Context, filter any, page, pageSize int64) ([]T, error) {
+	return retryCall(ctx, r.opts, "FindPaginated", false, func() ([]T, error) {
+		return r.IRepository.FindPaginated(ctx, filter, page, pageSize)
+	})
+}
+
+// FindPaginatedWithTotal retrieves a page of documents and the total count with retries
+func (r *RetryRepository[T]) FindPaginatedWithTotal(ctx context.Context, filter any, page, pageSize int64) ([]T, int64, error) {
+	var total int64
+	documents, err := retryCall(ctx, r.opts, "FindPaginatedWithTotal", false, func() ([]T, error) {
+		var (
+			documents []T
+			err       error
+		)
+		documents, total, err = r.IRepository.FindPaginatedWithTotal(ctx, filter, page, pageSize)
+		return documents, err
+	})
+	return documents, total, err
+}
+
+// FindOne retrieves a single document with retries
+func (r *RetryRepository[T]) FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) (T, error) {
+	return retryCall(ctx, r.opts, "FindOne", false, func() (T, error) {
+		return r.IRepository.FindOne(ctx, filter, opts...)
+	})
+}
+
+// FindByID finds a document by its ID with retries
+func (r *RetryRepository[T]) FindByID(ctx context.Context, id any, opts ...options.Lister[options.FindOneOptions]) (T, error) {
+	return retryCall(ctx, r.opts, "FindByID", false, func() (T, error) {
+		return r.IRepository.FindByID(ctx, id, opts...)
+	})
+}
+
+// FindOneAndUpdate finds a document and updates it with retries
+func (r *RetryRepository[T]) FindOneAndUpdate(ctx context.Context, filter, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) (T, error) {
+	return retryCall(ctx, r.opts, "FindOneAndUpdate", true, func() (T, error) {
+		return r.IRepository.FindOneAndUpdate(ctx, filter, update, opts...)
+	})
+}
+
+// FindOneAndUpdateByID finds a document by its ID and updates it with retries
+func (r *RetryRepository[T]) FindOneAndUpdateByID(ctx context.Context, id, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) (T, error) {
+	return retryCall(ctx, r.opts, "FindOneAndUpdateByID", true, func() (T, error) {
+		return r.IRepository.FindOneAndUpdateByID(ctx, id, update, opts...)
+	})
+}
+
+// FindOneAndDelete finds a document and deletes it with retries
+func (r *RetryRepository[T]) FindOneAndDelete(ctx context.Context, filter any, opts ...options.Lister[options.FindOneAndDeleteOptions]) (T, error) {
+	return retryCall(ctx, r.opts, "FindOneAndDelete", true, func() (T, error) {
+		return r.IRepository.FindOneAndDelete(ctx, filter, opts...)
+	})
+}
+
+// UpdateOne updates a single document with retries
+func (r *RetryRepository[T]) UpdateOne(ctx context.Context, filter, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+	return retryCall(ctx, r.opts, "UpdateOne", true, func() (*mongo.UpdateResult, error) {
+		return r.IRepository.UpdateOne(ctx, filter, update, opts...)
+	})
+}
+
+// UpdateByID updates a document by its ID with retries
+func (r *RetryRepository[T]) UpdateByID(ctx context.Context, id any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+	return retryCall(ctx, r.opts, "UpdateByID", true, func() (*mongo.UpdateResult, error) {
+		return r.IRepository.UpdateByID(ctx, id, update, opts...)
+	})
+}
+
+// UpdateMany updates multiple documents with retries
+func (r *RetryRepository[T]) UpdateMany(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateManyOptions]) (*mongo.UpdateResult, error) {
+	return retryCall(ctx, r.opts, "UpdateMany", true, func() (*mongo.UpdateResult, error) {
+		return r.IRepository.UpdateMany(ctx, filter, update, opts...)
+	})
+}
+
+// DeleteOne removes a single document with retries
+func (r *RetryRepository[T]) DeleteOne(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) error {
+	return retryErr(ctx, r.opts, "DeleteOne", true, func() error {
+		return r.IRepository.DeleteOne(ctx, filter, opts...)
+	})
+}
+
+// DeleteByID removes a document by its ID with retries
+func (r *RetryRepository[T]) DeleteByID(ctx context.Context, id any, opts ...options.Lister[options.DeleteOneOptions]) error {
+	return retryErr(ctx, r.opts, "DeleteByID", true, func() error {
+		return r.IRepository.DeleteByID(ctx, id, opts...)
+	})
+}
+
+// DeleteMany removes multiple documents with retries
+func (r *RetryRepository[T]) DeleteMany(ctx context.Context, filter any, opts ...options.Lister[options.DeleteManyOptions]) (int64, error) {
+	return retryCall(ctx, r.opts, "DeleteMany", true, func() (int64, error) {
+		return r.IRepository.DeleteMany(ctx, filter, opts...)
+	})
+}
+
+// EstimatedCount returns the estimated number of documents with retries
+func (r *RetryRepository[T]) EstimatedCount(ctx context.Context, opts ...options.Lister[options.EstimatedDocumentCountOptions]) (int64, error) {
+	return retryCall(ctx, r.opts, "EstimatedCount", false, func() (int64, error) {
+		return r.IRepository.EstimatedCount(ctx, opts...)
+	})
+}
+
+// CountDocuments counts matching documents with retries
+func (r *RetryRepository[T]) CountDocuments(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+	return retryCall(ctx, r.opts, "CountDocuments", false, func() (int64, error) {
+		return r.IRepository.CountDocuments(ctx, filter, opts...)
+	})
+}
+
+// Aggregate runs an aggregation pipeline with retries.
+// Pipelines with $out or $merge write, give them an Idempotent policy only if they are safe to rerun.
+func (r *RetryRepository[T]) Aggregate(ctx context.Context, pipeline any, opts ...options.Lister[options.AggregateOptions]) ([]bson.M, error) {
+	return retryCall(ctx, r.opts, "Aggregate", false, func() ([]bson.M, error) {
+		return r.IRepository.Aggregate(ctx, pipeline, opts...)
+	})
+}
+
+// AggregateTyped runs an aggregation pipeline decoding results into T with retries
+func (r *RetryRepository[T]) AggregateTyped(ctx context.Context, pipeline any, opts ...options.Lister[options.AggregateOptions]) ([]T, error) {
+	return retryCall(ctx, r.opts, "AggregateTyped", false, func() ([]T, error) {
+		return r.IRepository.AggregateTyped(ctx, pipeline, opts...)
+	})
+}
+
+// Distinct returns the distinct values of a field with retries
+func (r *RetryRepository[T]) Distinct(ctx context.Context, fieldName string, filter any, opts ...options.Lister[options.DistinctOptions]) ([]any, error) {
+	return retryCall(ctx, r.opts, "Distinct", false, func() ([]any, error) {
+		return r.IRepository.Distinct(ctx, fieldName, filter, opts...)
+	})
+}
+
+// BulkWrite executes bulk write operations with retries
+func (r *RetryRepository[T]) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...options.Lister[options.BulkWriteOptions]) (*mongo.BulkWriteResult, error) {
+	return retryCall(ctx, r.opts, "BulkWrite", true, func() (*mongo.BulkWriteResult, error) {
+		return r.IRepository.BulkWrite(ctx, models, opts...)
+	})
+}
+
+// GetIndexes returns the indexes of the collection with retries
+func (r *RetryRepository[T]) GetIndexes(ctx context.Context, opts ...options.Lister[options.ListIndexesOptions]) ([]bson.M, error) {
+	return retryCall(ctx, r.opts, "GetIndexes", false, func() ([]bson.M, error) {
+		return r.IRepository.GetIndexes(ctx, opts...)
+	})
+}
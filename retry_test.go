@@ -0,0 +1,100 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/x/mongo/driver/topology"
+)
+
+func TestClassifyError(t *testing.T) {
+	retryable := []string{"RetryableWriteError"}
+	wce := &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"}
+
+	tests := []struct {
+		name       string
+		err        error
+		want       ErrorClass
+		notApplied bool
+	}{
+		{name: "nil", err: nil, want: ErrorClassPermanent},
+		{name: "canceled", err: context.Canceled, want: ErrorClassPermanent},
+		{name: "client deadline", err: fmt.Errorf("find: %w", context.DeadlineExceeded), want: ErrorClassPermanent},
+		{name: "plain error", err: errors.New("boom"), want: ErrorClassPermanent},
+		{name: "duplicate key", err: mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}, want: ErrorClassPermanent},
+		{name: "pool timeout", err: topology.WaitQueueTimeoutError{Wrapped: context.DeadlineExceeded}, want: ErrorClassPoolTimeout, notApplied: true},
+		{name: "server selection", err: topology.ServerSelectionError{Wrapped: context.DeadlineExceeded}, want: ErrorClassNotPrimary, notApplied: true},
+		{
+			name:       "no writes performed",
+			err:        mongo.CommandError{Code: 91, Labels: []string{"RetryableWriteError", "NoWritesPerformed"}},
+			want:       ErrorClassNoWritesPerformed,
+			notApplied: true,
+		},
+		{name: "not writable primary", err: mongo.CommandError{Code: 10107, Labels: retryable}, want: ErrorClassNotPrimary, notApplied: true},
+		{name: "not primary no secondary ok", err: mongo.CommandError{Code: 13435}, want: ErrorClassNotPrimary, notApplied: true},
+		{name: "interrupted at shutdown", err: mongo.CommandError{Code: 11600, Labels: retryable}, want: ErrorClassInterrupted},
+		{name: "interrupted by step down", err: mongo.CommandError{Code: 11602, Labels: retryable}, want: ErrorClassInterrupted},
+		{name: "shutdown in progress", err: mongo.CommandError{Code: 91, Labels: retryable}, want: ErrorClassInterrupted},
+		{name: "primary stepped down", err: mongo.CommandError{Code: 189, Labels: retryable}, want: ErrorClassInterrupted},
+		{name: "exceeded time limit", err: mongo.CommandError{Code: 262}, want: ErrorClassExceededTimeLimit},
+		{name: "network", err: mongo.CommandError{Labels: []string{"NetworkError"}}, want: ErrorClassNetwork},
+		{name: "network with retryable label", err: mongo.CommandError{Labels: []string{"NetworkError", "RetryableWriteError"}}, want: ErrorClassNetwork},
+		{name: "write concern error", err: mongo.WriteException{WriteConcernError: wce, Labels: retryable}, want: ErrorClassWriteConcern},
+		{
+			name: "write concern error with shutdown code",
+			err:  mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: 91}, Labels: retryable},
+			want: ErrorClassWriteConcern,
+		},
+		{name: "bulk write concern error", err: mongo.BulkWriteException{WriteConcernError: wce}, want: ErrorClassWriteConcern},
+		{name: "retryable write label only", err: mongo.CommandError{Code: 6, Labels: retryable}, want: ErrorClassRetryableWrite},
+		{
+			name: "transient transaction",
+			err:  mongo.CommandError{Code: 112, Labels: []string{"TransientTransactionError"}},
+			want: ErrorClassTransientTransaction,
+		},
+		{name: "wrapped", err: fmt.Errorf("failed: %w", mongo.CommandError{Code: 10107}), want: ErrorClassNotPrimary, notApplied: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClassifyError(tt.err)
+			if got != tt.want {
+				t.Errorf("ClassifyError() = %s, want %s", got, tt.want)
+			}
+			if got.NotApplied() != tt.notApplied {
+				t.Errorf("NotApplied() = %v, want %v", got.NotApplied(), tt.notApplied)
+			}
+			if got.Retryable() != (tt.want != ErrorClassPermanent) {
+				t.Errorf("Retryable() = %v", got.Retryable())
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.2}.withDefaults()
+
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{80, time.Second},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			got := p.backoff(tt.attempt)
+			low, high := time.Duration(float64(tt.base)*0.8), time.Duration(float64(tt.base)*1.2)
+			if got < low || got > high {
+				t.Fatalf("backoff(%d) = %s, want within [%s, %s]", tt.attempt, got, low, high)
+			}
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package mongoclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// IDRange is a range of _id values in the server sort order, Min is inclusive and Max is exclusive.
+// A zero Min or Max leaves that side of the range open. Bounds may have different BSON types.
+type IDRange struct {
+	Min bson.RawValue
+	Max bson.RawValue
+}
+
+// bsonTypeBrackets lists the BSON types in the order the server sorts them.
+// Range operators only match values of the bound's bracket, e.g. {$gte: ObjectID} skips strings.
+var bsonTypeBrackets = [][]string{
+	{"minKey"},
+	{"null"},
+	{"int", "long", "double", "decimal"},
+	{"symbol", "string"},
+	{"object"},
+	{"binData"},
+	{"objectId"},
+	{"bool"},
+	{"date"},
+	{"timestamp"},
+	{"maxKey"},
+}
+
+// typeBracket returns the index of the bracket of a BSON type in bsonTypeBrackets
+func typeBracket(t bson.Type) int {
+	switch t {
+	case bson.TypeMinKey:
+		return 0
+	case bson.TypeNull, bson.TypeUndefined:
+		return 1
+	case bson.TypeInt32, bson.TypeInt64, bson.TypeDouble, bson.TypeDecimal128:
+		return 2
+	case bson.TypeSymbol, bson.TypeString:
+		return 3
+	case bson.TypeEmbeddedDocument:
+		return 4
+	case bson.TypeBinary:
+		return 5
+	case bson.TypeObjectID:
+		return 6
+	case bson.TypeBoolean:
+		return 7
+	case bson.TypeDateTime:
+		return 8
+	case bson.TypeTimestamp:
+		return 9
+	default:
+		return 10
+	}
+}
+
+// singleValueBracket reports whether all values of the bracket are equal, so range operators don't apply
+func singleValueBracket(i int) bool {
+	return i == 0 || i == 1 || i == len(bsonTypeBrackets)-1
+}
+
+// Filter returns the _id condition of the range. Bounds only bound values of their own type
+// bracket, values of the brackets between them are matched by type, so _id values of every
+// type are covered by exactly one range of a split.
+func (r IDRange) Filter() bson.M {
+	if r.Min.IsZero() && r.Max.IsZero() {
+		return bson.M{}
+	}
+
+	lo, hi := 0, len(bsonTypeBrackets)-1
+	if !r.Min.IsZero() {
+		lo = typeBracket(r.Min.Type)
+	}
+	if !r.Max.IsZero() {
+		hi = typeBracket(r.Max.Type)
+	}
+	if lo == hi && !r.Min.IsZero() && !r.Max.IsZero() && !singleValueBracket(lo) {
+		return bson.M{"_id": bson.D{{Key: "$gte", Value: r.Min}, {Key: "$lt", Value: r.Max}}}
+	}
+
+	var conds bson.A
+	first, last := lo, hi
+	if !r.Min.IsZero() && !singleValueBracket(lo) {
+		conds = append(conds, bson.M{"_id": bson.M{"$gte": r.Min}})
+		first++
+	}
+	if !r.Max.IsZero() {
+		if !singleValueBracket(hi) {
+			conds = append(conds, bson.M{"_id": bson.M{"$lt": r.Max}})
+		}
+		last--
+	}
+	var types bson.A
+	for i := first; i <= last; i++ {
+		for _, t := range bsonTypeBrackets[i] {
+			types = append(types, t)
+		}
+	}
+	if len(types) > 0 {
+		conds = append(conds, bson.M{"_id": bson.M{"$type": types}})
+	}
+
+	switch len(conds) {
+	case 0:
+		// an empty range, e.g. [null, null)
+		return bson.M{"_id": bson.M{"$in": bson.A{}}}
+	case 1:
+		return conds[0].(bson.M)
+	default:
+		return bson.M{"$or": conds}
+	}
+}
+
+// TypedCursor iterates over decoded documents of a cursor
+type TypedCursor[T any] struct {
+	cursor  *mongo.Cursor
+	current T
+	err     error
+}
+
+// Next decodes the next document, it returns false when the cursor is exhausted or fails
+func (c *TypedCursor[T]) Next(ctx context.Context) bool {
+	if c.err != nil || !c.cursor.Next(ctx) {
+		return false
+	}
+	var doc T
+	if c.err = c.cursor.Decode(&doc); c.err != nil {
+		c.err = fmt.Errorf("failed to decode document: %w", c.err)
+		return false
+	}
+	c.current = doc
+	return true
+}
+
+// Current returns the last decoded document
+func (c *TypedCursor[T]) Current() T {
+	return c.current
+}
+
+// Err returns the first error met while iterating
+func (c *TypedCursor[T]) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.cursor.Err()
+}
+
+// ScanFunc processes all documents of a single _id range
+type ScanFunc[T any] func(ctx context.Context, idRange IDRange, docs *TypedCursor[T]) error
+
+// ScanOptions configures ParallelScan
+type ScanOptions struct {
+	// Partitions is the number of _id ranges, 4 by default
+	Partitions int
+	// Workers is the number of ranges scanned concurrently, Partitions by default
+	Workers int
+	// SampleSize picks split points from a $sample of that many documents instead of $bucketAuto,
+	// which is much cheaper on large collections but gives less even ranges
+	SampleSize int
+}
+
+// SplitIDRanges splits documents matching the filter into n roughly equal _id ranges.
+// The first and the last ranges are open, so documents inserted during a scan are not lost,
+// and together the ranges cover _id values of any type.
+func (r *Repository[T]) SplitIDRanges(ctx context.Context, filter any, n int, sampleSize int) ([]IDRange, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid partitions: must be >= 1")
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	if n == 1 {
+		return []IDRange{{}}, nil
+	}
+
+	var points []bson.RawValue
+	var err error
+	if sampleSize > 0 {
+		points, err = r.sampleSplitPoints(ctx, filter, n, sampleSize)
+	} else {
+		points, err = r.bucketSplitPoints(ctx, filter, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := make([]IDRange, 0, len(points)+1)
+	var prev bson.RawValue
+	for _, p := range points {
+		if !prev.IsZero() && prev.Equal(p) {
+			continue
+		}
+		ranges = append(ranges, IDRange{Min: prev, Max: p})
+		prev = p
+	}
+	return append(ranges, IDRange{Min: prev}), nil
+}
+
+// bucketSplitPoints uses $bucketAuto, the lower bound of every bucket but the first is a split point
+func (r *Repository[T]) bucketSplitPoints(ctx context.Context, filter any, n int) ([]bson.RawValue, error) {
+	pipeline := bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$bucketAuto": bson.M{"groupBy": "$_id", "buckets": n}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute aggregate: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var points []bson.RawValue
+	first := true
+	for cursor.Next(ctx) {
+		if first {
+			first = false
+			continue
+		}
+		points = append(points, copyRawValue(cursor.Current.Lookup("_id", "min")))
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to decode aggregate results: %w", err)
+	}
+	return points, nil
+}
+
+// sampleSplitPoints picks evenly spaced _id values from a random sample
+func (r *Repository[T]) sampleSplitPoints(ctx context.Context, filter any, n, sampleSize int) ([]bson.RawValue, error) {
+	pipeline := bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$sample": bson.M{"size": sampleSize}},
+		bson.M{"$project": bson.M{"_id": 1}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute aggregate: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var ids []bson.RawValue
+	for cursor.Next(ctx) {
+		ids = append(ids, copyRawValue(cursor.Current.Lookup("_id")))
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to decode aggregate results: %w", err)
+	}
+	if len(ids) < n {
+		return ids, nil
+	}
+
+	points := make([]bson.RawValue, 0, n-1)
+	for i := 1; i < n; i++ {
+		points = append(points, ids[i*len(ids)/n])
+	}
+	return points, nil
+}
+
+// ParallelScan splits documents matching the filter into _id ranges and scans them concurrently.
+// fn is called once per range with a cursor over its documents. The first error cancels the scan.
+func (r *Repository[T]) ParallelScan(ctx context.Context, filter any, fn ScanFunc[T], opts ...ScanOptions) error {
+	var cfg ScanOptions
+	if len(opts) > 0 {
+		cfg = opts[0]
+	}
+	if cfg.Partitions < 1 {
+		cfg.Partitions = 4
+	}
+	if cfg.Workers < 1 {
+		cfg.Workers = cfg.Partitions
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	ranges, err := r.SplitIDRanges(ctx, filter, cfg.Partitions, cfg.SampleSize)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	queue := make(chan IDRange)
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idRange := range queue {
+				if err := r.scanRange(ctx, filter, idRange, fn); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	for _, idRange := range ranges {
+		select {
+		case queue <- idRange:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func (r *Repository[T]) scanRange(ctx context.Context, filter any, idRange IDRange, fn ScanFunc[T]) error {
+	query := bson.M{"$and": bson.A{filter, idRange.Filter()}}
+	cursor, err := r.collection.Find(ctx, query, options.Find().SetHint(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("failed to execute find: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	docs := &TypedCursor[T]{cursor: cursor}
+	if err = fn(ctx, idRange, docs); err != nil {
+		return err
+	}
+	return docs.Err()
+}
+
+func copyRawValue(v bson.RawValue) bson.RawValue {
+	return bson.RawValue{Type: v.Type, Value: append([]byte(nil), v.Value...)}
+}
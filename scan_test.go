@@ -0,0 +1,199 @@
+package mongoclient
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func rawValue(t *testing.T, v any) bson.RawValue {
+	t.Helper()
+	data, err := bson.Marshal(bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bson.Raw(data).Lookup("v")
+}
+
+// matchesID evaluates an IDRange filter like the server does: range operators only match
+// values of the bound's type bracket
+func matchesID(t *testing.T, filter bson.M, id bson.RawValue) bool {
+	t.Helper()
+	if or, ok := filter["$or"]; ok {
+		for _, cond := range or.(bson.A) {
+			if matchesID(t, cond.(bson.M), id) {
+				return true
+			}
+		}
+		return false
+	}
+	cond, ok := filter["_id"]
+	if !ok {
+		return true
+	}
+	ops, ok := cond.(bson.D)
+	if !ok {
+		for op, arg := range cond.(bson.M) {
+			ops = append(ops, bson.E{Key: op, Value: arg})
+		}
+	}
+	for _, e := range ops {
+		op, arg := e.Key, e.Value
+		switch op {
+		case "$gte", "$lt":
+			bound := arg.(bson.RawValue)
+			if typeBracket(bound.Type) != typeBracket(id.Type) {
+				return false
+			}
+			c := compareBracketValues(t, id, bound)
+			if (op == "$gte" && c < 0) || (op == "$lt" && c >= 0) {
+				return false
+			}
+		case "$type":
+			// filters list whole brackets, so matching the bracket is enough
+			bracket := bsonTypeBrackets[typeBracket(id.Type)]
+			if !slices.ContainsFunc(arg.(bson.A), func(v any) bool { return slices.Contains(bracket, v.(string)) }) {
+				return false
+			}
+		case "$in":
+			return false
+		default:
+			t.Fatalf("unexpected operator %s", op)
+		}
+	}
+	return true
+}
+
+func compareBracketValues(t *testing.T, a, b bson.RawValue) int {
+	t.Helper()
+	switch typeBracket(a.Type) {
+	case 2:
+		return cmpOrdered(numberValue(a), numberValue(b))
+	case 3:
+		return cmpOrdered(a.StringValue(), b.StringValue())
+	case 6:
+		x, y := a.ObjectID(), b.ObjectID()
+		return bytes.Compare(x[:], y[:])
+	case 7:
+		return cmpOrdered(fmt.Sprint(a.Boolean()), fmt.Sprint(b.Boolean()))
+	case 8:
+		return cmpOrdered(a.DateTime(), b.DateTime())
+	}
+	t.Fatalf("unsupported type %s", a.Type)
+	return 0
+}
+
+func numberValue(v bson.RawValue) float64 {
+	switch v.Type {
+	case bson.TypeInt32:
+		return float64(v.Int32())
+	case bson.TypeInt64:
+		return float64(v.Int64())
+	default:
+		return v.Double()
+	}
+}
+
+func cmpOrdered[V int64 | float64 | string](a, b V) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func TestIDRangeFilter(t *testing.T) {
+	oid1 := bson.NewObjectIDFromTimestamp(time.Unix(1000, 0))
+	oid2 := bson.NewObjectIDFromTimestamp(time.Unix(2000, 0))
+
+	tests := []struct {
+		name  string
+		idRng IDRange
+		want  string
+	}{
+		{
+			name: "open",
+			want: `{}`,
+		},
+		{
+			name:  "same type",
+			idRng: IDRange{Min: rawValue(t, oid1), Max: rawValue(t, oid2)},
+			want:  fmt.Sprintf(`{"_id":{"$gte":{"$oid":"%s"},"$lt":{"$oid":"%s"}}}`, oid1.Hex(), oid2.Hex()),
+		},
+		{
+			name:  "open max covers later types",
+			idRng: IDRange{Min: rawValue(t, oid1)},
+			want:  fmt.Sprintf(`{"$or":[{"_id":{"$gte":{"$oid":"%s"}}},{"_id":{"$type":["bool","date","timestamp","maxKey"]}}]}`, oid1.Hex()),
+		},
+		{
+			name:  "open min covers earlier types",
+			idRng: IDRange{Max: rawValue(t, "m")},
+			want:  `{"$or":[{"_id":{"$lt":"m"}},{"_id":{"$type":["minKey","null","int","long","double","decimal"]}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bson.MarshalExtJSON(tt.idRng.Filter(), false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Filter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIDRangeCoverage(t *testing.T) {
+	now := time.Now()
+	ids := []bson.RawValue{
+		rawValue(t, nil),
+		rawValue(t, int32(-5)),
+		rawValue(t, int64(7)),
+		rawValue(t, 2.5),
+		rawValue(t, "a"),
+		rawValue(t, "zz"),
+		rawValue(t, bson.NewObjectID()),
+		rawValue(t, bson.NewObjectID()),
+		rawValue(t, true),
+		rawValue(t, bson.NewDateTimeFromTime(now)),
+	}
+
+	splits := map[string][]bson.RawValue{
+		"numbers":       {rawValue(t, int32(0))},
+		"mixed types":   {rawValue(t, int32(0)), rawValue(t, "m"), ids[7]},
+		"object ids":    {ids[6], ids[7]},
+		"null boundary": {rawValue(t, nil), rawValue(t, "b")},
+	}
+
+	for name, points := range splits {
+		t.Run(name, func(t *testing.T) {
+			var ranges []IDRange
+			var prev bson.RawValue
+			for _, p := range points {
+				ranges = append(ranges, IDRange{Min: prev, Max: p})
+				prev = p
+			}
+			ranges = append(ranges, IDRange{Min: prev})
+
+			for _, id := range ids {
+				var matched int
+				for _, r := range ranges {
+					if matchesID(t, r.Filter(), id) {
+						matched++
+					}
+				}
+				if matched != 1 {
+					t.Errorf("_id %s (%s) matched %d ranges, want 1", id, id.Type, matched)
+				}
+			}
+		})
+	}
+}
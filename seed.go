@@ -0,0 +1,412 @@
+package mongoclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"gopkg.in/yaml.v3"
+)
+
+// SeedFormat is the encoding of a fixtures file
+type SeedFormat string
+
+const (
+	SeedFormatYAML SeedFormat = "yaml"
+	// SeedFormatJSON accepts both plain JSON and Extended JSON
+	SeedFormatJSON SeedFormat = "json"
+)
+
+// seedRefPrefix marks a reference to another fixture in JSON files, e.g. "!ref users.alice".
+// In YAML files the !ref tag is used instead: author: !ref users.alice
+const seedRefPrefix = "!ref "
+
+// seedRef is a reference to another fixture in the form "collection.name"
+type seedRef string
+
+// fixture is a single named document of a collection
+type fixture struct {
+	collection string
+	name       string
+	doc        bson.D
+}
+
+// seedWriter upserts resolved fixtures into a collection by _id
+type seedWriter func(ctx context.Context, docs []bson.D) error
+
+// Seeder loads fixtures from files and inserts them into repositories.
+// Fixture files map collection names to named documents:
+//
+//	users:
+//	  alice: {name: Alice, email: alice@example.com}
+//	posts:
+//	  hello: {title: Hello, author: !ref users.alice}
+type Seeder struct {
+	db       *mongo.Database
+	writers  map[string]seedWriter
+	fixtures []fixture
+	ids      map[string]any
+	truncate bool
+}
+
+// NewSeeder creates a new seeder for the database
+func NewSeeder(db *mongo.Database) *Seeder {
+	return &Seeder{
+		db:      db,
+		writers: make(map[string]seedWriter),
+		ids:     make(map[string]any),
+	}
+}
+
+// RegisterSeedRepository makes the seeder write fixtures of the repository collection
+// through the repository type, so BeforeInsert hooks are called.
+// Fixtures of collections without a registered repository are written as is.
+func RegisterSeedRepository[T any](s *Seeder, repo *Repository[T]) {
+	s.writers[repo.collection.Name()] = func(ctx context.Context, docs []bson.D) error {
+		models := make([]mongo.WriteModel, len(docs))
+		for i, d := range docs {
+			raw, err := bson.Marshal(d)
+			if err != nil {
+				return fmt.Errorf("failed to marshal fixture: %w", err)
+			}
+			var document T
+			if err = bson.Unmarshal(raw, &document); err != nil {
+				return fmt.Errorf("failed to decode fixture into %T: %w", document, err)
+			}
+			if err = repo.beforeInsert(ctx, document); err != nil {
+				return fmt.Errorf("failed to prepare fixture: %w", err)
+			}
+			models[i] = upsertFixture(d, document)
+		}
+		_, err := repo.collection.BulkWrite(ctx, models)
+		return repo.classifyError("BulkWrite", nil, err)
+	}
+}
+
+// SetTruncate makes Seed delete all documents of the seeded collections first
+func (s *Seeder) SetTruncate(truncate bool) *Seeder {
+	s.truncate = truncate
+	return s
+}
+
+// LoadFiles loads fixtures from files, the format is detected by the extension
+func (s *Seeder) LoadFiles(paths ...string) error {
+	for _, path := range paths {
+		var format SeedFormat
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			format = SeedFormatYAML
+		case ".json", ".ejson":
+			format = SeedFormatJSON
+		default:
+			return fmt.Errorf("unsupported fixtures file %s", path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read fixtures: %w", err)
+		}
+		if err = s.Load(bytes.NewReader(data), format); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Load loads fixtures from a reader
+func (s *Seeder) Load(r io.Reader, format SeedFormat) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	var root bson.D
+	switch format {
+	case SeedFormatYAML:
+		var node yaml.Node
+		if err = yaml.Unmarshal(data, &node); err != nil {
+			return fmt.Errorf("failed to parse yaml: %w", err)
+		}
+		if len(node.Content) == 0 {
+			return nil
+		}
+		v, err := yamlNodeToBSON(node.Content[0])
+		if err != nil {
+			return err
+		}
+		d, ok := v.(bson.D)
+		if !ok {
+			return fmt.Errorf("fixtures must be a mapping of collections")
+		}
+		root = d
+	case SeedFormatJSON:
+		if err = bson.UnmarshalExtJSON(data, false, &root); err != nil {
+			return fmt.Errorf("failed to parse json: %w", err)
+		}
+		root = replaceJSONRefs(root).(bson.D)
+	default:
+		return fmt.Errorf("unsupported fixtures format %q", format)
+	}
+
+	for _, col := range root {
+		docs, ok := col.Value.(bson.D)
+		if !ok {
+			return fmt.Errorf("collection %s must be a mapping of named fixtures", col.Key)
+		}
+		for _, named := range docs {
+			doc, ok := named.Value.(bson.D)
+			if !ok {
+				return fmt.Errorf("fixture %s.%s must be a document", col.Key, named.Key)
+			}
+			s.fixtures = append(s.fixtures, fixture{collection: col.Key, name: named.Key, doc: doc})
+		}
+	}
+	return nil
+}
+
+// ID returns the _id of a seeded fixture, e.g. ID("users.alice")
+func (s *Seeder) ID(ref string) (any, bool) {
+	id, ok := s.ids[ref]
+	return id, ok
+}
+
+// Seed resolves references and writes all loaded fixtures in dependency order.
+// Fixtures are upserted by _id, so Seed can run again, e.g. after loading more fixtures:
+// fixtures seeded before keep their ids and their documents are replaced.
+func (s *Seeder) Seed(ctx context.Context) error {
+	// Assign ids up front so references can be resolved regardless of order.
+	// A generated id is added to the fixture, so later runs keep it.
+	seen := make(map[string]bool, len(s.fixtures))
+	for i, f := range s.fixtures {
+		ref := f.collection + "." + f.name
+		if seen[ref] {
+			return fmt.Errorf("duplicate fixture %s", ref)
+		}
+		seen[ref] = true
+		id, ok := lookupField(f.doc, "_id")
+		if !ok {
+			id = bson.NewObjectID()
+			s.fixtures[i].doc = append(bson.D{{Key: "_id", Value: id}}, f.doc...)
+		}
+		s.ids[ref] = id
+	}
+
+	order, err := s.collectionOrder()
+	if err != nil {
+		return err
+	}
+
+	if s.truncate {
+		for i := len(order) - 1; i >= 0; i-- {
+			if _, err = s.db.Collection(order[i]).DeleteMany(ctx, bson.M{}); err != nil {
+				return fmt.Errorf("failed to truncate %s: %w", order[i], err)
+			}
+		}
+	}
+
+	for _, col := range order {
+		var docs []bson.D
+		for _, f := range s.fixtures {
+			if f.collection != col {
+				continue
+			}
+			resolved, err := s.resolveRefs(f.doc)
+			if err != nil {
+				return fmt.Errorf("fixture %s.%s: %w", f.collection, f.name, err)
+			}
+			docs = append(docs, resolved.(bson.D))
+		}
+
+		write, ok := s.writers[col]
+		if !ok {
+			write = s.writeRaw(col)
+		}
+		if err = write(ctx, docs); err != nil {
+			return fmt.Errorf("failed to seed %s: %w", col, err)
+		}
+	}
+	return nil
+}
+
+func (s *Seeder) writeRaw(collection string) seedWriter {
+	return func(ctx context.Context, docs []bson.D) error {
+		models := make([]mongo.WriteModel, len(docs))
+		for i, d := range docs {
+			models[i] = upsertFixture(d, d)
+		}
+		_, err := s.db.Collection(collection).BulkWrite(ctx, models)
+		return err
+	}
+}
+
+// upsertFixture returns the write replacing the document with the _id of the fixture, or inserting it
+func upsertFixture(fixture bson.D, document any) mongo.WriteModel {
+	id, _ := lookupField(fixture, "_id")
+	return mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": id}).SetReplacement(document).SetUpsert(true)
+}
+
+// collectionOrder sorts collections so referenced collections are seeded first
+func (s *Seeder) collectionOrder() ([]string, error) {
+	var collections []string
+	deps := make(map[string]map[string]bool)
+	for _, f := range s.fixtures {
+		if _, ok := deps[f.collection]; !ok {
+			collections = append(collections, f.collection)
+			deps[f.collection] = make(map[string]bool)
+		}
+		walkRefs(f.doc, func(ref seedRef) {
+			if col, _, _ := strings.Cut(string(ref), "."); col != f.collection {
+				deps[f.collection][col] = true
+			}
+		})
+	}
+
+	var order []string
+	done := make(map[string]bool)
+	for len(order) < len(collections) {
+		progressed := false
+		for _, col := range collections {
+			if done[col] {
+				continue
+			}
+			ready := true
+			for dep := range deps[col] {
+				if _, known := deps[dep]; known && !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				order = append(order, col)
+				done[col] = true
+				progressed = true
+			}
+		}
+		if !progressed {
+			return nil, fmt.Errorf("circular references between fixture collections")
+		}
+	}
+	return order, nil
+}
+
+func (s *Seeder) resolveRefs(v any) (any, error) {
+	switch val := v.(type) {
+	case seedRef:
+		id, ok := s.ids[string(val)]
+		if !ok {
+			return nil, fmt.Errorf("unknown reference %s", val)
+		}
+		return id, nil
+	case bson.D:
+		out := make(bson.D, len(val))
+		for i, e := range val {
+			resolved, err := s.resolveRefs(e.Value)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = bson.E{Key: e.Key, Value: resolved}
+		}
+		return out, nil
+	case bson.A:
+		out := make(bson.A, len(val))
+		for i, e := range val {
+			resolved, err := s.resolveRefs(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+func walkRefs(v any, fn func(seedRef)) {
+	switch val := v.(type) {
+	case seedRef:
+		fn(val)
+	case bson.D:
+		for _, e := range val {
+			walkRefs(e.Value, fn)
+		}
+	case bson.A:
+		for _, e := range val {
+			walkRefs(e, fn)
+		}
+	}
+}
+
+func replaceJSONRefs(v any) any {
+	switch val := v.(type) {
+	case string:
+		if strings.HasPrefix(val, seedRefPrefix) {
+			return seedRef(strings.TrimSpace(strings.TrimPrefix(val, seedRefPrefix)))
+		}
+	case bson.D:
+		for i := range val {
+			val[i].Value = replaceJSONRefs(val[i].Value)
+		}
+	case bson.A:
+		for i := range val {
+			val[i] = replaceJSONRefs(val[i])
+		}
+	}
+	return v
+}
+
+func yamlNodeToBSON(node *yaml.Node) (any, error) {
+	if node.Tag == "!ref" {
+		return seedRef(node.Value), nil
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlNodeToBSON(node.Content[0])
+	case yaml.AliasNode:
+		return yamlNodeToBSON(node.Alias)
+	case yaml.MappingNode:
+		d := make(bson.D, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v, err := yamlNodeToBSON(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			d = append(d, bson.E{Key: node.Content[i].Value, Value: v})
+		}
+		return d, nil
+	case yaml.SequenceNode:
+		a := make(bson.A, 0, len(node.Content))
+		for _, child := range node.Content {
+			v, err := yamlNodeToBSON(child)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	default:
+		var v any
+		if err := node.Decode(&v); err != nil {
+			return nil, fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		return v, nil
+	}
+}
+
+func lookupField(d bson.D, key string) (any, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,208 @@
+package mongoclient
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestSeederLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  SeedFormat
+		data    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "yaml",
+			format: SeedFormatYAML,
+			data: `
+users:
+  alice: {name: Alice}
+  bob: {name: Bob}
+posts:
+  hello: {title: Hello, author: !ref users.alice}
+`,
+			want: []string{"users.alice", "users.bob", "posts.hello"},
+		},
+		{
+			name:   "json",
+			format: SeedFormatJSON,
+			data:   `{"users": {"alice": {"name": "Alice", "age": {"$numberInt": "30"}}}, "posts": {"hello": {"author": "!ref users.alice"}}}`,
+			want:   []string{"users.alice", "posts.hello"},
+		},
+		{
+			name:   "empty yaml",
+			format: SeedFormatYAML,
+			data:   "",
+		},
+		{
+			name:    "yaml root is not a mapping",
+			format:  SeedFormatYAML,
+			data:    "- a\n- b\n",
+			wantErr: "mapping of collections",
+		},
+		{
+			name:    "fixture is not a document",
+			format:  SeedFormatYAML,
+			data:    "users:\n  alice: 42\n",
+			wantErr: "fixture users.alice must be a document",
+		},
+		{
+			name:    "collection is not a mapping",
+			format:  SeedFormatJSON,
+			data:    `{"users": [1, 2]}`,
+			wantErr: "collection users must be a mapping",
+		},
+		{
+			name:    "unsupported format",
+			format:  "toml",
+			data:    "a = 1",
+			wantErr: "unsupported fixtures format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSeeder(nil)
+			err := s.Load(strings.NewReader(tt.data), tt.format)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			var got []string
+			for _, f := range s.fixtures {
+				got = append(got, f.collection+"."+f.name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Load() fixtures = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeederRefs(t *testing.T) {
+	for _, format := range []SeedFormat{SeedFormatYAML, SeedFormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			data := "posts:\n  hello: {author: !ref users.alice, tags: [!ref tags.go]}\nusers:\n  alice: {name: Alice}\ntags:\n  go: {name: go}\n"
+			if format == SeedFormatJSON {
+				data = `{"posts": {"hello": {"author": "!ref users.alice", "tags": ["!ref tags.go"]}}, "users": {"alice": {"name": "Alice"}}, "tags": {"go": {"name": "go"}}}`
+			}
+
+			s := NewSeeder(nil)
+			if err := s.Load(strings.NewReader(data), format); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			order, err := s.collectionOrder()
+			if err != nil {
+				t.Fatalf("collectionOrder() error = %v", err)
+			}
+			if want := []string{"users", "tags", "posts"}; !slices.Equal(order, want) {
+				t.Errorf("collectionOrder() = %v, want %v", order, want)
+			}
+
+			aliceID, goID := bson.NewObjectID(), bson.NewObjectID()
+			s.ids["users.alice"], s.ids["tags.go"] = aliceID, goID
+			resolved, err := s.resolveRefs(s.fixtures[0].doc)
+			if err != nil {
+				t.Fatalf("resolveRefs() error = %v", err)
+			}
+			doc := resolved.(bson.D)
+			if author, _ := lookupField(doc, "author"); author != aliceID {
+				t.Errorf("author = %v, want %v", author, aliceID)
+			}
+			if tags, _ := lookupField(doc, "tags"); len(tags.(bson.A)) != 1 || tags.(bson.A)[0] != goID {
+				t.Errorf("tags = %v, want [%v]", tags, goID)
+			}
+		})
+	}
+}
+
+func TestSeederRefErrors(t *testing.T) {
+	s := NewSeeder(nil)
+	if err := s.Load(strings.NewReader("posts:\n  hello: {author: !ref users.nobody}\n"), SeedFormatYAML); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, err := s.resolveRefs(s.fixtures[0].doc); err == nil || !strings.Contains(err.Error(), "unknown reference users.nobody") {
+		t.Errorf("resolveRefs() error = %v, want unknown reference", err)
+	}
+
+	s = NewSeeder(nil)
+	data := "a:\n  x: {b: !ref b.y}\nb:\n  y: {a: !ref a.x}\n"
+	if err := s.Load(strings.NewReader(data), SeedFormatYAML); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, err := s.collectionOrder(); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Errorf("collectionOrder() error = %v, want circular references", err)
+	}
+}
+
+func TestSeederSeedAgain(t *testing.T) {
+	s := NewSeeder(nil)
+	data := "users:\n  alice: {name: Alice}\n  bob: {_id: 7, name: Bob}\nposts:\n  hello: {author: !ref users.alice}\n"
+	if err := s.Load(strings.NewReader(data), SeedFormatYAML); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	written := make(map[string][]bson.D)
+	for _, col := range []string{"users", "posts"} {
+		s.writers[col] = func(ctx context.Context, docs []bson.D) error {
+			written[col] = append(written[col], docs...)
+			return nil
+		}
+	}
+
+	if err := s.Seed(context.Background()); err != nil {
+		t.Fatalf("first Seed() error = %v", err)
+	}
+	aliceID, _ := s.ID("users.alice")
+	if err := s.Seed(context.Background()); err != nil {
+		t.Fatalf("second Seed() error = %v", err)
+	}
+	if id, _ := s.ID("users.alice"); id != aliceID {
+		t.Errorf("ID(users.alice) = %v after seeding again, want %v", id, aliceID)
+	}
+
+	var ids []any
+	for _, doc := range written["users"] {
+		id, _ := lookupField(doc, "_id")
+		ids = append(ids, id)
+	}
+	if want := []any{aliceID, 7, aliceID, 7}; !slices.Equal(ids, want) {
+		t.Errorf("written user ids = %v, want %v", ids, want)
+	}
+	for _, doc := range written["posts"] {
+		if author, _ := lookupField(doc, "author"); author != aliceID {
+			t.Errorf("post author = %v, want %v", author, aliceID)
+		}
+	}
+
+	if err := s.Load(strings.NewReader("users:\n  alice: {name: Alice}\n"), SeedFormatYAML); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := s.Seed(context.Background()); err == nil || !strings.Contains(err.Error(), "duplicate fixture users.alice") {
+		t.Errorf("Seed() error = %v, want duplicate fixture", err)
+	}
+}
+
+func TestUpsertFixture(t *testing.T) {
+	fixture := bson.D{{Key: "_id", Value: "alice"}, {Key: "name", Value: "Alice"}}
+	model, ok := upsertFixture(fixture, fixture).(*mongo.ReplaceOneModel)
+	if !ok {
+		t.Fatalf("upsertFixture() = %T, want *mongo.ReplaceOneModel", model)
+	}
+	if filter, _ := model.Filter.(bson.M); filter["_id"] != "alice" || model.Upsert == nil || !*model.Upsert {
+		t.Errorf("upsertFixture() = filter %v, upsert %v, want an upsert by _id", model.Filter, model.Upsert)
+	}
+}
@@ -0,0 +1,179 @@
+package mongoclient
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const DefaultCountersCollection = "counters"
+
+// Sequenced is implemented by models that get a sequential number on insert.
+// Repositories with sequences set via UseSequences assign it right after BeforeInsert.
+type Sequenced interface {
+	// SequenceName returns the counter name, it may contain date placeholders, see FormatSequence
+	SequenceName() string
+	// SequencePattern returns the pattern of the formatted number, e.g. "INV-{YYYY}-{SEQ:6}"
+	SequencePattern() string
+	// SetSequence stores the number on the model, it's not called if HasSequence returns true
+	SetSequence(number int64, formatted string)
+	HasSequence() bool
+}
+
+// SequenceOptions configures Sequences
+type SequenceOptions struct {
+	// BlockSize is the number of values reserved per round trip and handed out locally, 1 by default.
+	// Values of a reserved block that are not used before the process exits are skipped.
+	BlockSize int64
+}
+
+// sequenceBlock is a range of reserved values, next is handed out next and last is the last one.
+// Its mutex is held while a new range is reserved, so sequences don't wait for each other.
+type sequenceBlock struct {
+	mu   sync.Mutex
+	next int64
+	last int64
+}
+
+// Sequences generates gap-tolerant sequential numbers backed by the counters collection
+type Sequences struct {
+	collection *mongo.Collection
+	blockSize  int64
+
+	mu     sync.Mutex // guards blocks
+	blocks map[string]*sequenceBlock
+}
+
+// NewSequences creates a sequence generator in the database
+func NewSequences(db *mongo.Database, opts SequenceOptions) *Sequences {
+	if opts.BlockSize < 1 {
+		opts.BlockSize = 1
+	}
+	return &Sequences{
+		collection: db.Collection(DefaultCountersCollection),
+		blockSize:  opts.BlockSize,
+		blocks:     make(map[string]*sequenceBlock),
+	}
+}
+
+// Next returns the next value of the named sequence, starting from 1.
+// Only calls for the same name wait for each other's round trips.
+func (s *Sequences) Next(ctx context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	block, ok := s.blocks[name]
+	if !ok {
+		block = &sequenceBlock{next: 1}
+		s.blocks[name] = block
+	}
+	s.mu.Unlock()
+
+	block.mu.Lock()
+	defer block.mu.Unlock()
+
+	if block.next > block.last {
+		var counter struct {
+			Value int64 `bson:"value"`
+		}
+		err := s.collection.FindOneAndUpdate(ctx,
+			bson.M{"_id": name},
+			bson.M{"$inc": bson.M{"value": s.blockSize}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&counter)
+		if err != nil {
+			return 0, fmt.Errorf("failed to reserve sequence %s: %w", name, err)
+		}
+		block.next, block.last = counter.Value-s.blockSize+1, counter.Value
+	}
+
+	value := block.next
+	block.next++
+	return value, nil
+}
+
+// NextFormatted returns the next value of the sequence formatted with the pattern.
+// Date placeholders in the name are expanded too, so "invoices-{YYYY}" restarts every year.
+func (s *Sequences) NextFormatted(ctx context.Context, name, pattern string) (string, int64, error) {
+	now := time.Now()
+	value, err := s.Next(ctx, FormatSequence(name, 0, now))
+	if err != nil {
+		return "", 0, err
+	}
+	return FormatSequence(pattern, value, now), value, nil
+}
+
+// FormatSequence expands the pattern placeholders: {YYYY}, {YY}, {MM} and {DD} with the date,
+// {SEQ} with the value and {SEQ:n} with the value zero-padded to n digits.
+// For example "INV-{YYYY}-{SEQ:6}" gives "INV-2026-000123".
+func FormatSequence(pattern string, value int64, t time.Time) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(pattern[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		b.WriteString(pattern[:start])
+		placeholder := pattern[start+1 : end]
+		switch {
+		case placeholder == "YYYY":
+			b.WriteString(t.Format("2006"))
+		case placeholder == "YY":
+			b.WriteString(t.Format("06"))
+		case placeholder == "MM":
+			b.WriteString(t.Format("01"))
+		case placeholder == "DD":
+			b.WriteString(t.Format("02"))
+		case placeholder == "SEQ":
+			b.WriteString(strconv.FormatInt(value, 10))
+		case strings.HasPrefix(placeholder, "SEQ:"):
+			width, err := strconv.Atoi(placeholder[len("SEQ:"):])
+			if err != nil || width < 0 {
+				b.WriteString(pattern[start : end+1])
+				break
+			}
+			fmt.Fprintf(&b, "%0*d", width, value)
+		default:
+			b.WriteString(pattern[start : end+1])
+		}
+		pattern = pattern[end+1:]
+	}
+	b.WriteString(pattern)
+	return b.String()
+}
+
+// UseSequences makes the repository assign numbers to Sequenced models on insert
+func (r *Repository[T]) UseSequences(sequences *Sequences) *Repository[T] {
+	r.sequences = sequences
+	return r
+}
+
+// beforeInsert calls the BeforeInsert hook and assigns the sequence number of Sequenced models
+func (r *Repository[T]) beforeInsert(ctx context.Context, document T) error {
+	if hook, ok := any(document).(Document); ok {
+		hook.BeforeInsert()
+	}
+	if r.sequences == nil {
+		return nil
+	}
+	seq, ok := any(document).(Sequenced)
+	if !ok || seq.HasSequence() {
+		return nil
+	}
+	formatted, value, err := r.sequences.NextFormatted(ctx, seq.SequenceName(), seq.SequencePattern())
+	if err != nil {
+		return err
+	}
+	seq.SetSequence(value, formatted)
+	return nil
+}
@@ -0,0 +1,98 @@
+package mongoclient
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestFormatSequence(t *testing.T) {
+	date := time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		pattern string
+		value   int64
+		want    string
+	}{
+		{"", 5, ""},
+		{"plain", 5, "plain"},
+		{"{SEQ}", 42, "42"},
+		{"INV-{YYYY}-{SEQ:6}", 123, "INV-2026-000123"},
+		{"{YY}{MM}{DD}-{SEQ:3}", 7, "260307-007"},
+		{"{SEQ:2}", 12345, "12345"},
+		{"{SEQ:0}", 9, "9"},
+		{"invoices-{YYYY}", 0, "invoices-2026"},
+		{"{SEQ:x}", 1, "{SEQ:x}"},
+		{"{SEQ:-3}", 1, "{SEQ:-3}"},
+		{"{UNKNOWN}-{SEQ}", 1, "{UNKNOWN}-1"},
+		{"open {SEQ", 1, "open {SEQ"},
+		{"}{SEQ}{", 3, "}3{"},
+		{"{{SEQ}}", 3, "{{SEQ}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := FormatSequence(tt.pattern, tt.value, date); got != tt.want {
+				t.Errorf("FormatSequence(%q, %d) = %q, want %q", tt.pattern, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSequencesNextFromReservedBlock(t *testing.T) {
+	s := NewSequences(testDatabase(t), SequenceOptions{BlockSize: 3})
+	s.blocks["a"] = &sequenceBlock{next: 4, last: 6}
+
+	var got []int64
+	for range 3 {
+		value, err := s.Next(context.Background(), "a")
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		got = append(got, value)
+	}
+	if !slices.Equal(got, []int64{4, 5, 6}) {
+		t.Errorf("Next() values = %v, want [4 5 6]", got)
+	}
+	// The block is used up and the database is unreachable.
+	if _, err := s.Next(context.Background(), "a"); err == nil {
+		t.Error("Next() error = nil, want the failed reservation")
+	}
+	if _, err := s.Next(context.Background(), "new"); err == nil {
+		t.Error("Next() of a new sequence error = nil, want the failed reservation")
+	}
+}
+
+func TestSequencesNextDoesNotWaitForOtherNames(t *testing.T) {
+	client, err := mongo.Connect(options.Client().ApplyURI("mongodb://localhost:1").SetServerSelectionTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+	s := NewSequences(client.Database("test"), SequenceOptions{})
+	s.blocks["b"] = &sequenceBlock{next: 5, last: 10}
+
+	reserving := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		close(reserving)
+		_, _ = s.Next(context.Background(), "a") // waits for the server selection timeout
+	}()
+	<-reserving
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	value, err := s.Next(context.Background(), "b")
+	if err != nil || value != 5 {
+		t.Fatalf("Next() = %d, %v, want 5", value, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Next() of another sequence took %v, want it not to wait for the reservation", elapsed)
+	}
+	<-done
+}
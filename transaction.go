@@ -2,24 +2,194 @@ package mongoclient
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
 )
 
-// TODO: need to test.
+const (
+	labelTransientTransaction = "TransientTransactionError"
+	labelUnknownCommitResult  = "UnknownTransactionCommitResult"
+)
 
-// Transaction executes operations within a transaction
-func (r *Repository[T]) Transaction(ctx context.Context, fn func(sessCtx context.Context) error, opts ...options.Lister[options.SessionOptions]) error {
-	session, err := r.collection.Database().Client().StartSession(opts...)
-	if err != nil {
-		return fmt.Errorf("failed to start session: %w", err)
+// TransactionOptions configures WithTransaction
+type TransactionOptions struct {
+	ReadConcern    *readconcern.ReadConcern
+	WriteConcern   *writeconcern.WriteConcern
+	ReadPreference *readpref.ReadPref
+	// MaxCommitTime is a client-side deadline of each commit attempt, unbounded by default.
+	// A commit that exceeds it is not retried and its outcome is unknown.
+	MaxCommitTime time.Duration
+	// RetryTimeout is how long transient errors are retried, 120s by default like the driver
+	RetryTimeout time.Duration
+	// MaxAttempts limits the number of times the function runs, unlimited within RetryTimeout by default
+	MaxAttempts int
+	// SessionOptions are used when a new session is started, they are ignored when the context
+	// already carries a session
+	SessionOptions []options.Lister[options.SessionOptions]
+}
+
+// TransactionSession returns the session of the transaction running in the context, nil outside transactions
+func TransactionSession(ctx context.Context) *mongo.Session {
+	session := mongo.SessionFromContext(ctx)
+	if session == nil || !session.ClientSession().TransactionRunning() {
+		return nil
+	}
+	return session
+}
+
+// commitHooksKey is the context key of the commit hooks of a transaction started by WithTransaction
+type commitHooksKey struct{}
+
+// commitHooks are functions run once the transaction has committed
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+func (h *commitHooks) run() {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns = nil
+	h.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// afterCommit registers fn to run after the transaction of the context commits. It reports false
+// if the context has no transaction started by WithTransaction, fn is not registered then.
+func afterCommit(ctx context.Context, fn func()) bool {
+	hooks, ok := ctx.Value(commitHooksKey{}).(*commitHooks)
+	if !ok || TransactionSession(ctx) == nil {
+		return false
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	hooks.fns = append(hooks.fns, fn)
+	return true
+}
+
+// WithTransaction runs fn in a transaction and returns its result, or the zero value on errors.
+// Transactions failing with transient errors are retried within the retry budget, so fn may run
+// several times. If the context already carries a running transaction, fn joins it and the outer
+// call commits; a session of the context without a transaction is used for the transaction.
+func WithTransaction[R any](ctx context.Context, client *mongo.Client, fn func(ctx context.Context) (R, error), opts ...TransactionOptions) (R, error) {
+	var zero R
+	if TransactionSession(ctx) != nil {
+		return fn(ctx)
+	}
+
+	cfg := TransactionOptions{}
+	if len(opts) > 0 {
+		cfg = opts[0]
+	}
+	if cfg.RetryTimeout <= 0 {
+		cfg.RetryTimeout = 120 * time.Second
 	}
-	defer session.EndSession(ctx)
+	txnOpts := options.Transaction()
+	if cfg.ReadConcern != nil {
+		txnOpts.SetReadConcern(cfg.ReadConcern)
+	}
+	if cfg.WriteConcern != nil {
+		txnOpts.SetWriteConcern(cfg.WriteConcern)
+	}
+	if cfg.ReadPreference != nil {
+		txnOpts.SetReadPreference(cfg.ReadPreference)
+	}
+
+	session := mongo.SessionFromContext(ctx)
+	if session == nil {
+		var err error
+		session, err = client.StartSession(cfg.SessionOptions...)
+		if err != nil {
+			return zero, fmt.Errorf("failed to start session: %w", err)
+		}
+		defer session.EndSession(context.WithoutCancel(ctx))
+	}
+
+	deadline := time.Now().Add(cfg.RetryTimeout)
+	canRetry := func(attempt int) bool {
+		return ctx.Err() == nil && time.Now().Before(deadline) && (cfg.MaxAttempts <= 0 || attempt < cfg.MaxAttempts)
+	}
+
+Attempts:
+	for attempt := 1; ; attempt++ {
+		if err := session.StartTransaction(txnOpts); err != nil {
+			return zero, fmt.Errorf("failed to start transaction: %w", err)
+		}
+
+		// hooks of an attempt that failed are dropped with it
+		hooks := &commitHooks{}
+		result, err := fn(context.WithValue(mongo.NewSessionContext(ctx, session), commitHooksKey{}, hooks))
+		if err != nil {
+			if session.ClientSession().TransactionRunning() {
+				_ = session.AbortTransaction(context.WithoutCancel(ctx))
+			}
+			if hasErrorLabel(err, labelTransientTransaction) && canRetry(attempt) {
+				continue
+			}
+			return zero, err
+		}
+
+		// fn aborted the transaction itself
+		if !session.ClientSession().TransactionRunning() {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			_ = session.AbortTransaction(context.WithoutCancel(ctx))
+			return zero, ctx.Err()
+		}
 
-	_, err = session.WithTransaction(ctx, func(sessCtx context.Context) (any, error) {
-		return nil, fn(sessCtx)
-	})
+		for {
+			err = commitTransaction(ctx, session, cfg.MaxCommitTime)
+			if err == nil {
+				hooks.run()
+				return result, nil
+			}
 
-	return err
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				// MaxCommitTime elapsed, retrying would exceed it
+			case hasErrorLabel(err, labelUnknownCommitResult) && canRetry(attempt):
+				continue
+			case hasErrorLabel(err, labelTransientTransaction) && canRetry(attempt):
+				continue Attempts
+			}
+			return zero, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+	}
+}
+
+// commitTransaction commits ignoring the cancellation of the context, like the driver does,
+// so server resources are released
+func commitTransaction(ctx context.Context, session *mongo.Session, maxCommitTime time.Duration) error {
+	commitCtx := context.WithoutCancel(ctx)
+	if maxCommitTime > 0 {
+		var cancel context.CancelFunc
+		commitCtx, cancel = context.WithTimeout(commitCtx, maxCommitTime)
+		defer cancel()
+	}
+	return session.CommitTransaction(commitCtx)
+}
+
+// hasErrorLabel reports whether the error carries the server error label
+func hasErrorLabel(err error, label string) bool {
+	var le mongo.LabeledError
+	return errors.As(err, &le) && le.HasErrorLabel(label)
+}
+
+// Transaction executes operations within a transaction, joining the transaction of the context if any
+func (r *Repository[T]) Transaction(ctx context.Context, fn func(sessCtx context.Context) error, opts ...options.Lister[options.SessionOptions]) error {
+	_, err := WithTransaction(ctx, r.collection.Database().Client(), func(sessCtx context.Context) (struct{}, error) {
+		return struct{}{}, fn(sessCtx)
+	}, TransactionOptions{SessionOptions: opts})
+	return r.classifyError("Transaction", nil, err)
 }
@@ -0,0 +1,93 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestHasErrorLabel(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		label string
+		want  bool
+	}{
+		{name: "nil", err: nil, label: labelTransientTransaction, want: false},
+		{name: "plain error", err: errors.New("boom"), label: labelTransientTransaction, want: false},
+		{
+			name:  "transient transaction",
+			err:   mongo.CommandError{Code: 112, Labels: []string{labelTransientTransaction}},
+			label: labelTransientTransaction,
+			want:  true,
+		},
+		{
+			name:  "other label",
+			err:   mongo.CommandError{Code: 112, Labels: []string{labelTransientTransaction}},
+			label: labelUnknownCommitResult,
+			want:  false,
+		},
+		{
+			name:  "unknown commit result on a write exception",
+			err:   mongo.WriteException{Labels: []string{labelUnknownCommitResult}},
+			label: labelUnknownCommitResult,
+			want:  true,
+		},
+		{
+			name:  "wrapped",
+			err:   fmt.Errorf("failed to insert: %w", mongo.CommandError{Labels: []string{labelTransientTransaction}}),
+			label: labelTransientTransaction,
+			want:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasErrorLabel(tt.err, tt.label); got != tt.want {
+				t.Errorf("hasErrorLabel(%v, %s) = %v, want %v", tt.err, tt.label, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAfterCommit(t *testing.T) {
+	session, err := testDatabase(t).Client().StartSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.EndSession(context.Background())
+	if err = session.StartTransaction(); err != nil {
+		t.Fatal(err)
+	}
+	txnCtx := mongo.NewSessionContext(context.Background(), session)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want bool
+		runs int
+	}{
+		{name: "no transaction", ctx: context.WithValue(context.Background(), commitHooksKey{}, &commitHooks{})},
+		{name: "transaction without hooks", ctx: txnCtx},
+		{name: "transaction of WithTransaction", ctx: context.WithValue(txnCtx, commitHooksKey{}, &commitHooks{}), want: true, runs: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran int
+			if got := afterCommit(tt.ctx, func() { ran++ }); got != tt.want {
+				t.Fatalf("afterCommit() = %v, want %v", got, tt.want)
+			}
+			if hooks, ok := tt.ctx.Value(commitHooksKey{}).(*commitHooks); ok {
+				hooks.run()
+				hooks.run()
+			}
+			if ran != tt.runs {
+				t.Errorf("hook ran %d times, want %d", ran, tt.runs)
+			}
+		})
+	}
+}
@@ -0,0 +1,548 @@
+package mongoclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// DataFormat is the encoding used by Export and Import
+type DataFormat string
+
+const (
+	// FormatJSONL is one relaxed Extended JSON document per line
+	FormatJSONL DataFormat = "jsonl"
+	// FormatCanonicalJSONL is one canonical Extended JSON document per line, all BSON types are kept
+	FormatCanonicalJSONL DataFormat = "canonical"
+	// FormatCSV is a CSV file with a header row, columns are mapped from struct tags
+	FormatCSV DataFormat = "csv"
+)
+
+// ImportMode controls how imported documents are written
+type ImportMode string
+
+const (
+	// ImportInsert inserts every document
+	ImportInsert ImportMode = "insert"
+	// ImportUpsert updates the document matched by the key fields or inserts a new one
+	ImportUpsert ImportMode = "upsert"
+	// ImportReplace replaces the document matched by the key fields or inserts a new one
+	ImportReplace ImportMode = "replace"
+)
+
+const DefaultTransferBatchSize = 500
+
+// TransferOptions configures Export and Import
+type TransferOptions struct {
+	// Columns overrides the CSV columns derived from struct tags, values are bson field names
+	Columns []string
+	// KeyFields are the fields used to match documents in upsert and replace modes, "_id" by default
+	KeyFields []string
+	// BatchSize is the number of documents written per bulk write
+	BatchSize int
+	// StopOnError aborts the import on the first invalid line instead of skipping it
+	StopOnError bool
+	// Progress is called after every batch with the number of processed documents
+	Progress func(processed int64)
+}
+
+// LineError is an error for a single line of imported data
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e LineError) Unwrap() error {
+	return e.Err
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Processed int64
+	Inserted  int64
+	Upserted  int64
+	Modified  int64
+	Failed    int64
+	Errors    []LineError
+}
+
+// Export streams documents matching the filter to w
+func (r *Repository[T]) Export(ctx context.Context, w io.Writer, filter any, format DataFormat, opts ...TransferOptions) (int64, error) {
+	cfg := transferConfig(opts)
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	var columns []csvColumn
+	if format == FormatCSV {
+		var err error
+		if columns, err = r.csvColumns(cfg.Columns); err != nil {
+			return 0, err
+		}
+		if len(columns) == 0 {
+			return 0, fmt.Errorf("no csv columns for %T", *new(T))
+		}
+	} else if format != FormatJSONL && format != FormatCanonicalJSONL {
+		return 0, fmt.Errorf("unsupported format %q", format)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute find: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	bw := bufio.NewWriter(w)
+	var csvw *csv.Writer
+	if format == FormatCSV {
+		csvw = csv.NewWriter(bw)
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = c.header
+		}
+		if err = csvw.Write(header); err != nil {
+			return 0, fmt.Errorf("failed to write csv header: %w", err)
+		}
+	}
+
+	var count int64
+	for cursor.Next(ctx) {
+		if csvw != nil {
+			if err = csvw.Write(csvRecord(cursor.Current, columns)); err != nil {
+				return count, fmt.Errorf("failed to write document %d: %w", count+1, err)
+			}
+		} else {
+			line, err := bson.MarshalExtJSON(cursor.Current, format == FormatCanonicalJSONL, false)
+			if err != nil {
+				return count, fmt.Errorf("failed to encode document %d: %w", count+1, err)
+			}
+			if _, err = bw.Write(append(line, '\n')); err != nil {
+				return count, fmt.Errorf("failed to write document %d: %w", count+1, err)
+			}
+		}
+		count++
+		if cfg.Progress != nil && count%int64(cfg.BatchSize) == 0 {
+			cfg.Progress(count)
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return count, fmt.Errorf("failed to read documents: %w", err)
+	}
+
+	if csvw != nil {
+		csvw.Flush()
+		if err = csvw.Error(); err != nil {
+			return count, fmt.Errorf("failed to write csv: %w", err)
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		return count, fmt.Errorf("failed to flush output: %w", err)
+	}
+	if cfg.Progress != nil {
+		cfg.Progress(count)
+	}
+	return count, nil
+}
+
+// Import streams documents from rd into the collection. Documents are written as read, with
+// their field order, unknown fields and timestamps: hooks and sequences are not applied.
+// Lines that don't decode into T are reported in the result and skipped, unless StopOnError is set.
+func (r *Repository[T]) Import(ctx context.Context, rd io.Reader, format DataFormat, mode ImportMode, opts ...TransferOptions) (*ImportResult, error) {
+	cfg := transferConfig(opts)
+	if len(cfg.KeyFields) == 0 {
+		cfg.KeyFields = []string{"_id"}
+	}
+	if mode != ImportInsert && mode != ImportUpsert && mode != ImportReplace {
+		return nil, fmt.Errorf("unsupported import mode %q", mode)
+	}
+
+	next, err := r.importReader(rd, format, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	var (
+		models []mongo.WriteModel
+		lines  []int
+	)
+
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		res, err := r.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if res != nil {
+			result.Inserted += res.InsertedCount
+			result.Upserted += res.UpsertedCount
+			result.Modified += res.ModifiedCount
+		}
+		var bwe mongo.BulkWriteException
+		switch {
+		case errors.As(err, &bwe) && bwe.WriteConcernError == nil:
+			for _, we := range bwe.WriteErrors {
+				result.Failed++
+				result.Errors = append(result.Errors, LineError{Line: lines[we.Index], Err: we.WriteError})
+			}
+		case err != nil:
+			return fmt.Errorf("failed to write documents: %w", err)
+		}
+		models, lines = models[:0], lines[:0]
+		if cfg.Progress != nil {
+			cfg.Progress(result.Processed)
+		}
+		return nil
+	}
+
+	for {
+		line, doc, err := next()
+		if err == io.EOF {
+			break
+		}
+		var lineErr LineError
+		if err != nil && !errors.As(err, &lineErr) {
+			return result, err
+		}
+		if err == nil {
+			var model mongo.WriteModel
+			if model, err = importModel(doc, mode, cfg.KeyFields); err != nil {
+				lineErr = LineError{Line: line, Err: err}
+			} else {
+				models = append(models, model)
+				lines = append(lines, line)
+			}
+		}
+		result.Processed++
+		if err != nil {
+			if cfg.StopOnError {
+				return result, lineErr
+			}
+			result.Failed++
+			result.Errors = append(result.Errors, lineErr)
+			continue
+		}
+		if len(models) >= cfg.BatchSize {
+			if err = flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if err = flush(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// importReader returns a function that decodes the next document and its line number.
+// Decoding errors are returned as LineError, any other error aborts the import.
+func (r *Repository[T]) importReader(rd io.Reader, format DataFormat, cfg TransferOptions) (func() (int, bson.D, error), error) {
+	switch format {
+	case FormatJSONL, FormatCanonicalJSONL:
+		scanner := bufio.NewScanner(rd)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		line := 0
+		return func() (int, bson.D, error) {
+			var doc bson.D
+			for scanner.Scan() {
+				line++
+				if len(strings.TrimSpace(scanner.Text())) == 0 {
+					continue
+				}
+				err := bson.UnmarshalExtJSON(scanner.Bytes(), format == FormatCanonicalJSONL, &doc)
+				if err == nil {
+					err = r.checkImportDocument(doc)
+				}
+				if err != nil {
+					return line, nil, LineError{Line: line, Err: err}
+				}
+				return line, doc, nil
+			}
+			if err := scanner.Err(); err != nil {
+				return line, doc, fmt.Errorf("failed to read input: %w", err)
+			}
+			return line, doc, io.EOF
+		}, nil
+	case FormatCSV:
+		cr := csv.NewReader(rd)
+		cr.ReuseRecord = true
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv header: %w", err)
+		}
+		// without columns of T the headers name the fields
+		known, _ := r.csvColumns(cfg.Columns)
+		byHeader := make(map[string]csvColumn)
+		for _, c := range known {
+			byHeader[c.header] = c
+		}
+		columns := make([]csvColumn, len(header))
+		for i, h := range header {
+			c, ok := byHeader[h]
+			if !ok {
+				c = csvColumn{header: h, field: h}
+			}
+			columns[i] = c
+		}
+		return func() (int, bson.D, error) {
+			record, err := cr.Read()
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return parseErr.Line, nil, LineError{Line: parseErr.Line, Err: parseErr.Err}
+			}
+			if err != nil {
+				return 0, nil, err
+			}
+			line, _ := cr.FieldPos(0)
+			doc, err := csvDocument(record, columns)
+			if err == nil {
+				err = r.checkImportDocument(doc)
+			}
+			if err != nil {
+				return line, nil, LineError{Line: line, Err: err}
+			}
+			return line, doc, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// checkImportDocument reports documents whose fields don't decode into T
+func (r *Repository[T]) checkImportDocument(doc bson.D) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal document: %w", err)
+	}
+	var model T
+	if err = bson.Unmarshal(data, &model); err != nil {
+		return fmt.Errorf("failed to decode document into %T: %w", model, err)
+	}
+	return nil
+}
+
+// importModel builds the write model of an imported document
+func importModel(doc bson.D, mode ImportMode, keyFields []string) (mongo.WriteModel, error) {
+	if mode == ImportInsert {
+		return mongo.NewInsertOneModel().SetDocument(doc), nil
+	}
+
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal document: %w", err)
+	}
+	raw := bson.Raw(data)
+	filter := bson.D{}
+	for _, key := range keyFields {
+		v, err := raw.LookupErr(strings.Split(key, ".")...)
+		if err != nil {
+			return nil, fmt.Errorf("key field %s is missing", key)
+		}
+		filter = append(filter, bson.E{Key: key, Value: v})
+	}
+
+	if mode == ImportReplace {
+		return mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(doc).SetUpsert(true), nil
+	}
+
+	set := make(bson.D, 0, len(doc))
+	update := bson.D{}
+	for _, f := range doc {
+		if f.Key == "_id" {
+			update = append(update, bson.E{Key: "$setOnInsert", Value: bson.D{f}})
+			continue
+		}
+		set = append(set, f)
+	}
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true), nil
+}
+
+// csvColumn maps a CSV header to a bson field
+type csvColumn struct {
+	header string
+	field  string
+	typ    reflect.Type
+}
+
+// csvColumns returns the CSV columns of T, using the csv tag for the header and the bson tag for the field.
+// Only structs have columns of their own, the fields must be given for other types like maps.
+func (r *Repository[T]) csvColumns(fields []string) ([]csvColumn, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var columns []csvColumn
+	switch {
+	case t.Kind() == reflect.Struct:
+		columns = structColumns(t)
+	case len(fields) == 0:
+		return nil, fmt.Errorf("csv columns are required for %s, it's not a struct", t)
+	}
+	if len(fields) == 0 {
+		return columns, nil
+	}
+
+	byField := make(map[string]csvColumn, len(columns))
+	for _, c := range columns {
+		byField[c.field] = c
+	}
+	selected := make([]csvColumn, len(fields))
+	for i, f := range fields {
+		c, ok := byField[f]
+		if !ok {
+			c = csvColumn{header: f, field: f}
+		}
+		selected[i] = c
+	}
+	return selected, nil
+}
+
+func structColumns(t reflect.Type) []csvColumn {
+	var columns []csvColumn
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("bson"), ",")
+		if name == "-" || f.Tag.Get("csv") == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			if f.Type.Kind() == reflect.Struct {
+				columns = append(columns, structColumns(f.Type)...)
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		header := f.Tag.Get("csv")
+		if header == "" {
+			header = name
+		}
+		columns = append(columns, csvColumn{header: header, field: name, typ: f.Type})
+	}
+	return columns
+}
+
+func csvRecord(doc bson.Raw, columns []csvColumn) []string {
+	record := make([]string, len(columns))
+	for i, c := range columns {
+		v, err := doc.LookupErr(strings.Split(c.field, ".")...)
+		if err != nil {
+			continue
+		}
+		record[i] = formatCSVValue(v)
+	}
+	return record
+}
+
+func formatCSVValue(v bson.RawValue) string {
+	switch v.Type {
+	case bson.TypeString:
+		return v.StringValue()
+	case bson.TypeInt32:
+		return strconv.FormatInt(int64(v.Int32()), 10)
+	case bson.TypeInt64:
+		return strconv.FormatInt(v.Int64(), 10)
+	case bson.TypeDouble:
+		return strconv.FormatFloat(v.Double(), 'f', -1, 64)
+	case bson.TypeBoolean:
+		return strconv.FormatBool(v.Boolean())
+	case bson.TypeObjectID:
+		return v.ObjectID().Hex()
+	case bson.TypeDateTime:
+		return time.UnixMilli(v.DateTime()).UTC().Format(time.RFC3339Nano)
+	case bson.TypeNull, bson.TypeUndefined:
+		return ""
+	default:
+		return v.String()
+	}
+}
+
+// csvDocument converts a CSV record to a document, using the struct field types to parse values
+func csvDocument(record []string, columns []csvColumn) (bson.D, error) {
+	doc := make(bson.D, 0, len(record))
+	for i, s := range record {
+		if i >= len(columns) || s == "" {
+			continue
+		}
+		v, err := parseCSVValue(s, columns[i].typ)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", columns[i].header, err)
+		}
+		doc = append(doc, bson.E{Key: columns[i].field, Value: v})
+	}
+	return doc, nil
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(bson.ObjectID{})
+)
+
+func parseCSVValue(s string, t reflect.Type) (any, error) {
+	if t == nil {
+		return s, nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return time.Parse(time.RFC3339Nano, s)
+	case t == objectIDType:
+		return bson.ObjectIDFromHex(s)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(s, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(s, 64)
+	default:
+		// Nested documents and arrays are written as Extended JSON.
+		var wrapper struct {
+			V any `bson:"v"`
+		}
+		if err := bson.UnmarshalExtJSON([]byte(`{"v":`+s+`}`), false, &wrapper); err != nil {
+			return nil, err
+		}
+		return wrapper.V, nil
+	}
+}
+
+func transferConfig(opts []TransferOptions) TransferOptions {
+	var cfg TransferOptions
+	if len(opts) > 0 {
+		cfg = opts[0]
+	}
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = DefaultTransferBatchSize
+	}
+	return cfg
+}
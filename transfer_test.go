@@ -0,0 +1,228 @@
+package mongoclient
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type transferUser struct {
+	BaseField `bson:",inline"`
+	Name      string   `bson:"name" csv:"Name"`
+	Age       int      `bson:"age"`
+	Active    bool     `bson:"active"`
+	Tags      []string `bson:"tags"`
+}
+
+func readImport(t *testing.T, format DataFormat, data string) ([]bson.D, []LineError) {
+	t.Helper()
+	r := NewRepository[*transferUser](nil)
+	next, err := r.importReader(strings.NewReader(data), format, TransferOptions{})
+	if err != nil {
+		t.Fatalf("importReader() error = %v", err)
+	}
+
+	var (
+		docs   []bson.D
+		errs   []LineError
+		lineEr LineError
+	)
+	for {
+		_, doc, err := next()
+		if err == io.EOF {
+			return docs, errs
+		}
+		if errors.As(err, &lineEr) {
+			errs = append(errs, lineEr)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("next() error = %v", err)
+		}
+		docs = append(docs, doc)
+	}
+}
+
+func TestImportReaderJSONL(t *testing.T) {
+	data := `{"name": "Alice", "extra": {"nested": true}, "createdAt": {"$date": "2020-01-02T03:04:05Z"}, "age": 30}
+
+{"name": "Bob", "age": "not a number"}
+not json
+`
+	docs, errs := readImport(t, FormatJSONL, data)
+
+	if len(docs) != 1 {
+		t.Fatalf("documents = %d, want 1", len(docs))
+	}
+	var keys []string
+	for _, e := range docs[0] {
+		keys = append(keys, e.Key)
+	}
+	if got, want := strings.Join(keys, ","), "name,extra,createdAt,age"; got != want {
+		t.Errorf("fields = %s, want %s: order and unknown fields must be kept", got, want)
+	}
+	if created, _ := lookupField(docs[0], "createdAt"); created.(bson.DateTime).Time().UTC() != time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) {
+		t.Errorf("createdAt = %v, must be kept", created)
+	}
+
+	if len(errs) != 2 || errs[0].Line != 3 || errs[1].Line != 4 {
+		t.Errorf("line errors = %v, want lines 3 and 4", errs)
+	}
+}
+
+func TestImportReaderCSV(t *testing.T) {
+	data := "Name,age,active,tags\nAlice,30,true,\"[\"\"a\"\"]\"\nBob,thirty,false,\n"
+	docs, errs := readImport(t, FormatCSV, data)
+
+	if len(docs) != 1 {
+		t.Fatalf("documents = %d, want 1", len(docs))
+	}
+	want := bson.D{
+		{Key: "name", Value: "Alice"},
+		{Key: "age", Value: int64(30)},
+		{Key: "active", Value: true},
+		{Key: "tags", Value: bson.A{"a"}},
+	}
+	got, _ := bson.MarshalExtJSON(docs[0], true, false)
+	wantJSON, _ := bson.MarshalExtJSON(want, true, false)
+	if string(got) != string(wantJSON) {
+		t.Errorf("document = %s, want %s", got, wantJSON)
+	}
+	if len(errs) != 1 || errs[0].Line != 3 {
+		t.Errorf("line errors = %v, want line 3", errs)
+	}
+}
+
+func TestImportModel(t *testing.T) {
+	id := bson.NewObjectID()
+	doc := bson.D{{Key: "_id", Value: id}, {Key: "email", Value: "a@example.com"}, {Key: "name", Value: "A"}}
+
+	tests := []struct {
+		name    string
+		mode    ImportMode
+		keys    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "insert", mode: ImportInsert, keys: []string{"_id"}, want: "*mongo.InsertOneModel"},
+		{name: "replace", mode: ImportReplace, keys: []string{"_id"}, want: "*mongo.ReplaceOneModel"},
+		{name: "upsert", mode: ImportUpsert, keys: []string{"email"}, want: "*mongo.UpdateOneModel"},
+		{name: "missing key", mode: ImportUpsert, keys: []string{"phone"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := importModel(doc, tt.mode, tt.keys)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("importModel() error = nil, want missing key error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("importModel() error = %v", err)
+			}
+
+			switch m := model.(type) {
+			case *mongo.InsertOneModel:
+				if tt.want != "*mongo.InsertOneModel" {
+					t.Fatalf("model = %T, want %s", model, tt.want)
+				}
+			case *mongo.ReplaceOneModel:
+				if tt.want != "*mongo.ReplaceOneModel" || m.Upsert == nil || !*m.Upsert {
+					t.Fatalf("model = %T, want upserting %s", model, tt.want)
+				}
+			case *mongo.UpdateOneModel:
+				if tt.want != "*mongo.UpdateOneModel" {
+					t.Fatalf("model = %T, want %s", model, tt.want)
+				}
+				update := m.Update.(bson.D)
+				if update[0].Key != "$setOnInsert" || update[1].Key != "$set" {
+					t.Errorf("update = %v, want _id in $setOnInsert and fields in $set", update)
+				}
+			default:
+				t.Fatalf("model = %T, want %s", model, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatCSVValue(t *testing.T) {
+	id := bson.NewObjectID()
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{"text", "text"},
+		{int32(7), "7"},
+		{int64(-3), "-3"},
+		{1.5, "1.5"},
+		{true, "true"},
+		{id, id.Hex()},
+		{time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), "2024-05-06T07:08:09Z"},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		raw, err := bson.Marshal(bson.D{{Key: "v", Value: tt.value}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatCSVValue(bson.Raw(raw).Lookup("v")); got != tt.want {
+			t.Errorf("formatCSVValue(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCSVColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns func(fields []string) ([]csvColumn, error)
+		fields  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "struct pointer", columns: NewRepository[*transferUser](nil).csvColumns, want: []string{"_id", "createdAt", "updatedAt", "name", "age", "active", "tags"}},
+		{name: "struct value", columns: (&Repository[transferUser]{}).csvColumns, want: []string{"_id", "createdAt", "updatedAt", "name", "age", "active", "tags"}},
+		{name: "selected fields", columns: (&Repository[transferUser]{}).csvColumns, fields: []string{"age", "extra"}, want: []string{"age", "extra"}},
+		{name: "map without fields", columns: (&Repository[bson.M]{}).csvColumns, wantErr: true},
+		{name: "map with fields", columns: (&Repository[bson.M]{}).csvColumns, fields: []string{"name", "age"}, want: []string{"name", "age"}},
+		{name: "map pointer without fields", columns: (&Repository[*bson.M]{}).csvColumns, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, err := tt.columns(tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("csvColumns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var fields []string
+			for _, c := range columns {
+				fields = append(fields, c.field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("csvColumns() fields = %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportReaderCSVMap(t *testing.T) {
+	r := &Repository[bson.M]{}
+	next, err := r.importReader(strings.NewReader("name,age\nAlice,30\n"), FormatCSV, TransferOptions{})
+	if err != nil {
+		t.Fatalf("importReader() error = %v", err)
+	}
+	_, doc, err := next()
+	if err != nil {
+		t.Fatalf("next() error = %v", err)
+	}
+	if len(doc) != 2 || doc[0].Key != "name" || doc[1].Key != "age" {
+		t.Errorf("document = %v, want the header fields", doc)
+	}
+}
@@ -0,0 +1,371 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrNotExecuted is set on operations skipped because an earlier operation failed
+var ErrNotExecuted = errors.New("operation not executed")
+
+// UnitOperationKind is the kind of a queued write
+type UnitOperationKind string
+
+const (
+	UnitInsert     UnitOperationKind = "insert"
+	UnitUpdate     UnitOperationKind = "update"
+	UnitUpdateMany UnitOperationKind = "updateMany"
+	UnitReplace    UnitOperationKind = "replace"
+	UnitDelete     UnitOperationKind = "delete"
+	UnitDeleteMany UnitOperationKind = "deleteMany"
+)
+
+// UnitOperation is a write queued in a UnitOfWork, created by the *Op methods of repositories
+type UnitOperation struct {
+	Kind       UnitOperationKind
+	collection *mongo.Collection
+	// prepare runs the model hooks and builds the write model
+	prepare func(ctx context.Context) (mongo.WriteModel, error)
+}
+
+// UnitOperationResult is the outcome of a queued write. Counts are reported per operation
+// in transactions only, bulk writes report them per collection in UnitOfWorkResult.
+type UnitOperationResult struct {
+	Collection    string
+	Kind          UnitOperationKind
+	Executed      bool
+	InsertedID    any
+	UpsertedID    any
+	MatchedCount  int64
+	ModifiedCount int64
+	DeletedCount  int64
+	Err           error
+}
+
+// UnitOfWorkResult is the outcome of a commit, operations are in the order they were added
+type UnitOfWorkResult struct {
+	Transactional bool
+	Operations    []UnitOperationResult
+	// Collections holds the bulk write results per collection when committed without a transaction
+	Collections map[string]*mongo.BulkWriteResult
+}
+
+// UnitOfWorkOptions configures a UnitOfWork
+type UnitOfWorkOptions struct {
+	// DisableTransactions commits with ordered bulk writes per collection even if transactions are available
+	DisableTransactions bool
+	// Transaction configures the transaction
+	Transaction TransactionOptions
+}
+
+// UnitOfWork collects writes against several repositories and commits them together:
+// in one transaction when the deployment supports it, otherwise as ordered bulk writes per collection
+type UnitOfWork struct {
+	opts       UnitOfWorkOptions
+	operations []UnitOperation
+}
+
+// NewUnitOfWork creates an empty unit of work
+func NewUnitOfWork(opts ...UnitOfWorkOptions) *UnitOfWork {
+	u := &UnitOfWork{}
+	if len(opts) > 0 {
+		u.opts = opts[0]
+	}
+	return u
+}
+
+// Add queues operations
+func (u *UnitOfWork) Add(operations ...UnitOperation) *UnitOfWork {
+	u.operations = append(u.operations, operations...)
+	return u
+}
+
+// Len returns the number of queued operations
+func (u *UnitOfWork) Len() int {
+	return len(u.operations)
+}
+
+// Commit runs the hooks of all operations and writes them. The queue is cleared on success.
+func (u *UnitOfWork) Commit(ctx context.Context) (*UnitOfWorkResult, error) {
+	if len(u.operations) == 0 {
+		return &UnitOfWorkResult{}, nil
+	}
+
+	models := make([]mongo.WriteModel, len(u.operations))
+	for i, op := range u.operations {
+		model, err := op.prepare(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare %s on %s: %w", op.Kind, op.collection.Name(), err)
+		}
+		models[i] = model
+	}
+
+	client := u.operations[0].collection.Database().Client()
+	transactional := !u.opts.DisableTransactions
+	if transactional && TransactionSession(ctx) == nil {
+		supported, err := transactionsSupported(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		transactional = supported
+	}
+
+	var (
+		result *UnitOfWorkResult
+		err    error
+	)
+	if transactional {
+		// the result of the last attempt tells which operation failed, none of them was applied
+		var attempt *UnitOfWorkResult
+		result, err = WithTransaction(ctx, client, func(ctx context.Context) (*UnitOfWorkResult, error) {
+			res, err := u.commitOperations(ctx, models)
+			attempt = res
+			return res, err
+		}, u.opts.Transaction)
+		if err != nil && attempt != nil {
+			for i := range attempt.Operations {
+				attempt.Operations[i].Executed = false
+			}
+			result = attempt
+		}
+	} else {
+		result, err = u.commitBulk(ctx, models)
+	}
+	if err != nil {
+		return result, err
+	}
+	u.operations = nil
+	return result, nil
+}
+
+// commitOperations writes the operations one by one in the order they were added
+func (u *UnitOfWork) commitOperations(ctx context.Context, models []mongo.WriteModel) (*UnitOfWorkResult, error) {
+	result := u.newResult(true, models)
+	for i, op := range u.operations {
+		res := &result.Operations[i]
+		bulk, err := op.collection.BulkWrite(ctx, []mongo.WriteModel{models[i]})
+		if err != nil {
+			res.Err = err
+			return result, fmt.Errorf("failed to %s in %s: %w", op.Kind, op.collection.Name(), err)
+		}
+		res.Executed, res.Err = true, nil
+		res.MatchedCount = bulk.MatchedCount
+		res.ModifiedCount = bulk.ModifiedCount
+		res.DeletedCount = bulk.DeletedCount
+		if id, ok := bulk.UpsertedIDs[0]; ok {
+			res.UpsertedID = id
+		}
+	}
+	return result, nil
+}
+
+// commitBulk writes the operations as one ordered bulk write per collection,
+// collections are written in the order of their first operation
+func (u *UnitOfWork) commitBulk(ctx context.Context, models []mongo.WriteModel) (*UnitOfWorkResult, error) {
+	result := u.newResult(false, models)
+	result.Collections = make(map[string]*mongo.BulkWriteResult)
+
+	var order []*mongo.Collection
+	indexes := make(map[*mongo.Collection][]int)
+	for i, op := range u.operations {
+		if _, ok := indexes[op.collection]; !ok {
+			order = append(order, op.collection)
+		}
+		indexes[op.collection] = append(indexes[op.collection], i)
+	}
+
+	for _, collection := range order {
+		batch := make([]mongo.WriteModel, len(indexes[collection]))
+		for j, i := range indexes[collection] {
+			batch[j] = models[i]
+		}
+
+		bulk, err := collection.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(true))
+		outcome := newBulkOutcome(len(batch), err)
+		if outcome.failedErr != nil {
+			result.Operations[indexes[collection][outcome.executed]].Err = outcome.failedErr
+		}
+
+		for j, i := range indexes[collection] {
+			res := &result.Operations[i]
+			if j < outcome.executed {
+				// with only a write concern error the writes were applied but may not be durable
+				res.Executed, res.Err = true, outcome.writeConcernErr
+				if bulk != nil {
+					res.UpsertedID = bulk.UpsertedIDs[int64(j)]
+				}
+			}
+		}
+		if bulk != nil {
+			result.Collections[collection.Name()] = bulk
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to write %s: %w", collection.Name(), err)
+		}
+	}
+	return result, nil
+}
+
+// bulkOutcome is what an ordered bulk write of a batch did
+type bulkOutcome struct {
+	// executed is the number of leading operations that were applied
+	executed int
+	// failedErr is the error of the operation at index executed, nil if all were applied or it's unknown
+	failedErr error
+	// writeConcernErr is set when the applied operations didn't satisfy the write concern
+	writeConcernErr error
+}
+
+// newBulkOutcome reads the outcome of an ordered bulk write of size operations from its error.
+// Errors other than a BulkWriteException leave the outcome unknown, so nothing is reported as applied.
+func newBulkOutcome(size int, err error) bulkOutcome {
+	if err == nil {
+		return bulkOutcome{executed: size}
+	}
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) {
+		return bulkOutcome{}
+	}
+
+	outcome := bulkOutcome{executed: size}
+	if len(bwe.WriteErrors) > 0 {
+		outcome.executed = bwe.WriteErrors[0].Index
+		outcome.failedErr = bwe.WriteErrors[0]
+	}
+	if bwe.WriteConcernError != nil {
+		outcome.writeConcernErr = bwe.WriteConcernError
+	}
+	if len(bwe.WriteErrors) == 0 && bwe.WriteConcernError == nil {
+		return bulkOutcome{}
+	}
+	return outcome
+}
+
+// newResult creates the result with operations not executed yet
+func (u *UnitOfWork) newResult(transactional bool, models []mongo.WriteModel) *UnitOfWorkResult {
+	result := &UnitOfWorkResult{Transactional: transactional, Operations: make([]UnitOperationResult, len(u.operations))}
+	for i, op := range u.operations {
+		result.Operations[i] = UnitOperationResult{Collection: op.collection.Name(), Kind: op.Kind, Err: ErrNotExecuted}
+		if model, ok := models[i].(*mongo.InsertOneModel); ok {
+			result.Operations[i].InsertedID = documentID(model.Document)
+		}
+	}
+	return result
+}
+
+// transactionSupport caches the result of transactionsSupported per client,
+// the deployment type doesn't change while a client is connected
+var transactionSupport sync.Map
+
+// transactionsSupported reports whether the deployment is a replica set or a sharded cluster
+func transactionsSupported(ctx context.Context, client *mongo.Client) (bool, error) {
+	if supported, ok := transactionSupport.Load(client); ok {
+		return supported.(bool), nil
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false, fmt.Errorf("failed to detect deployment type: %w", err)
+	}
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	transactionSupport.Store(client, supported)
+	return supported, nil
+}
+
+// documentID returns the _id of the document, nil if it has none
+func documentID(document any) any {
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return nil
+	}
+	value, err := bson.Raw(raw).LookupErr("_id")
+	if err != nil {
+		return nil
+	}
+	var id any
+	if err = value.Unmarshal(&id); err != nil {
+		return nil
+	}
+	return id
+}
+
+// prepareUpdate wraps model updates in $set after calling their BeforeUpdate hook
+func prepareUpdate(update any) (any, error) {
+	switch {
+	case isMongoOperator(update):
+		return update, nil
+	case isStructOrPtrToStruct(update):
+		if hook, ok := update.(Document); ok {
+			hook.BeforeUpdate()
+		}
+		return bson.M{"$set": update}, nil
+	default:
+		return nil, fmt.Errorf("unsupported update type: %T", update)
+	}
+}
+
+// InsertOp queues an insert of the document, BeforeInsert runs at commit
+func (r *Repository[T]) InsertOp(document T) UnitOperation {
+	return UnitOperation{Kind: UnitInsert, collection: r.collection, prepare: func(ctx context.Context) (mongo.WriteModel, error) {
+		if err := r.beforeInsert(ctx, document); err != nil {
+			return nil, err
+		}
+		return mongo.NewInsertOneModel().SetDocument(document), nil
+	}}
+}
+
+// UpdateOp queues an update of a single document
+func (r *Repository[T]) UpdateOp(filter, update any) UnitOperation {
+	return UnitOperation{Kind: UnitUpdate, collection: r.collection, prepare: func(ctx context.Context) (mongo.WriteModel, error) {
+		update, err := prepareUpdate(update)
+		if err != nil {
+			return nil, err
+		}
+		return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update), nil
+	}}
+}
+
+// UpdateManyOp queues an update of all matching documents
+func (r *Repository[T]) UpdateManyOp(filter, update any) UnitOperation {
+	return UnitOperation{Kind: UnitUpdateMany, collection: r.collection, prepare: func(ctx context.Context) (mongo.WriteModel, error) {
+		update, err := prepareUpdate(update)
+		if err != nil {
+			return nil, err
+		}
+		return mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update), nil
+	}}
+}
+
+// ReplaceOp queues a replacement of a single document, BeforeUpdate runs at commit
+func (r *Repository[T]) ReplaceOp(filter any, document T) UnitOperation {
+	return UnitOperation{Kind: UnitReplace, collection: r.collection, prepare: func(ctx context.Context) (mongo.WriteModel, error) {
+		if hook, ok := any(document).(Document); ok {
+			hook.BeforeUpdate()
+		}
+		return mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(document), nil
+	}}
+}
+
+// DeleteOp queues a deletion of a single document
+func (r *Repository[T]) DeleteOp(filter any) UnitOperation {
+	return UnitOperation{Kind: UnitDelete, collection: r.collection, prepare: func(ctx context.Context) (mongo.WriteModel, error) {
+		return mongo.NewDeleteOneModel().SetFilter(filter), nil
+	}}
+}
+
+// DeleteManyOp queues a deletion of all matching documents
+func (r *Repository[T]) DeleteManyOp(filter any) UnitOperation {
+	return UnitOperation{Kind: UnitDeleteMany, collection: r.collection, prepare: func(ctx context.Context) (mongo.WriteModel, error) {
+		return mongo.NewDeleteManyModel().SetFilter(filter), nil
+	}}
+}
@@ -0,0 +1,59 @@
+package mongoclient
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestNewBulkOutcome(t *testing.T) {
+	writeErr := mongo.BulkWriteError{WriteError: mongo.WriteError{Index: 2, Code: 11000}}
+	wcErr := &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"}
+
+	tests := []struct {
+		name        string
+		err         error
+		wantApplied int
+		wantFailed  bool
+		wantWC      bool
+	}{
+		{name: "success", wantApplied: 5},
+		{name: "network error", err: errors.New("connection reset"), wantApplied: 0},
+		{
+			name:        "write error",
+			err:         mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{writeErr}},
+			wantApplied: 2,
+			wantFailed:  true,
+		},
+		{
+			name:        "write concern error only",
+			err:         mongo.BulkWriteException{WriteConcernError: wcErr},
+			wantApplied: 5,
+			wantWC:      true,
+		},
+		{
+			name:        "write and write concern errors",
+			err:         mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{writeErr}, WriteConcernError: wcErr},
+			wantApplied: 2,
+			wantFailed:  true,
+			wantWC:      true,
+		},
+		{name: "empty exception", err: mongo.BulkWriteException{}, wantApplied: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newBulkOutcome(5, tt.err)
+			if got.executed != tt.wantApplied {
+				t.Errorf("executed = %d, want %d", got.executed, tt.wantApplied)
+			}
+			if (got.failedErr != nil) != tt.wantFailed {
+				t.Errorf("failedErr = %v, want set = %v", got.failedErr, tt.wantFailed)
+			}
+			if (got.writeConcernErr != nil) != tt.wantWC {
+				t.Errorf("writeConcernErr = %v, want set = %v", got.writeConcernErr, tt.wantWC)
+			}
+		})
+	}
+}